@@ -2,31 +2,43 @@ package command
 
 import (
 	"encoding/json"
-	"time"
 
+	"github.com/TerrexTech/agg-shipment-cmd/gs1"
 	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
 	cmodel "github.com/TerrexTech/go-common-models/model"
-	"github.com/TerrexTech/go-mongoutils/mongo"
 	"github.com/TerrexTech/uuuid"
 	"github.com/pkg/errors"
 )
 
-func addItem(c *cmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+func addItem(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
 	item := &model.Item{}
-	err := json.Unmarshal(c.cmd.Data, item)
+	err := json.Unmarshal(c.Cmd.Data, item)
 	if err != nil {
 		err = errors.Wrap(err, "Error unmarshalling command-data into Item")
 		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
 	}
 
-	item, idErr := updateItemID(item)
+	return addNewItem(c, item)
+}
+
+// addNewItem validates the Item and creates the ItemAdded Event for it.
+func addNewItem(c *CmdConfig, item *model.Item) ([]byte, *cmodel.Event, *cmodel.Error) {
+	item, idErr := updateItemID(item, c.IDGen)
 	if idErr != nil {
 		return nil, nil, idErr
 	}
-	validateErr := validateItem(c.coll, item)
+	validateErr := validateItem(c.Items, item)
 	if validateErr != nil {
 		return nil, nil, validateErr
 	}
+	upc, err := gs1.NormalizeGTIN(item.UPC)
+	if err != nil {
+		err = errors.Wrap(err, "Error normalizing UPC")
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	item.UPC = upc
+	item.Version = 1
 
 	cmdData, err := json.Marshal(item)
 	if err != nil {
@@ -34,26 +46,15 @@ func addItem(c *cmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
 		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
 	}
 
-	eventID, err := uuuid.NewV4()
-	if err != nil {
-		err = errors.Wrap(err, "Error generating EventID")
-		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
-	}
-	event := &cmodel.Event{
-		Action:        "ItemRegistered",
-		AggregateID:   model.AggregateID,
-		CorrelationID: c.cmd.UUID,
-		Data:          cmdData,
-		NanoTime:      time.Now().UnixNano(),
-		Source:        c.serviceName,
-		UUID:          eventID,
-		YearBucket:    2018,
+	event, eventErr := newEvent(c, model.EventItemAdded, cmdData, item.Version)
+	if eventErr != nil {
+		return nil, nil, eventErr
 	}
 
 	return cmdData, event, nil
 }
 
-func updateItemID(item *model.Item) (*model.Item, *cmodel.Error) {
+func updateItemID(item *model.Item, idGen model.IDGenerator) (*model.Item, *cmodel.Error) {
 	var itemID uuuid.UUID
 	var err error
 
@@ -66,7 +67,7 @@ func updateItemID(item *model.Item) (*model.Item, *cmodel.Error) {
 	}
 
 	if itemID == (uuuid.UUID{}) {
-		itemID, err := uuuid.NewV4()
+		itemID, err := idGen.NewID()
 		if err != nil {
 			err = errors.Wrap(err, "Error generating ItemID")
 			return nil, cmodel.NewError(cmodel.UserError, err.Error())
@@ -77,49 +78,13 @@ func updateItemID(item *model.Item) (*model.Item, *cmodel.Error) {
 	return item, nil
 }
 
-func validateItem(coll *mongo.Collection, item *model.Item) *cmodel.Error {
-	if item.DateArrived == 0 {
-		err := errors.New("missing DateArrived for item")
-		return cmodel.NewError(cmodel.UserError, err.Error())
-	}
-	if item.Lot == "" {
-		err := errors.New("missing Lot for item")
-		return cmodel.NewError(cmodel.UserError, err.Error())
-	}
-	if item.Name == "" {
-		err := errors.New("missing Name for item")
-		return cmodel.NewError(cmodel.UserError, err.Error())
-	}
-	if item.Origin == "" {
-		err := errors.New("missing Origin for item")
-		return cmodel.NewError(cmodel.UserError, err.Error())
-	}
-	if item.Price == 0 {
-		err := errors.New("missing Price for item")
-		return cmodel.NewError(cmodel.UserError, err.Error())
-	}
-	if item.RSCustomerID == "" {
-		err := errors.New("missing RSCustomerID for item")
-		return cmodel.NewError(cmodel.UserError, err.Error())
-	}
-	if item.SKU == "" {
-		err := errors.New("missing SKU for item")
-		return cmodel.NewError(cmodel.UserError, err.Error())
-	}
-	if item.Timestamp == 0 {
-		err := errors.New("missing Timestamp for item")
-		return cmodel.NewError(cmodel.UserError, err.Error())
-	}
-	if item.TotalWeight == 0 {
-		err := errors.New("missing TotalWeight for item")
-		return cmodel.NewError(cmodel.UserError, err.Error())
-	}
-	if item.UPC == "" {
-		err := errors.New("missing UPC for item")
-		return cmodel.NewError(cmodel.UserError, err.Error())
+func validateItem(items repository.ItemRepository, item *model.Item) *cmodel.Error {
+	validateErr := validateNewItem(item)
+	if validateErr != nil {
+		return validateErr
 	}
 
-	_, err := coll.FindOne(model.Item{
+	_, err := items.FindOne(&model.Item{
 		ItemID: item.ItemID,
 	})
 	if err == nil {
@@ -0,0 +1,85 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/TerrexTech/agg-shipment-cmd/gs1"
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+// barcodeItemParams are the params for AddItemFromBarcode. These are the
+// Item-fields, along with the scanned GS1-128 Barcode from which UPC, Lot,
+// DateArrived and TotalWeight are set.
+type barcodeItemParams struct {
+	model.Item
+	Barcode string `json:"barcode,omitempty"`
+}
+
+func addItemFromBarcode(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+	params := &barcodeItemParams{}
+	err := json.Unmarshal(c.Cmd.Data, params)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling command-data into BarcodeItemParams")
+		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+	if params.Barcode == "" {
+		err = errors.New("missing Barcode")
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+
+	label, err := gs1.ParseLabel(params.Barcode, c.Clock.Now())
+	if err != nil {
+		err = errors.Wrap(err, "Error parsing Barcode")
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	item := &params.Item
+	labelErr := applyLabel(item, label)
+	if labelErr != nil {
+		return nil, nil, labelErr
+	}
+
+	return addNewItem(c, item)
+}
+
+// applyLabel sets the Item-fields from the fields on label. An error is
+// returned if a field is set on both Item and label, with different values.
+func applyLabel(item *model.Item, label *gs1.Label) *cmodel.Error {
+	if label.GTIN != "" {
+		// UPC on Item might not be normalized yet
+		upc, err := gs1.NormalizeGTIN(item.UPC)
+		if item.UPC != "" && (err != nil || upc != label.GTIN) {
+			return labelMismatch("UPC", item.UPC, label.GTIN)
+		}
+		item.UPC = label.GTIN
+	}
+	if label.Lot != "" {
+		if item.Lot != "" && item.Lot != label.Lot {
+			return labelMismatch("Lot", item.Lot, label.Lot)
+		}
+		item.Lot = label.Lot
+	}
+	if !label.PackDate.IsZero() {
+		dateArrived := label.PackDate.Unix()
+		if item.DateArrived != 0 && item.DateArrived != dateArrived {
+			return labelMismatch("DateArrived", item.DateArrived, dateArrived)
+		}
+		item.DateArrived = dateArrived
+	}
+	if label.NetWeightKg != 0 {
+		if item.TotalWeight != 0 && item.TotalWeight != label.NetWeightKg {
+			return labelMismatch("TotalWeight", item.TotalWeight, label.NetWeightKg)
+		}
+		item.TotalWeight = label.NetWeightKg
+	}
+	return nil
+}
+
+func labelMismatch(field string, itemValue interface{}, labelValue interface{}) *cmodel.Error {
+	err := fmt.Errorf(
+		"%s %v does not match %v on Barcode", field, itemValue, labelValue,
+	)
+	return cmodel.NewError(cmodel.UserError, err.Error())
+}
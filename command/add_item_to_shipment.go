@@ -0,0 +1,79 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+// shipmentItemParams are the params for adding/removing an Item to/from Shipment.
+type shipmentItemParams struct {
+	ShipmentID string `json:"shipmentID,omitempty"`
+	ItemID     string `json:"itemID,omitempty"`
+	// Version is the version of Shipment expected by command, and ItemVersion
+	// is the version of Item expected. The version-checks are skipped if these
+	// are 0. These Commands are sharded on both Shipment and Item, so both are
+	// checked in order with other Commands for the Shipment and the Item.
+	Version     int64 `json:"version,omitempty"`
+	ItemVersion int64 `json:"itemVersion,omitempty"`
+}
+
+func addItemToShipment(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+	params := &shipmentItemParams{}
+	err := json.Unmarshal(c.Cmd.Data, params)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling cmd-data into ShipmentItemParams")
+		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+
+	shipment, findErr := findShipment(c.Shipments, params.ShipmentID)
+	if findErr != nil {
+		return nil, nil, findErr
+	}
+	versionErr := checkVersion(params.Version, shipment.Version)
+	if versionErr != nil {
+		return nil, nil, versionErr
+	}
+	if model.IsShipmentFinal(shipment.Status) {
+		err = fmt.Errorf("cannot add items to shipment with status %s", shipment.Status)
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	item, findErr := findItem(c.Items, params.ItemID)
+	if findErr != nil {
+		return nil, nil, findErr
+	}
+	versionErr = checkVersion(params.ItemVersion, item.Version)
+	if versionErr != nil {
+		return nil, nil, versionErr
+	}
+	if item.ShipmentID == params.ShipmentID {
+		err = errors.New("item already belongs to shipment")
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	if item.ShipmentID != "" {
+		err = errors.New("item belongs to another shipment")
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+
+	eventData := model.ShipmentItemData{
+		ShipmentID:  params.ShipmentID,
+		ItemID:      params.ItemID,
+		Version:     shipment.Version + 1,
+		ItemVersion: item.Version + 1,
+	}
+	marshalData, err := json.Marshal(eventData)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling ShipmentItemData")
+		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+
+	event, eventErr := newEvent(c, model.EventItemAddedToShipment, marshalData, eventData.Version)
+	if eventErr != nil {
+		return nil, nil, eventErr
+	}
+
+	return marshalData, event, nil
+}
@@ -0,0 +1,362 @@
+package command
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/TerrexTech/uuuid"
+	"github.com/pkg/errors"
+)
+
+// auditRecord is an Item or Shipment changed by an Event, with its
+// fields before and after the Event. before is nil if the record was
+// created, and after is nil if the record was deleted.
+type auditRecord struct {
+	itemID     string
+	shipmentID string
+	before     interface{}
+	after      interface{}
+}
+
+// auditEntries creates the AuditEntries for changes made by the Event.
+// This must be called before the Event is applied on Aggregate-state,
+// since the records are read from it in their state before the Event.
+func auditEntries(c *CmdConfig, event *cmodel.Event) ([]*model.AuditEntry, error) {
+	records, err := auditRecords(c, event)
+	if err != nil {
+		err = errors.Wrap(err, "Error finding records changed by Event")
+		return nil, err
+	}
+
+	var userUUID string
+	if c.UserUUID != (uuuid.UUID{}) {
+		userUUID = c.UserUUID.String()
+	}
+	entries := make([]*model.AuditEntry, len(records))
+	for i, record := range records {
+		changes, err := auditChanges(record.before, record.after)
+		if err != nil {
+			err = errors.Wrap(err, "Error finding changed fields")
+			return nil, err
+		}
+		auditID, err := c.IDGen.NewID()
+		if err != nil {
+			err = errors.Wrap(err, "Error generating AuditID")
+			return nil, err
+		}
+
+		entries[i] = &model.AuditEntry{
+			AuditID:       auditID.String(),
+			Action:        event.Action,
+			CommandAction: c.Cmd.Action,
+			CorrelationID: c.Cmd.UUID.String(),
+			EventUUID:     event.UUID.String(),
+			ItemID:        record.itemID,
+			ShipmentID:    record.shipmentID,
+			UserUUID:      userUUID,
+			Changes:       changes,
+			Timestamp:     event.NanoTime,
+		}
+	}
+	return entries, nil
+}
+
+// auditRecords returns the records changed by the Event.
+// Events with other actions, such as from externally registered
+// CommandFuncs, are not audited.
+func auditRecords(c *CmdConfig, event *cmodel.Event) ([]auditRecord, error) {
+	switch event.Action {
+	case model.EventItemAdded:
+		item := &model.Item{}
+		err := json.Unmarshal(event.Data, item)
+		if err != nil {
+			err = errors.Wrap(err, "Error unmarshalling ItemAdded data")
+			return nil, err
+		}
+		return []auditRecord{
+			auditRecord{
+				itemID: item.ItemID,
+				after:  item,
+			},
+		}, nil
+
+	case model.EventItemUpdated:
+		data := &model.ItemUpdatedData{}
+		err := json.Unmarshal(event.Data, data)
+		if err != nil {
+			err = errors.Wrap(err, "Error unmarshalling ItemUpdated data")
+			return nil, err
+		}
+		itemID, _ := data.Update["itemID"].(string)
+		item, findErr := findItem(c.Items, itemID)
+		if findErr != nil {
+			return nil, errors.New(findErr.Message)
+		}
+		return []auditRecord{
+			auditRecord{
+				itemID:     itemID,
+				shipmentID: item.ShipmentID,
+				before:     item,
+				after:      data.Update,
+			},
+		}, nil
+
+	case model.EventItemDeleted:
+		filter := &model.Item{}
+		err := json.Unmarshal(event.Data, filter)
+		if err != nil {
+			err = errors.Wrap(err, "Error unmarshalling ItemDeleted data")
+			return nil, err
+		}
+		// Version is the version expected by command, and not a filter-field
+		filter.Version = 0
+		matches, err := c.Items.Find(filter)
+		if err != nil {
+			err = errors.Wrap(err, "Error finding deleted Items")
+			return nil, err
+		}
+		records := []auditRecord{}
+		for _, item := range matches {
+			records = append(records, auditRecord{
+				itemID:     item.ItemID,
+				shipmentID: item.ShipmentID,
+				before:     item,
+			})
+		}
+		return records, nil
+
+	case model.EventShipmentCreated:
+		shipment := &model.Shipment{}
+		err := json.Unmarshal(event.Data, shipment)
+		if err != nil {
+			err = errors.Wrap(err, "Error unmarshalling ShipmentCreated data")
+			return nil, err
+		}
+		return []auditRecord{
+			auditRecord{
+				shipmentID: shipment.ShipmentID,
+				after:      shipment,
+			},
+		}, nil
+
+	case model.EventItemAddedToShipment, model.EventItemRemovedFromShipment:
+		return shipmentItemRecords(c, event)
+	}
+
+	if isShipmentStatusEvent(event.Action) {
+		data := &model.ShipmentStatusData{}
+		err := json.Unmarshal(event.Data, data)
+		if err != nil {
+			err = errors.Wrap(err, "Error unmarshalling ShipmentStatusData")
+			return nil, err
+		}
+		shipment, findErr := findShipment(c.Shipments, data.ShipmentID)
+		if findErr != nil {
+			return nil, errors.New(findErr.Message)
+		}
+
+		updated := *shipment
+		updated.Status = data.Status
+		updated.Version = data.Version
+		if data.ActualArrival != 0 {
+			updated.ActualArrival = data.ActualArrival
+		}
+		return []auditRecord{
+			auditRecord{
+				shipmentID: shipment.ShipmentID,
+				before:     shipment,
+				after:      &updated,
+			},
+		}, nil
+	}
+	return nil, nil
+}
+
+// shipmentItemRecords returns the Item and Shipment changed by
+// ItemAddedToShipment and ItemRemovedFromShipment Events.
+func shipmentItemRecords(c *CmdConfig, event *cmodel.Event) ([]auditRecord, error) {
+	data := &model.ShipmentItemData{}
+	err := json.Unmarshal(event.Data, data)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling ShipmentItemData")
+		return nil, err
+	}
+	item, err := c.Items.FindOne(&model.Item{
+		ItemID: data.ItemID,
+	})
+	// Deleted Items can still be removed from Shipment, in which
+	// case the Item's change is audited using only its IDs
+	if errors.Cause(err) == repository.ErrNotFound {
+		item = &model.Item{
+			ItemID: data.ItemID,
+		}
+		if event.Action == model.EventItemRemovedFromShipment {
+			item.ShipmentID = data.ShipmentID
+		}
+	} else if err != nil {
+		err = errors.Wrap(err, "Error finding Item")
+		return nil, err
+	}
+	shipment, findErr := findShipment(c.Shipments, data.ShipmentID)
+	if findErr != nil {
+		return nil, errors.New(findErr.Message)
+	}
+
+	updatedItem := *item
+	updatedShipment := *shipment
+	updatedShipment.Version = data.Version
+	updatedShipment.ItemIDs = []string{}
+	for _, itemID := range shipment.ItemIDs {
+		if itemID != data.ItemID {
+			updatedShipment.ItemIDs = append(updatedShipment.ItemIDs, itemID)
+		}
+	}
+	if event.Action == model.EventItemAddedToShipment {
+		updatedItem.ShipmentID = data.ShipmentID
+		updatedShipment.ItemIDs = append(updatedShipment.ItemIDs, data.ItemID)
+	} else {
+		updatedItem.ShipmentID = ""
+	}
+
+	return []auditRecord{
+		auditRecord{
+			itemID:     data.ItemID,
+			shipmentID: data.ShipmentID,
+			before:     item,
+			after:      &updatedItem,
+		},
+		auditRecord{
+			shipmentID: shipment.ShipmentID,
+			before:     shipment,
+			after:      &updatedShipment,
+		},
+	}, nil
+}
+
+// isShipmentStatusEvent checks if the Event-action is produced
+// by a Shipment-status command.
+func isShipmentStatusEvent(action string) bool {
+	for _, transition := range statusCommands {
+		if transition.eventAction == action {
+			return true
+		}
+	}
+	return false
+}
+
+// auditChanges returns the fields which differ between the records,
+// sorted by field-name.
+func auditChanges(before interface{}, after interface{}) ([]model.AuditChange, error) {
+	beforeMap, err := recordToMap(before)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting record before change to map")
+		return nil, err
+	}
+	afterMap, err := recordToMap(after)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting record after change to map")
+		return nil, err
+	}
+
+	fields := []string{}
+	for field := range beforeMap {
+		fields = append(fields, field)
+	}
+	for field := range afterMap {
+		if _, exists := beforeMap[field]; !exists {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []model.AuditChange{}
+	for _, field := range fields {
+		if reflect.DeepEqual(beforeMap[field], afterMap[field]) {
+			continue
+		}
+		changes = append(changes, model.AuditChange{
+			Field:  field,
+			Before: beforeMap[field],
+			After:  afterMap[field],
+		})
+	}
+	return changes, nil
+}
+
+// recordToMap converts the record to map using its JSON-form, so records
+// of different types are compared using the same field-names and types.
+func recordToMap(record interface{}) (map[string]interface{}, error) {
+	recordMap := map[string]interface{}{}
+	if record == nil {
+		return recordMap, nil
+	}
+	value := reflect.ValueOf(record)
+	if (value.Kind() == reflect.Ptr || value.Kind() == reflect.Map) && value.IsNil() {
+		return recordMap, nil
+	}
+
+	marshalRecord, err := json.Marshal(record)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling record")
+		return nil, err
+	}
+	err = json.Unmarshal(marshalRecord, &recordMap)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling record into map")
+		return nil, err
+	}
+	return recordMap, nil
+}
+
+// saveAudit inserts the AuditEntries. Entries are only ever inserted,
+// so the audit-trail cannot be altered.
+func saveAudit(audit repository.AuditRepository, entries []*model.AuditEntry) error {
+	for _, entry := range entries {
+		err := audit.Insert(entry)
+		if err != nil {
+			err = errors.Wrapf(err, "Error inserting AuditEntry with ID: %s", entry.AuditID)
+			return err
+		}
+	}
+	return nil
+}
+
+// AuditByItem returns the audit-trail of Item, oldest change first.
+func AuditByItem(audit repository.AuditRepository, itemID string) ([]*model.AuditEntry, error) {
+	if itemID == "" {
+		return nil, errors.New("itemID cannot be blank")
+	}
+	return findAudit(audit, map[string]interface{}{
+		"itemID": itemID,
+	})
+}
+
+// AuditByUser returns the changes made by Commands issued by
+// the user, oldest change first.
+func AuditByUser(audit repository.AuditRepository, userUUID string) ([]*model.AuditEntry, error) {
+	if userUUID == "" {
+		return nil, errors.New("userUUID cannot be blank")
+	}
+	return findAudit(audit, map[string]interface{}{
+		"userUUID": userUUID,
+	})
+}
+
+func findAudit(
+	audit repository.AuditRepository,
+	filter map[string]interface{},
+) ([]*model.AuditEntry, error) {
+	entries, err := audit.Find(filter)
+	if err != nil {
+		err = errors.Wrap(err, "Error finding AuditEntries")
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp < entries[j].Timestamp
+	})
+	return entries, nil
+}
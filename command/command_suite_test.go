@@ -10,10 +10,10 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/pkg/errors"
 
-	"github.com/TerrexTech/agg-shipment-cmd/connutil"
 	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	"github.com/TerrexTech/agg-shipment-cmd/validation"
 	cmodel "github.com/TerrexTech/go-common-models/model"
-	"github.com/TerrexTech/go-mongoutils/mongo"
 	"github.com/TerrexTech/uuuid"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -32,26 +32,6 @@ func TestCommand(t *testing.T) {
 
 	missingVar, err := commonutil.ValidateEnv(
 		"SERVICE_NAME",
-
-		"KAFKA_BROKERS",
-
-		"KAFKA_CONSUMER_GROUP_REQUEST",
-		"KAFKA_CONSUMER_TOPIC_REQUEST",
-
-		"KAFKA_CONSUMER_GROUP_ESRESP",
-		"KAFKA_CONSUMER_TOPIC_ESRESP",
-
-		"KAFKA_PRODUCER_TOPIC_ESREQ",
-		"KAFKA_PRODUCER_TOPIC_EVENTS",
-
-		"KAFKA_END_OF_STREAM_TOKEN",
-
-		"MONGO_HOSTS",
-		"MONGO_DATABASE",
-		"MONGO_AGG_COLLECTION",
-		"MONGO_META_COLLECTION",
-
-		"MONGO_CONNECTION_TIMEOUT_MS",
 	)
 
 	if err != nil {
@@ -63,7 +43,7 @@ func TestCommand(t *testing.T) {
 	RunSpecs(t, "CommandHandler Suite")
 }
 
-func testError(coll *mongo.Collection, action string, data []byte) {
+func testError(items repository.ItemRepository, action string, data []byte) {
 	uitemID, err := uuuid.NewV4()
 	Expect(err).ToNot(HaveOccurred())
 	cid, err := uuuid.NewV4()
@@ -81,10 +61,12 @@ func testError(coll *mongo.Collection, action string, data []byte) {
 		UUID:          uitemID,
 	}
 
-	c := &cmdConfig{
-		coll:        coll,
-		serviceName: "test-svc",
-		cmd:         mockCmd,
+	c := &CmdConfig{
+		Items:       items,
+		ServiceName: "test-svc",
+		Cmd:         mockCmd,
+		Clock:       model.SystemClock{},
+		IDGen:       model.RandomIDGenerator{},
 	}
 
 	result, event, cmdErr := addItem(c)
@@ -94,7 +76,7 @@ func testError(coll *mongo.Collection, action string, data []byte) {
 	Expect(cmdErr.Message).ToNot(BeEmpty())
 }
 
-func testValid(coll *mongo.Collection, action string, data []byte) ([]byte, *cmodel.Event) {
+func testValid(items repository.ItemRepository, action string, data []byte) ([]byte, *cmodel.Event) {
 	uitemID, err := uuuid.NewV4()
 	Expect(err).ToNot(HaveOccurred())
 	cid, err := uuuid.NewV4()
@@ -112,10 +94,12 @@ func testValid(coll *mongo.Collection, action string, data []byte) ([]byte, *cmo
 		UUID:          uitemID,
 	}
 
-	c := &cmdConfig{
-		coll:        coll,
-		serviceName: "test-svc",
-		cmd:         mockCmd,
+	c := &CmdConfig{
+		Items:       items,
+		ServiceName: "test-svc",
+		Cmd:         mockCmd,
+		Clock:       model.SystemClock{},
+		IDGen:       model.RandomIDGenerator{},
 	}
 
 	var (
@@ -134,19 +118,919 @@ func testValid(coll *mongo.Collection, action string, data []byte) ([]byte, *cmo
 
 	Expect(cmdErr).To(BeNil())
 	Expect(event.CorrelationID).To(Equal(mockCmd.UUID))
+	Expect(event.AggregateID).To(Equal(int8(model.AggregateID)))
+	Expect(event.Source).To(Equal(c.ServiceName))
+	Expect(event.YearBucket).To(Equal(int16(time.Now().UTC().Year())))
 
 	return result, event
 }
 
+func mockShipmentConfig(
+	items repository.ItemRepository,
+	shipments repository.ShipmentRepository,
+	action string,
+	data []byte,
+) *CmdConfig {
+	uuid, err := uuuid.NewV4()
+	Expect(err).ToNot(HaveOccurred())
+	cid, err := uuuid.NewV4()
+	Expect(err).ToNot(HaveOccurred())
+
+	return &CmdConfig{
+		Items:       items,
+		Shipments:   shipments,
+		ServiceName: "test-svc",
+		Cmd: &cmodel.Command{
+			Action:        action,
+			CorrelationID: cid,
+			Data:          data,
+			ResponseTopic: "test-topic",
+			Source:        "test-source",
+			SourceTopic:   "test_source-topic",
+			Timestamp:     time.Now().UTC().Unix(),
+			TTLSec:        15,
+			UUID:          uuid,
+		},
+		Clock: model.SystemClock{},
+		IDGen: model.RandomIDGenerator{},
+	}
+}
+
+// fixedClock is a Clock which always returns the same time.
+type fixedClock struct {
+	time time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.time
+}
+
+// queuedIDGenerator is an IDGenerator which returns the queued IDs in order.
+type queuedIDGenerator struct {
+	ids []uuuid.UUID
+}
+
+func (g *queuedIDGenerator) NewID() (uuuid.UUID, error) {
+	if len(g.ids) == 0 {
+		return uuuid.UUID{}, errors.New("no queued IDs")
+	}
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id, nil
+}
+
+// failingProcessedRepo is a ProcessedCommandRepository whose lookups fail.
+type failingProcessedRepo struct {
+	repository.ProcessedCommandRepository
+}
+
+func (r failingProcessedRepo) FindOne(string) (*model.ProcessedCommand, error) {
+	return nil, errors.New("lookup failed")
+}
+
 var _ = Describe("CommanHandler", func() {
 	var (
-		coll *mongo.Collection
+		items         repository.ItemRepository
+		shipments     repository.ShipmentRepository
+		processedRepo repository.ProcessedCommandRepository
+		outboxRepo    repository.OutboxRepository
+		auditRepo     repository.AuditRepository
 	)
 
-	BeforeSuite(func() {
-		mc, err := connutil.LoadMongoConfig()
-		Expect(err).ToNot(HaveOccurred())
-		coll = mc.AggCollection
+	// The Mongo-repositories are covered by the integration-tests,
+	// so Command-handlers are tested against in-memory repositories.
+	BeforeEach(func() {
+		items = repository.NewMemoryItemRepository()
+		shipments = repository.NewMemoryShipmentRepository()
+		processedRepo = repository.NewMemoryProcessedCommandRepository()
+		outboxRepo = repository.NewMemoryOutboxRepository()
+		auditRepo = repository.NewMemoryAuditRepository()
+	})
+
+	Describe("Registry", func() {
+		It("should list built-in actions", func() {
+			actions := RegisteredActions()
+			Expect(actions).To(ContainElement("AddItem"))
+			Expect(actions).To(ContainElement("AddItemFromBarcode"))
+			Expect(actions).To(ContainElement("CreateShipment"))
+			Expect(actions).To(ContainElement("DispatchShipment"))
+		})
+
+		It("should return error when registering existing action", func() {
+			err := Register("AddItem", addItem)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should process commands with registered action", func() {
+			mockResult := []byte(`{"test":"result"}`)
+			err := Register("TestRegisteredAction", func(
+				c *CmdConfig,
+			) ([]byte, *cmodel.Event, *cmodel.Error) {
+				return mockResult, &cmodel.Event{
+					CorrelationID: c.Cmd.UUID,
+				}, nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(RegisteredActions()).To(ContainElement("TestRegisteredAction"))
+
+			eventChan := make(chan *cmodel.Event, 1)
+			resultChan := make(chan *cmodel.Document, 1)
+			handler, err := NewHandler(&HandlerConfig{
+				Items:       items,
+				Shipments:   shipments,
+				Processed:   processedRepo,
+				ServiceName: "test-svc",
+				EventProd:   eventChan,
+				ResultProd:  resultChan,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "TestRegisteredAction", nil)
+			err = handler.Handle(c.Cmd)
+			Expect(err).ToNot(HaveOccurred())
+			event := <-eventChan
+			Expect(event.CorrelationID).To(Equal(c.Cmd.UUID))
+			doc := <-resultChan
+			Expect(doc.Data).To(Equal(mockResult))
+		})
+
+		It("should respond with UnknownActionError for unregistered action", func() {
+			eventChan := make(chan *cmodel.Event, 1)
+			resultChan := make(chan *cmodel.Document, 1)
+			handler, err := NewHandler(&HandlerConfig{
+				Items:       items,
+				Shipments:   shipments,
+				Processed:   processedRepo,
+				ServiceName: "test-svc",
+				EventProd:   eventChan,
+				ResultProd:  resultChan,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "TestUnknownAction", nil)
+			err = handler.Handle(c.Cmd)
+			Expect(err).ToNot(HaveOccurred())
+			doc := <-resultChan
+			Expect(doc.CorrelationID).To(Equal(c.Cmd.UUID))
+			Expect(doc.ErrorCode).To(Equal(model.UnknownActionError))
+			Expect(eventChan).To(BeEmpty())
+		})
+	})
+
+	Describe("Clock and IDGenerator", func() {
+		It("should use injected time and IDs for Event and result", func() {
+			shipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			eventID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			docID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+
+			// Last second of the year, so YearBucket must not be current year
+			now := time.Date(2017, time.December, 31, 23, 59, 59, 0, time.UTC)
+			eventChan := make(chan *cmodel.Event, 1)
+			resultChan := make(chan *cmodel.Document, 1)
+			handler, err := NewHandler(&HandlerConfig{
+				Items:       items,
+				Shipments:   shipments,
+				Processed:   processedRepo,
+				ServiceName: "test-svc",
+				EventProd:   eventChan,
+				ResultProd:  resultChan,
+				Clock:       fixedClock{now},
+				IDGen: &queuedIDGenerator{
+					ids: []uuuid.UUID{eventID, docID},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			marshalShipment, err := json.Marshal(&model.Shipment{
+				Carrier:         "test-carrier",
+				Destination:     "test-destination",
+				ExpectedArrival: now.Unix(),
+				Origin:          "test-origin",
+				ShipmentID:      shipmentID.String(),
+				Timestamp:       now.Unix(),
+				TrackingNumber:  "test-tracking",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			c := mockShipmentConfig(items, shipments, "CreateShipment", marshalShipment)
+
+			result, err := handler.Process(c.Cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Document.Error).To(BeEmpty())
+			Expect(result.Document.UUID).To(Equal(docID))
+			Expect(result.Event.UUID).To(Equal(eventID))
+			Expect(result.Event.NanoTime).To(Equal(now.UnixNano()))
+			Expect(result.Event.YearBucket).To(Equal(int16(2017)))
+		})
+	})
+
+	Describe("Audit", func() {
+		var (
+			handler    *Handler
+			eventChan  chan *cmodel.Event
+			resultChan chan *cmodel.Document
+			userUUID   uuuid.UUID
+		)
+
+		BeforeEach(func() {
+			var err error
+			userUUID, err = uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+
+			eventChan = make(chan *cmodel.Event, 1)
+			resultChan = make(chan *cmodel.Document, 1)
+			handler, err = NewHandler(&HandlerConfig{
+				Items:       items,
+				Shipments:   shipments,
+				Processed:   processedRepo,
+				Audit:       auditRepo,
+				ServiceName: "test-svc",
+				EventProd:   eventChan,
+				ResultProd:  resultChan,
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should set issuing user on Event", func() {
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			err = items.Insert(&model.Item{
+				ItemID: itemID.String(),
+				Lot:    itemID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			data, err := json.Marshal(map[string]interface{}{
+				"itemID":   itemID.String(),
+				"userUUID": userUUID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			c := mockShipmentConfig(items, shipments, "DeleteItem", data)
+
+			err = handler.Handle(c.Cmd)
+			Expect(err).ToNot(HaveOccurred())
+			event := <-eventChan
+			Expect(event.UserUUID).To(Equal(userUUID))
+			<-resultChan
+		})
+
+		It("should set issuing user on Shipment Events", func() {
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			err = items.Insert(&model.Item{
+				ItemID: itemID.String(),
+				Lot:    itemID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			shipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			err = shipments.Insert(&model.Shipment{
+				ShipmentID: shipmentID.String(),
+				Carrier:    "test-carrier",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			data, err := json.Marshal(map[string]interface{}{
+				"shipmentID": shipmentID.String(),
+				"itemID":     itemID.String(),
+				"userUUID":   userUUID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			c := mockShipmentConfig(items, shipments, "AddItemToShipment", data)
+
+			err = handler.Handle(c.Cmd)
+			Expect(err).ToNot(HaveOccurred())
+			event := <-eventChan
+			Expect(event.Action).To(Equal(model.EventItemAddedToShipment))
+			Expect(event.UserUUID).To(Equal(userUUID))
+			<-resultChan
+		})
+
+		It("should respond with UserError for invalid UserUUID", func() {
+			data := []byte(`{"itemID":"test-item","userUUID":"invalid"}`)
+			c := mockShipmentConfig(items, shipments, "DeleteItem", data)
+
+			err := handler.Handle(c.Cmd)
+			Expect(err).ToNot(HaveOccurred())
+			doc := <-resultChan
+			Expect(doc.ErrorCode).To(Equal(int16(cmodel.UserError)))
+			Expect(eventChan).To(BeEmpty())
+		})
+
+		It("should store changes queryable by Item and user", func() {
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			err = items.Insert(&model.Item{
+				ItemID:  itemID.String(),
+				Lot:     itemID.String(),
+				Price:   10,
+				Version: 1,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			data, err := json.Marshal(map[string]interface{}{
+				"filter": map[string]interface{}{
+					"itemID": itemID.String(),
+				},
+				"update": map[string]interface{}{
+					"price": 12.5,
+				},
+				"userUUID": userUUID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			c := mockShipmentConfig(items, shipments, "UpdateItem", data)
+
+			err = handler.Handle(c.Cmd)
+			Expect(err).ToNot(HaveOccurred())
+			event := <-eventChan
+			<-resultChan
+
+			entries, err := AuditByItem(auditRepo, itemID.String())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			entry := entries[0]
+			Expect(entry.Action).To(Equal(model.EventItemUpdated))
+			Expect(entry.CorrelationID).To(Equal(c.Cmd.UUID.String()))
+			Expect(entry.EventUUID).To(Equal(event.UUID.String()))
+			Expect(entry.UserUUID).To(Equal(userUUID.String()))
+			Expect(entry.Changes).To(ContainElement(model.AuditChange{
+				Field:  "price",
+				Before: float64(10),
+				After:  12.5,
+			}))
+
+			entries, err = AuditByUser(auditRepo, userUUID.String())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].ItemID).To(Equal(itemID.String()))
+		})
+
+		It("should audit removing deleted Item from Shipment", func() {
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			shipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			err = shipments.Insert(&model.Shipment{
+				ShipmentID: shipmentID.String(),
+				Carrier:    "test-carrier",
+				ItemIDs:    []string{itemID.String()},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			data, err := json.Marshal(map[string]interface{}{
+				"shipmentID": shipmentID.String(),
+				"itemID":     itemID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			c := mockShipmentConfig(items, shipments, "RemoveItemFromShipment", data)
+
+			result, err := handler.Process(c.Cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Event).ToNot(BeNil())
+			Expect(result.Audit).To(HaveLen(2))
+
+			itemEntry := result.Audit[0]
+			Expect(itemEntry.ItemID).To(Equal(itemID.String()))
+			Expect(itemEntry.ShipmentID).To(Equal(shipmentID.String()))
+			Expect(itemEntry.Changes).To(Equal([]model.AuditChange{
+				{Field: "shipmentID", Before: shipmentID.String()},
+			}))
+			Expect(result.Audit[1].ShipmentID).To(Equal(shipmentID.String()))
+			Expect(result.Audit[1].ItemID).To(BeEmpty())
+		})
+	})
+
+	Describe("Middleware", func() {
+		var c *CmdConfig
+
+		BeforeEach(func() {
+			c = mockShipmentConfig(items, shipments, "TestMiddleware", nil)
+		})
+
+		It("should run middlewares with first as outermost", func() {
+			calls := []string{}
+			mockMiddleware := func(name string) Middleware {
+				return func(next CommandFunc) CommandFunc {
+					return func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+						calls = append(calls, name)
+						return next(c)
+					}
+				}
+			}
+			cmdFunc := Chain(mockMiddleware("first"), mockMiddleware("second"))(
+				func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+					calls = append(calls, "cmd")
+					return nil, nil, nil
+				},
+			)
+			cmdFunc(c)
+			Expect(calls).To(Equal([]string{"first", "second", "cmd"}))
+		})
+
+		It("should respond with InternalError on panic", func() {
+			cmdFunc := RecoveryMiddleware()(
+				func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+					panic("test-panic")
+				},
+			)
+			result, event, cmdErr := cmdFunc(c)
+			Expect(result).To(BeNil())
+			Expect(event).To(BeNil())
+			Expect(cmdErr.Code).To(Equal(int16(cmodel.InternalError)))
+			Expect(cmdErr.Message).To(ContainSubstring("test-panic"))
+		})
+
+		It("should respond with TimeoutError on timeout", func() {
+			cmdFunc := TimeoutMiddleware(10 * time.Millisecond)(
+				func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+					<-c.Ctx.Done()
+					return nil, nil, nil
+				},
+			)
+			_, _, cmdErr := cmdFunc(c)
+			Expect(cmdErr.Code).To(Equal(model.TimeoutError))
+		})
+
+		It("should recover from panic within TimeoutMiddleware", func() {
+			cmdFunc := Chain(RecoveryMiddleware(), TimeoutMiddleware(time.Second))(
+				func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+					panic("test-panic")
+				},
+			)
+			_, _, cmdErr := cmdFunc(c)
+			Expect(cmdErr.Code).To(Equal(int16(cmodel.InternalError)))
+		})
+
+		It("should not record timed-out Commands as processed", func() {
+			err := Register("TestTimeout", func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+				<-c.Ctx.Done()
+				return nil, nil, nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			resultChan := make(chan *cmodel.Document, 1)
+			handler, err := NewHandler(&HandlerConfig{
+				Items:       items,
+				Shipments:   shipments,
+				Processed:   processedRepo,
+				ServiceName: "test-svc",
+				EventProd:   make(chan *cmodel.Event, 1),
+				ResultProd:  resultChan,
+				Middlewares: []Middleware{TimeoutMiddleware(10 * time.Millisecond)},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c.Cmd.Action = "TestTimeout"
+			err = handler.Handle(c.Cmd)
+			Expect(err).ToNot(HaveOccurred())
+			doc := <-resultChan
+			Expect(doc.ErrorCode).To(Equal(model.TimeoutError))
+
+			_, err = processedRepo.FindOne(c.Cmd.UUID.String())
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should respond with UnauthorizedError if not authorized", func() {
+			cmdFunc := AuthMiddleware(func(cmd *cmodel.Command) error {
+				return errors.New("test-unauthorized")
+			})(
+				func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+					Fail("command should not be processed")
+					return nil, nil, nil
+				},
+			)
+			_, _, cmdErr := cmdFunc(c)
+			Expect(cmdErr.Code).To(Equal(model.UnauthorizedError))
+		})
+
+		It("should record metrics by action", func() {
+			metrics := NewCmdMetrics()
+			cmdFunc := MetricsMiddleware(metrics)(
+				func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+					return nil, nil, cmodel.NewError(cmodel.UserError, "test-error")
+				},
+			)
+			cmdFunc(c)
+			cmdFunc(c)
+			stats := metrics.Stats()["TestMiddleware"]
+			Expect(stats.Count).To(Equal(int64(2)))
+			Expect(stats.Errors).To(Equal(int64(2)))
+		})
+	})
+
+	Describe("Outbox", func() {
+		It("should write Event and result to outbox instead of producers", func() {
+			eventChan := make(chan *cmodel.Event, 1)
+			resultChan := make(chan *cmodel.Document, 1)
+			handler, err := NewHandler(&HandlerConfig{
+				Items:       items,
+				Shipments:   shipments,
+				Processed:   processedRepo,
+				Outbox:      outboxRepo,
+				ServiceName: "test-svc",
+				EventProd:   eventChan,
+				ResultProd:  resultChan,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			shipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			marshalShipment, err := json.Marshal(model.Shipment{
+				ShipmentID:      shipmentID.String(),
+				Carrier:         "test-carrier",
+				Destination:     "test-destination",
+				ExpectedArrival: time.Now().UTC().Unix(),
+				Origin:          "test-origin",
+				Timestamp:       time.Now().UTC().Unix(),
+				TrackingNumber:  "test-tracking",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "CreateShipment", marshalShipment)
+			err = handler.Handle(c.Cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(eventChan).To(BeEmpty())
+			Expect(resultChan).To(BeEmpty())
+
+			entry, err := outboxRepo.FindOne(c.Cmd.UUID.String())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entry.Sent).To(BeFalse())
+			Expect(entry.Event).ToNot(BeEmpty())
+			Expect(entry.ResultTopic).To(Equal(c.Cmd.ResponseTopic))
+
+			event := &cmodel.Event{}
+			err = json.Unmarshal(entry.Event, event)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(event.Action).To(Equal(model.EventShipmentCreated))
+		})
+
+		It("should not write same Command to outbox twice", func() {
+			c := mockShipmentConfig(items, shipments, "TestOutbox", nil)
+			doc := &cmodel.Document{
+				CorrelationID: c.Cmd.UUID,
+				Topic:         c.Cmd.ResponseTopic,
+			}
+			err := saveOutbox(outboxRepo, c.Cmd, nil, doc, time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			err = saveOutbox(outboxRepo, c.Cmd, nil, doc, time.Now())
+			Expect(err).To(Equal(errOutboxEntryExists))
+		})
+	})
+
+	Describe("ProcessedCommand", func() {
+		It("should return nil Document if Command was not processed", func() {
+			c := mockShipmentConfig(items, shipments, "AddItem", nil)
+			doc, err := findProcessed(processedRepo, c.Cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc).To(BeNil())
+		})
+
+		It("should return original Document if Command was processed", func() {
+			c := mockShipmentConfig(items, shipments, "AddItem", nil)
+			docID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			mockDoc := &cmodel.Document{
+				CorrelationID: c.Cmd.UUID,
+				Data:          []byte(`{"itemID":"test-item"}`),
+				Source:        "test-svc",
+				Topic:         c.Cmd.ResponseTopic,
+				UUID:          docID,
+			}
+
+			err = saveProcessed(processedRepo, c.Cmd, mockDoc, time.Now())
+			Expect(err).ToNot(HaveOccurred())
+
+			doc, err := findProcessed(processedRepo, c.Cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc).To(Equal(mockDoc))
+		})
+
+		It("should return error if Command could not be looked up", func() {
+			c := mockShipmentConfig(items, shipments, "AddItem", nil)
+			doc, err := findProcessed(failingProcessedRepo{}, c.Cmd)
+			Expect(err).To(HaveOccurred())
+			Expect(doc).To(BeNil())
+		})
+
+		It("should not process Command if it could not be looked up", func() {
+			eventChan := make(chan *cmodel.Event, 1)
+			resultChan := make(chan *cmodel.Document, 1)
+			handler, err := NewHandler(&HandlerConfig{
+				Items:       items,
+				Shipments:   shipments,
+				Processed:   failingProcessedRepo{},
+				ServiceName: "test-svc",
+				EventProd:   eventChan,
+				ResultProd:  resultChan,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "TestUnknownAction", nil)
+			err = handler.Handle(c.Cmd)
+			Expect(err).To(HaveOccurred())
+			Expect(eventChan).To(BeEmpty())
+			Expect(resultChan).To(BeEmpty())
+		})
+	})
+
+	Describe("CreateShipment", func() {
+		var shipment *model.Shipment
+
+		BeforeEach(func() {
+			shipment = &model.Shipment{
+				Carrier:         "test-carrier",
+				Destination:     "test-destination",
+				ExpectedArrival: time.Now().UTC().Unix(),
+				Origin:          "test-origin",
+				Timestamp:       time.Now().UTC().Unix(),
+				TrackingNumber:  "test-tracking",
+			}
+		})
+
+		It("should return error if Carrier is missing", func() {
+			shipment.Carrier = ""
+			marshalShipment, err := json.Marshal(shipment)
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "CreateShipment", marshalShipment)
+			result, event, cmdErr := createShipment(c)
+			Expect(result).To(BeNil())
+			Expect(event).To(BeNil())
+			Expect(cmdErr.Code).To(Equal(int16(cmodel.UserError)))
+		})
+
+		It("should return error if items are provided", func() {
+			shipment.ItemIDs = []string{"test-item"}
+			marshalShipment, err := json.Marshal(shipment)
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "CreateShipment", marshalShipment)
+			_, _, cmdErr := createShipment(c)
+			Expect(cmdErr).ToNot(BeNil())
+		})
+
+		It("should return ShipmentCreated event on valid params", func() {
+			marshalShipment, err := json.Marshal(shipment)
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "CreateShipment", marshalShipment)
+			result, event, cmdErr := createShipment(c)
+			Expect(cmdErr).To(BeNil())
+			Expect(event.Action).To(Equal(model.EventShipmentCreated))
+			Expect(event.CorrelationID).To(Equal(c.Cmd.UUID))
+
+			createdShipment := &model.Shipment{}
+			err = json.Unmarshal(result, createdShipment)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdShipment.ShipmentID).ToNot(BeEmpty())
+			Expect(createdShipment.Carrier).To(Equal(shipment.Carrier))
+		})
+	})
+
+	Describe("AddItemToShipment", func() {
+		var (
+			itemID     string
+			shipmentID string
+		)
+
+		BeforeEach(func() {
+			uitemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			itemID = uitemID.String()
+			err = items.Insert(&model.Item{
+				ItemID: itemID,
+				Lot:    itemID,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			ushipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			shipmentID = ushipmentID.String()
+			err = shipments.Insert(&model.Shipment{
+				ShipmentID: shipmentID,
+				Carrier:    "test-carrier",
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should return error if shipment is not found", func() {
+			ushipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			params, err := json.Marshal(shipmentItemParams{
+				ShipmentID: ushipmentID.String(),
+				ItemID:     itemID,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "AddItemToShipment", params)
+			_, _, cmdErr := addItemToShipment(c)
+			Expect(cmdErr).ToNot(BeNil())
+		})
+
+		It("should return error if item is not found", func() {
+			uitemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			params, err := json.Marshal(shipmentItemParams{
+				ShipmentID: shipmentID,
+				ItemID:     uitemID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "AddItemToShipment", params)
+			_, _, cmdErr := addItemToShipment(c)
+			Expect(cmdErr).ToNot(BeNil())
+		})
+
+		It("should return ItemAddedToShipment event on valid params", func() {
+			params, err := json.Marshal(shipmentItemParams{
+				ShipmentID: shipmentID,
+				ItemID:     itemID,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "AddItemToShipment", params)
+			result, event, cmdErr := addItemToShipment(c)
+			Expect(cmdErr).To(BeNil())
+			Expect(event.Action).To(Equal(model.EventItemAddedToShipment))
+
+			eventData := &model.ShipmentItemData{}
+			err = json.Unmarshal(result, eventData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(eventData.ShipmentID).To(Equal(shipmentID))
+			Expect(eventData.ItemID).To(Equal(itemID))
+			Expect(eventData.Version).To(Equal(event.Version))
+			Expect(eventData.ItemVersion).To(Equal(int64(1)))
+		})
+
+		It("should return error if ItemVersion does not match", func() {
+			params, err := json.Marshal(shipmentItemParams{
+				ShipmentID:  shipmentID,
+				ItemID:      itemID,
+				ItemVersion: 3,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "AddItemToShipment", params)
+			_, _, cmdErr := addItemToShipment(c)
+			Expect(cmdErr).ToNot(BeNil())
+		})
+	})
+
+	Describe("RemoveItemFromShipment", func() {
+		It("should return error if item does not belong to shipment", func() {
+			ushipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			err = shipments.Insert(&model.Shipment{
+				ShipmentID: ushipmentID.String(),
+				Carrier:    "test-carrier",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			params, err := json.Marshal(shipmentItemParams{
+				ShipmentID: ushipmentID.String(),
+				ItemID:     "test-item",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "RemoveItemFromShipment", params)
+			_, _, cmdErr := removeItemFromShipment(c)
+			Expect(cmdErr).ToNot(BeNil())
+		})
+
+		It("should return ItemRemovedFromShipment event on valid params", func() {
+			ushipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			uitemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			err = shipments.Insert(&model.Shipment{
+				ShipmentID: ushipmentID.String(),
+				Carrier:    "test-carrier",
+				ItemIDs:    []string{uitemID.String()},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			params, err := json.Marshal(shipmentItemParams{
+				ShipmentID: ushipmentID.String(),
+				ItemID:     uitemID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "RemoveItemFromShipment", params)
+			_, event, cmdErr := removeItemFromShipment(c)
+			Expect(cmdErr).To(BeNil())
+			Expect(event.Action).To(Equal(model.EventItemRemovedFromShipment))
+		})
+
+		It("should bump the Item version if the Item exists", func() {
+			ushipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			uitemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			err = shipments.Insert(&model.Shipment{
+				ShipmentID: ushipmentID.String(),
+				Carrier:    "test-carrier",
+				ItemIDs:    []string{uitemID.String()},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = items.Insert(&model.Item{
+				ItemID:     uitemID.String(),
+				Lot:        uitemID.String(),
+				ShipmentID: ushipmentID.String(),
+				Version:    2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			params, err := json.Marshal(shipmentItemParams{
+				ShipmentID:  ushipmentID.String(),
+				ItemID:      uitemID.String(),
+				ItemVersion: 2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "RemoveItemFromShipment", params)
+			result, _, cmdErr := removeItemFromShipment(c)
+			Expect(cmdErr).To(BeNil())
+
+			eventData := &model.ShipmentItemData{}
+			err = json.Unmarshal(result, eventData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(eventData.ItemVersion).To(Equal(int64(3)))
+		})
+	})
+
+	Describe("UpdateShipmentStatus", func() {
+		var shipmentID string
+
+		BeforeEach(func() {
+			ushipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			shipmentID = ushipmentID.String()
+			err = shipments.Insert(&model.Shipment{
+				ShipmentID: shipmentID,
+				Carrier:    "test-carrier",
+				Status:     model.ShipmentPlanned,
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should return error on illegal transition", func() {
+			params, err := json.Marshal(shipmentStatusParams{
+				ShipmentID: shipmentID,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "CloseShipment", params)
+			result, event, cmdErr := updateShipmentStatus(c)
+			Expect(result).To(BeNil())
+			Expect(event).To(BeNil())
+			Expect(cmdErr.Code).To(Equal(int16(cmodel.UserError)))
+			Expect(cmdErr.Message).To(ContainSubstring(model.ShipmentPlanned))
+			Expect(cmdErr.Message).To(ContainSubstring(model.ShipmentClosed))
+		})
+
+		It("should return ShipmentDispatched event on valid transition", func() {
+			params, err := json.Marshal(shipmentStatusParams{
+				ShipmentID: shipmentID,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, shipments, "DispatchShipment", params)
+			result, event, cmdErr := updateShipmentStatus(c)
+			Expect(cmdErr).To(BeNil())
+			Expect(event.Action).To(Equal(model.EventShipmentDispatched))
+
+			eventData := &model.ShipmentStatusData{}
+			err = json.Unmarshal(result, eventData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(eventData.Status).To(Equal(model.ShipmentInTransit))
+		})
+
+		It("should only allow transitions defined by lifecycle", func() {
+			Expect(model.CanTransitionShipment(
+				model.ShipmentPlanned, model.ShipmentInTransit,
+			)).To(BeTrue())
+			Expect(model.CanTransitionShipment(
+				model.ShipmentInTransit, model.ShipmentArrived,
+			)).To(BeTrue())
+			Expect(model.CanTransitionShipment(
+				model.ShipmentArrived, model.ShipmentInspected,
+			)).To(BeTrue())
+			Expect(model.CanTransitionShipment(
+				model.ShipmentInspected, model.ShipmentReceived,
+			)).To(BeTrue())
+			Expect(model.CanTransitionShipment(
+				model.ShipmentReceived, model.ShipmentClosed,
+			)).To(BeTrue())
+
+			Expect(model.CanTransitionShipment(
+				model.ShipmentPlanned, model.ShipmentArrived,
+			)).To(BeFalse())
+			Expect(model.CanTransitionShipment(
+				model.ShipmentClosed, model.ShipmentPlanned,
+			)).To(BeFalse())
+			Expect(model.IsShipmentFinal(model.ShipmentCancelled)).To(BeTrue())
+		})
 	})
 
 	Describe("DeleteItem", func() {
@@ -160,7 +1044,17 @@ var _ = Describe("CommanHandler", func() {
 			marshalItem, err := json.Marshal(item)
 			Expect(err).ToNot(HaveOccurred())
 
-			testError(coll, "DeleteItem", marshalItem)
+			testError(items, "DeleteItem", marshalItem)
+		})
+
+		It("should return error if filter is empty", func() {
+			c := mockShipmentConfig(
+				items, shipments, "DeleteItem", []byte(`{"userUUID":"test-user"}`),
+			)
+			result, event, cmdErr := deleteItem(c)
+			Expect(result).To(BeNil())
+			Expect(event).To(BeNil())
+			Expect(cmdErr.Code).To(Equal(int16(cmodel.UserError)))
 		})
 
 		It("should return ItemDeleted event", func() {
@@ -170,13 +1064,13 @@ var _ = Describe("CommanHandler", func() {
 				ItemID: itemID.String(),
 				Lot:    itemID.String(),
 			}
-			_, err = coll.InsertOne(mockItem)
+			err = items.Insert(&mockItem)
 			Expect(err).ToNot(HaveOccurred())
 
 			marshalItem, err := json.Marshal(mockItem)
 			Expect(err).ToNot(HaveOccurred())
 
-			result, event := testValid(coll, "DeleteItem", marshalItem)
+			result, event := testValid(items, "DeleteItem", marshalItem)
 
 			delResult := &deleteResult{}
 
@@ -209,7 +1103,7 @@ var _ = Describe("CommanHandler", func() {
 					SKU:          "test-sku",
 					Timestamp:    time.Now().UTC().Unix(),
 					TotalWeight:       4.7,
-					UPC:          "test-upc",
+					UPC:          "00036000291452",
 				}
 			})
 
@@ -218,7 +1112,7 @@ var _ = Describe("CommanHandler", func() {
 				marshalItem, err := json.Marshal(item)
 				Expect(err).ToNot(HaveOccurred())
 
-				result, event := testValid(coll, "AddItem", marshalItem)
+				result, event := testValid(items, "AddItem", marshalItem)
 
 				item := &model.Item{}
 				err = json.Unmarshal(result, item)
@@ -235,105 +1129,153 @@ var _ = Describe("CommanHandler", func() {
 				item.DateArrived = 0
 				marshalItem, err := json.Marshal(item)
 				Expect(err).ToNot(HaveOccurred())
-				testError(coll, "AddItem", marshalItem)
+				testError(items, "AddItem", marshalItem)
 			})
 
 			It("should return error if Lot is missing", func() {
 				item.Lot = ""
 				marshalItem, err := json.Marshal(item)
 				Expect(err).ToNot(HaveOccurred())
-				testError(coll, "AddItem", marshalItem)
+				testError(items, "AddItem", marshalItem)
 			})
 
 			It("should return error if Name is missing", func() {
 				item.Name = ""
 				marshalItem, err := json.Marshal(item)
 				Expect(err).ToNot(HaveOccurred())
-				testError(coll, "AddItem", marshalItem)
+				testError(items, "AddItem", marshalItem)
 			})
 
 			It("should return error if Origin is missing", func() {
 				item.Origin = ""
 				marshalItem, err := json.Marshal(item)
 				Expect(err).ToNot(HaveOccurred())
-				testError(coll, "AddItem", marshalItem)
+				testError(items, "AddItem", marshalItem)
 			})
 
 			It("should return error if Price is missing", func() {
 				item.Price = 0
 				marshalItem, err := json.Marshal(item)
 				Expect(err).ToNot(HaveOccurred())
-				testError(coll, "AddItem", marshalItem)
+				testError(items, "AddItem", marshalItem)
 			})
 
 			It("should return error if RSCustomerID is missing", func() {
 				item.RSCustomerID = ""
 				marshalItem, err := json.Marshal(item)
 				Expect(err).ToNot(HaveOccurred())
-				testError(coll, "AddItem", marshalItem)
+				testError(items, "AddItem", marshalItem)
 			})
 
 			It("should return error if SKU is missing", func() {
 				item.SKU = ""
 				marshalItem, err := json.Marshal(item)
 				Expect(err).ToNot(HaveOccurred())
-				testError(coll, "AddItem", marshalItem)
+				testError(items, "AddItem", marshalItem)
 			})
 
 			It("should return error if Timestamp is missing", func() {
 				item.Timestamp = 0
 				marshalItem, err := json.Marshal(item)
 				Expect(err).ToNot(HaveOccurred())
-				testError(coll, "AddItem", marshalItem)
+				testError(items, "AddItem", marshalItem)
 			})
 
 			It("should return error if TotalWeight is missing", func() {
 				item.TotalWeight = 0
 				marshalItem, err := json.Marshal(item)
 				Expect(err).ToNot(HaveOccurred())
-				testError(coll, "AddItem", marshalItem)
+				testError(items, "AddItem", marshalItem)
 			})
 
 			It("should return error if UPC is missing", func() {
 				item.UPC = ""
 				marshalItem, err := json.Marshal(item)
 				Expect(err).ToNot(HaveOccurred())
-				testError(coll, "AddItem", marshalItem)
+				testError(items, "AddItem", marshalItem)
+			})
+
+			It("should return ValidationError with all invalid fields", func() {
+				item.Name = ""
+				item.Price = -2
+				item.ShipmentID = "test-shipment"
+				marshalItem, err := json.Marshal(item)
+				Expect(err).ToNot(HaveOccurred())
+
+				c := mockShipmentConfig(items, nil, "AddItem", marshalItem)
+				result, event, cmdErr := addItem(c)
+				Expect(result).To(BeNil())
+				Expect(event).To(BeNil())
+				Expect(cmdErr.Code).To(Equal(model.ValidationError))
+
+				fieldErrs := validation.Errors{}
+				err = json.Unmarshal([]byte(cmdErr.Message), &fieldErrs)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fieldErrs).To(HaveLen(3))
+				Expect(fieldErrs[0].Field).To(Equal("name"))
+				Expect(fieldErrs[0].Rule).To(Equal(validation.RuleRequired))
+				Expect(fieldErrs[1].Field).To(Equal("price"))
+				Expect(fieldErrs[1].Rule).To(Equal(validation.RuleMin))
+				Expect(fieldErrs[2].Field).To(Equal("shipmentID"))
+				Expect(fieldErrs[2].Rule).To(Equal(validation.RuleReadOnly))
+			})
+
+			It("should normalize UPC to GTIN-14", func() {
+				item.UPC = "036000291452"
+				marshalItem, err := json.Marshal(item)
+				Expect(err).ToNot(HaveOccurred())
+
+				result, _ := testValid(items, "AddItem", marshalItem)
+				regItem := &model.Item{}
+				err = json.Unmarshal(result, regItem)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(regItem.UPC).To(Equal("00036000291452"))
+			})
+
+			It("should return ValidationError if UPC has invalid check digit", func() {
+				item.UPC = "036000291453"
+				marshalItem, err := json.Marshal(item)
+				Expect(err).ToNot(HaveOccurred())
+
+				c := mockShipmentConfig(items, nil, "AddItem", marshalItem)
+				_, _, cmdErr := addItem(c)
+				Expect(cmdErr.Code).To(Equal(model.ValidationError))
+				Expect(cmdErr.Message).To(ContainSubstring("must be a valid GTIN"))
 			})
 
 			// 	It("should return error if Email is blank", func() {
 			// 		item.Email = ""
 			// 		marshalItem, err := json.Marshal(item)
 			// 		Expect(err).ToNot(HaveOccurred())
-			// 		testError(coll, "AddItem", marshalItem)
+			// 		testError(items, "AddItem", marshalItem)
 			// 	})
 
 			// 	It("should return error if FirstName is blank", func() {
 			// 		item.FirstName = ""
 			// 		marshalItem, err := json.Marshal(item)
 			// 		Expect(err).ToNot(HaveOccurred())
-			// 		testError(coll, "AddItem", marshalItem)
+			// 		testError(items, "AddItem", marshalItem)
 			// 	})
 
 			// 	It("should return error if Lot is blank", func() {
 			// 		item.Lot = ""
 			// 		marshalItem, err := json.Marshal(item)
 			// 		Expect(err).ToNot(HaveOccurred())
-			// 		testError(coll, "AddItem", marshalItem)
+			// 		testError(items, "AddItem", marshalItem)
 			// 	})
 
 			// 	It("should return error if Password is blank", func() {
 			// 		item.Password = ""
 			// 		marshalItem, err := json.Marshal(item)
 			// 		Expect(err).ToNot(HaveOccurred())
-			// 		testError(coll, "AddItem", marshalItem)
+			// 		testError(items, "AddItem", marshalItem)
 			// 	})
 
 			// 	It("should return error if Role is blank", func() {
 			// 		item.Role = ""
 			// 		marshalItem, err := json.Marshal(item)
 			// 		Expect(err).ToNot(HaveOccurred())
-			// 		testError(coll, "AddItem", marshalItem)
+			// 		testError(items, "AddItem", marshalItem)
 			// 	})
 		})
 
@@ -344,13 +1286,13 @@ var _ = Describe("CommanHandler", func() {
 				ItemID: itemID.String(),
 				Lot:    itemID.String(),
 			}
-			_, err = coll.InsertOne(mockItem)
+			err = items.Insert(&mockItem)
 			Expect(err).ToNot(HaveOccurred())
 
 			marshalItem, err := json.Marshal(mockItem)
 			Expect(err).ToNot(HaveOccurred())
 
-			testError(coll, "AddItem", marshalItem)
+			testError(items, "AddItem", marshalItem)
 		})
 
 		It("should return ItemAdded event on valid params", func() {
@@ -369,12 +1311,15 @@ var _ = Describe("CommanHandler", func() {
 				SKU:          "test-sku",
 				Timestamp:    time.Now().UTC().Unix(),
 				TotalWeight:       4.7,
-				UPC:          "test-upc",
+				UPC:          "00036000291452",
 			}
 			marshalItem, err := json.Marshal(item)
 			Expect(err).ToNot(HaveOccurred())
 
-			result, event := testValid(coll, "AddItem", marshalItem)
+			result, event := testValid(items, "AddItem", marshalItem)
+			Expect(event.Version).To(Equal(int64(1)))
+			// New items always start at version 1
+			item.Version = 1
 
 			regItem := &model.Item{}
 			err = json.Unmarshal(result, regItem)
@@ -388,6 +1333,68 @@ var _ = Describe("CommanHandler", func() {
 		})
 	})
 
+	Describe("AddItemFromBarcode", func() {
+		var params map[string]interface{}
+
+		BeforeEach(func() {
+			custID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			params = map[string]interface{}{
+				"barcode":      "(01)10036000291459(10)LOT-42(13)180915(3102)001250",
+				"name":         "test-name",
+				"origin":       "test-origin",
+				"price":        12.3,
+				"rsCustomerID": custID.String(),
+				"sku":          "test-sku",
+				"timestamp":    time.Now().UTC().Unix(),
+			}
+		})
+
+		It("should set UPC, Lot, DateArrived and TotalWeight from Barcode", func() {
+			data, err := json.Marshal(params)
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, nil, "AddItemFromBarcode", data)
+			result, event, cmdErr := addItemFromBarcode(c)
+			Expect(cmdErr).To(BeNil())
+			Expect(event.Action).To(Equal(model.EventItemAdded))
+
+			item := &model.Item{}
+			err = json.Unmarshal(result, item)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(item.ItemID).ToNot(BeEmpty())
+			Expect(item.UPC).To(Equal("10036000291459"))
+			Expect(item.Lot).To(Equal("LOT-42"))
+			Expect(item.DateArrived).To(
+				Equal(time.Date(2018, 9, 15, 0, 0, 0, 0, time.UTC).Unix()),
+			)
+			Expect(item.TotalWeight).To(Equal(12.5))
+			Expect(item.Version).To(Equal(int64(1)))
+		})
+
+		It("should return error if Item-fields do not match Barcode", func() {
+			params["lot"] = "other-lot"
+			data, err := json.Marshal(params)
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, nil, "AddItemFromBarcode", data)
+			result, event, cmdErr := addItemFromBarcode(c)
+			Expect(result).To(BeNil())
+			Expect(event).To(BeNil())
+			Expect(cmdErr.Code).To(Equal(int16(cmodel.UserError)))
+		})
+
+		It("should return error if Barcode is invalid", func() {
+			params["barcode"] = "(01)10036000291458"
+			data, err := json.Marshal(params)
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, nil, "AddItemFromBarcode", data)
+			_, _, cmdErr := addItemFromBarcode(c)
+			Expect(cmdErr.Code).To(Equal(int16(cmodel.UserError)))
+		})
+	})
+
 	Describe("Update", func() {
 		It("should return error if Filter is nil", func() {
 			params, err := json.Marshal(updateParams{
@@ -397,7 +1404,7 @@ var _ = Describe("CommanHandler", func() {
 			})
 			Expect(err).ToNot(HaveOccurred())
 
-			testError(coll, "UpdateItem", params)
+			testError(items, "UpdateItem", params)
 		})
 
 		It("should return error if Update is nil", func() {
@@ -408,7 +1415,7 @@ var _ = Describe("CommanHandler", func() {
 			})
 			Expect(err).ToNot(HaveOccurred())
 
-			testError(coll, "UpdateItem", params)
+			testError(items, "UpdateItem", params)
 		})
 
 		It("should return error if ItemID is attempted to be changed", func() {
@@ -418,7 +1425,7 @@ var _ = Describe("CommanHandler", func() {
 				ItemID: itemID.String(),
 				Lot:    itemID.String(),
 			}
-			_, err = coll.InsertOne(mockItem)
+			err = items.Insert(&mockItem)
 			Expect(err).ToNot(HaveOccurred())
 
 			params, err := json.Marshal(updateParams{
@@ -431,7 +1438,7 @@ var _ = Describe("CommanHandler", func() {
 			})
 			Expect(err).ToNot(HaveOccurred())
 
-			testError(coll, "UpdateItem", params)
+			testError(items, "UpdateItem", params)
 		})
 
 		It("should return error if Lot is attempted to be changed", func() {
@@ -441,7 +1448,7 @@ var _ = Describe("CommanHandler", func() {
 				ItemID: itemID.String(),
 				Lot:    itemID.String(),
 			}
-			_, err = coll.InsertOne(mockItem)
+			err = items.Insert(&mockItem)
 			Expect(err).ToNot(HaveOccurred())
 
 			params, err := json.Marshal(updateParams{
@@ -454,7 +1461,7 @@ var _ = Describe("CommanHandler", func() {
 			})
 			Expect(err).ToNot(HaveOccurred())
 
-			testError(coll, "UpdateItem", params)
+			testError(items, "UpdateItem", params)
 		})
 
 		It("should return error if Filter returns no items", func() {
@@ -471,7 +1478,133 @@ var _ = Describe("CommanHandler", func() {
 			})
 			Expect(err).ToNot(HaveOccurred())
 
-			testError(coll, "UpdateItem", params)
+			testError(items, "UpdateItem", params)
+		})
+
+		It("should return ValidationError for invalid update-fields", func() {
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			mockItem := model.Item{
+				ItemID: itemID.String(),
+				Lot:    itemID.String(),
+			}
+			err = items.Insert(&mockItem)
+			Expect(err).ToNot(HaveOccurred())
+
+			params, err := json.Marshal(map[string]interface{}{
+				"filter": map[string]interface{}{
+					"itemID": itemID.String(),
+				},
+				"update": map[string]interface{}{
+					"itemID":  "0fa2d6e8-3b0b-4f4d-9a0e-cd4a4b3c8f7e",
+					"lot":     "",
+					"price":   -4.5,
+					"version": 9,
+					"color":   "red",
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, nil, "UpdateItem", params)
+			result, event, cmdErr := updateItem(c)
+			Expect(result).To(BeNil())
+			Expect(event).To(BeNil())
+			Expect(cmdErr.Code).To(Equal(model.ValidationError))
+
+			fieldErrs := validation.Errors{}
+			err = json.Unmarshal([]byte(cmdErr.Message), &fieldErrs)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fieldErrs).To(Equal(validation.Errors{
+				{Field: "itemID", Rule: validation.RuleImmutable, Message: "cannot be changed"},
+				{Field: "lot", Rule: validation.RuleRequired, Message: "cannot be cleared"},
+				{Field: "price", Rule: validation.RuleMin, Message: "must be at least 0"},
+				{Field: "version", Rule: validation.RuleReadOnly, Message: "cannot be set"},
+				{Field: "color", Rule: validation.RuleUnknown, Message: "is not a known field"},
+			}))
+		})
+
+		It("should normalize updated UPC to GTIN-14", func() {
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			mockItem := model.Item{
+				ItemID: itemID.String(),
+				Lot:    itemID.String(),
+			}
+			err = items.Insert(&mockItem)
+			Expect(err).ToNot(HaveOccurred())
+
+			params, err := json.Marshal(updateParams{
+				Filter: &model.Item{
+					ItemID: itemID.String(),
+				},
+				Update: &model.Item{
+					UPC: "4006381333931",
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			result, _ := testValid(items, "UpdateItem", params)
+			upResult := map[string]interface{}{}
+			err = json.Unmarshal(result, &upResult)
+			Expect(err).ToNot(HaveOccurred())
+			updatedItem, assertOK := upResult["update"].(map[string]interface{})
+			Expect(assertOK).To(BeTrue())
+			Expect(updatedItem).To(HaveKeyWithValue("upc", "04006381333931"))
+		})
+
+		It("should return ConflictError if expected Version does not match", func() {
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			mockItem := model.Item{
+				ItemID:  itemID.String(),
+				Lot:     itemID.String(),
+				Version: 3,
+			}
+			err = items.Insert(&mockItem)
+			Expect(err).ToNot(HaveOccurred())
+
+			params, err := json.Marshal(updateParams{
+				Filter: &model.Item{
+					ItemID: itemID.String(),
+				},
+				Update: &model.Item{
+					Name: "test-name",
+				},
+				Version: 2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, nil, "UpdateItem", params)
+			result, event, cmdErr := updateItem(c)
+			Expect(result).To(BeNil())
+			Expect(event).To(BeNil())
+			Expect(cmdErr.Code).To(Equal(model.ConflictError))
+		})
+
+		It("should increment Version on ItemUpdated event", func() {
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			mockItem := model.Item{
+				ItemID:  itemID.String(),
+				Lot:     itemID.String(),
+				Version: 3,
+			}
+			err = items.Insert(&mockItem)
+			Expect(err).ToNot(HaveOccurred())
+
+			params, err := json.Marshal(updateParams{
+				Filter: &model.Item{
+					ItemID: itemID.String(),
+				},
+				Update: &model.Item{
+					Name: "test-name",
+				},
+				Version: 3,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, event := testValid(items, "UpdateItem", params)
+			Expect(event.Version).To(Equal(int64(4)))
 		})
 
 		It("should return ItemUpdated event on valid params", func() {
@@ -481,7 +1614,7 @@ var _ = Describe("CommanHandler", func() {
 				ItemID: itemID.String(),
 				Lot:    itemID.String(),
 			}
-			_, err = coll.InsertOne(mockItem)
+			err = items.Insert(&mockItem)
 			Expect(err).ToNot(HaveOccurred())
 
 			params, err := json.Marshal(updateParams{
@@ -494,7 +1627,7 @@ var _ = Describe("CommanHandler", func() {
 			})
 			Expect(err).ToNot(HaveOccurred())
 
-			result, event := testValid(coll, "UpdateItem", params)
+			result, event := testValid(items, "UpdateItem", params)
 			upResult := map[string]interface{}{}
 
 			var _ = event
@@ -509,7 +1642,39 @@ var _ = Describe("CommanHandler", func() {
 
 			filter, assertOK := upResult["filter"].(map[string]interface{})
 			Expect(assertOK).To(BeTrue())
-			Expect(filter).To(HaveKeyWithValue("lot", itemID.String()))
+			Expect(filter).To(Equal(map[string]interface{}{
+				"itemID": mockItem.ItemID,
+			}))
+		})
+
+		It("should return error if Filter matches multiple Items", func() {
+			lot, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 2; i++ {
+				itemID, err := uuuid.NewV4()
+				Expect(err).ToNot(HaveOccurred())
+				err = items.Insert(&model.Item{
+					ItemID: itemID.String(),
+					Lot:    lot.String(),
+				})
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			params, err := json.Marshal(updateParams{
+				Filter: &model.Item{
+					Lot: lot.String(),
+				},
+				Update: &model.Item{
+					Name: "test-name",
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			c := mockShipmentConfig(items, nil, "UpdateItem", params)
+			result, event, cmdErr := updateItem(c)
+			Expect(result).To(BeNil())
+			Expect(event).To(BeNil())
+			Expect(cmdErr.Code).To(Equal(int16(cmodel.UserError)))
 		})
 	})
 })
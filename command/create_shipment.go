@@ -0,0 +1,161 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/TerrexTech/uuuid"
+	"github.com/pkg/errors"
+)
+
+func createShipment(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+	shipment := &model.Shipment{}
+	err := json.Unmarshal(c.Cmd.Data, shipment)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling command-data into Shipment")
+		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+
+	shipment, idErr := updateShipmentID(shipment, c.IDGen)
+	if idErr != nil {
+		return nil, nil, idErr
+	}
+	validateErr := validateShipment(c.Shipments, shipment)
+	if validateErr != nil {
+		return nil, nil, validateErr
+	}
+	shipment.Status = model.ShipmentPlanned
+	shipment.Version = 1
+
+	cmdData, err := json.Marshal(shipment)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling Shipment")
+		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+
+	event, eventErr := newEvent(c, model.EventShipmentCreated, cmdData, shipment.Version)
+	if eventErr != nil {
+		return nil, nil, eventErr
+	}
+
+	return cmdData, event, nil
+}
+
+func updateShipmentID(
+	shipment *model.Shipment,
+	idGen model.IDGenerator,
+) (*model.Shipment, *cmodel.Error) {
+	var shipmentID uuuid.UUID
+	var err error
+
+	if shipment.ShipmentID != "" {
+		shipmentID, err = uuuid.FromString(shipment.ShipmentID)
+		if err != nil {
+			err = errors.Wrap(err, "Error parsing ShipmentID")
+			return nil, cmodel.NewError(cmodel.UserError, err.Error())
+		}
+	}
+
+	if shipmentID == (uuuid.UUID{}) {
+		shipmentID, err := idGen.NewID()
+		if err != nil {
+			err = errors.Wrap(err, "Error generating ShipmentID")
+			return nil, cmodel.NewError(cmodel.InternalError, err.Error())
+		}
+		shipment.ShipmentID = shipmentID.String()
+	}
+
+	return shipment, nil
+}
+
+func validateShipment(
+	shipments repository.ShipmentRepository,
+	shipment *model.Shipment,
+) *cmodel.Error {
+	if shipment.Carrier == "" {
+		err := errors.New("missing Carrier for shipment")
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	if shipment.Destination == "" {
+		err := errors.New("missing Destination for shipment")
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	if shipment.ExpectedArrival == 0 {
+		err := errors.New("missing ExpectedArrival for shipment")
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	if shipment.Origin == "" {
+		err := errors.New("missing Origin for shipment")
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	if shipment.Timestamp == 0 {
+		err := errors.New("missing Timestamp for shipment")
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	if shipment.TrackingNumber == "" {
+		err := errors.New("missing TrackingNumber for shipment")
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	if shipment.Status != "" && shipment.Status != model.ShipmentPlanned {
+		err := fmt.Errorf("new shipment must have status %s", model.ShipmentPlanned)
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	if shipment.ActualArrival != 0 {
+		err := errors.New("ActualArrival must be set using MarkArrived")
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	if len(shipment.ItemIDs) != 0 {
+		err := errors.New("items must be added to shipment using AddItemToShipment")
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
+
+	_, err := shipments.FindOne(&model.Shipment{
+		ShipmentID: shipment.ShipmentID,
+	})
+	if err == nil {
+		err = errors.New("shipment already exists")
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
+
+	return nil
+}
+
+// findShipment returns the Shipment with specified ShipmentID.
+func findShipment(
+	shipments repository.ShipmentRepository,
+	shipmentID string,
+) (*model.Shipment, *cmodel.Error) {
+	if shipmentID == "" {
+		err := errors.New("missing ShipmentID")
+		return nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+
+	shipment, err := shipments.FindOne(&model.Shipment{
+		ShipmentID: shipmentID,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "shipment not found")
+		return nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	return shipment, nil
+}
+
+// findItem returns the Item with specified ItemID.
+func findItem(items repository.ItemRepository, itemID string) (*model.Item, *cmodel.Error) {
+	if itemID == "" {
+		err := errors.New("missing ItemID")
+		return nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+
+	item, err := items.FindOne(&model.Item{
+		ItemID: itemID,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "item not found")
+		return nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	return item, nil
+}
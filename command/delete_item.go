@@ -2,11 +2,9 @@ package command
 
 import (
 	"encoding/json"
-	"time"
 
 	"github.com/TerrexTech/agg-shipment-cmd/model"
 	cmodel "github.com/TerrexTech/go-common-models/model"
-	"github.com/TerrexTech/uuuid"
 	"github.com/pkg/errors"
 )
 
@@ -14,19 +12,45 @@ type deleteResult struct {
 	MatchedCount int `json:"matchedCount,omitempty"`
 }
 
-func deleteItem(c *cmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+func deleteItem(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
 	inv := &model.Item{}
-	err := json.Unmarshal(c.cmd.Data, inv)
+	err := json.Unmarshal(c.Cmd.Data, inv)
 	if err != nil {
 		err = errors.Wrap(err, "Error unmarshalling cmd-data into Item")
 		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
 	}
 
-	matches, err := c.coll.Find(inv)
+	// Version is the version expected by command, and not a filter-field
+	expectedVersion := inv.Version
+	inv.Version = 0
+	// An empty filter would match, and so delete, all Items
+	if *inv == (model.Item{}) {
+		err = errors.New("empty filter provided")
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+
+	matches, err := c.Items.Find(inv)
 	if err != nil || len(matches) == 0 {
 		err = errors.New("item not found")
 		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
 	}
+
+	var version int64
+	for _, matchedItem := range matches {
+		if matchedItem.Version > version {
+			version = matchedItem.Version
+		}
+	}
+	if expectedVersion != 0 {
+		if len(matches) > 1 {
+			err = errors.New("expected version can only be provided when deleting single item")
+			return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+		}
+		versionErr := checkVersion(expectedVersion, version)
+		if versionErr != nil {
+			return nil, nil, versionErr
+		}
+	}
 	result := deleteResult{
 		MatchedCount: len(matches),
 	}
@@ -35,21 +59,17 @@ func deleteItem(c *cmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
 		err = errors.Wrap(err, "Error marshalling result")
 		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
 	}
-
-	uuid, err := uuuid.NewV4()
+	// Only the Item-fields are used as Event-data, since the Event-data
+	// is the filter for Items to delete
+	marshalFilter, err := json.Marshal(inv)
 	if err != nil {
-		err = errors.Wrap(err, "Error generating Event-UUID")
+		err = errors.Wrap(err, "Error marshalling Item-filter")
 		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
 	}
-	event := &cmodel.Event{
-		Action:        "ItemDeleted",
-		AggregateID:   model.AggregateID,
-		CorrelationID: c.cmd.UUID,
-		Data:          c.cmd.Data,
-		NanoTime:      time.Now().UnixNano(),
-		Source:        "agg-shipment-cmd",
-		UUID:          uuid,
-		YearBucket:    2018,
+
+	event, eventErr := newEvent(c, model.EventItemDeleted, marshalFilter, version+1)
+	if eventErr != nil {
+		return nil, nil, eventErr
 	}
 
 	return marshalResult, event, nil
@@ -0,0 +1,44 @@
+package command
+
+import (
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+// newEvent creates the Event produced by handling the Command in c.
+// The Event is timestamped with current time of c.Clock, and its YearBucket
+// is the UTC-year of that time, so it is stored in the event-store
+// partition for when it occurred.
+func newEvent(
+	c *CmdConfig,
+	action string,
+	data []byte,
+	version int64,
+) (*cmodel.Event, *cmodel.Error) {
+	// The Command's deadline was exceeded, so its Event would be discarded
+	if c.Ctx != nil && c.Ctx.Err() != nil {
+		err := errors.Wrap(c.Ctx.Err(), "Error creating Event")
+		return nil, cmodel.NewError(model.TimeoutError, err.Error())
+	}
+
+	eventID, err := c.IDGen.NewID()
+	if err != nil {
+		err = errors.Wrap(err, "Error generating Event-UUID")
+		return nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+
+	now := c.Clock.Now().UTC()
+	return &cmodel.Event{
+		Action:        action,
+		AggregateID:   model.AggregateID,
+		CorrelationID: c.Cmd.UUID,
+		Data:          data,
+		NanoTime:      now.UnixNano(),
+		Source:        c.ServiceName,
+		UserUUID:      c.UserUUID,
+		UUID:          eventID,
+		Version:       version,
+		YearBucket:    int16(now.Year()),
+	}, nil
+}
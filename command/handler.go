@@ -1,38 +1,82 @@
 package command
 
 import (
+	"context"
+	"fmt"
 	"log"
 
-	"github.com/TerrexTech/go-common-models/model"
-	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
 	"github.com/TerrexTech/uuuid"
 	"github.com/pkg/errors"
 )
 
-type cmdConfig struct {
-	coll        *mongo.Collection
-	serviceName string
-	cmd         *model.Command
+// CmdConfig is provided to CommandFuncs for processing a Command.
+type CmdConfig struct {
+	Items       repository.ItemRepository
+	Shipments   repository.ShipmentRepository
+	ServiceName string
+	Cmd         *cmodel.Command
+	// Ctx is cancelled once the deadline for processing the Command,
+	// such as set by TimeoutMiddleware, is exceeded.
+	Ctx context.Context
+	// UserUUID is the user who issued the Command, and is
+	// a zero UUID if the Command has no user.
+	UserUUID uuuid.UUID
+
+	// Clock and IDGen provide the time and UUIDs for
+	// records created while processing the Command.
+	Clock model.Clock
+	IDGen model.IDGenerator
 }
 
 // HandlerConfig is the config for Command-Handler.
 type HandlerConfig struct {
-	Coll        *mongo.Collection
+	// Items and Shipments are the Aggregate-state.
+	Items     repository.ItemRepository
+	Shipments repository.ShipmentRepository
+	// Processed stores results of processed Commands,
+	// which are used to respond to redelivered Commands.
+	Processed repository.ProcessedCommandRepository
+	// Outbox, if set, stores Events and results which are then published
+	// by outbox-relay. Otherwise they are sent directly to producers.
+	Outbox repository.OutboxRepository
+	// Audit, if set, stores the audit-trail of changes
+	// made by Commands to Items and Shipments.
+	Audit       repository.AuditRepository
 	ServiceName string
 
-	EventProd  chan<- *model.Event
-	ResultProd chan<- *model.Document
+	EventProd  chan<- *cmodel.Event
+	ResultProd chan<- *cmodel.Document
+
+	// Middlewares wrap every CommandFunc. The first Middleware is the
+	// outermost, and so runs first.
+	Middlewares []Middleware
+
+	// Clock provides the time for Events and records, and defaults to
+	// model.SystemClock. IDGen generates their UUIDs, and defaults to
+	// model.RandomIDGenerator.
+	Clock model.Clock
+	IDGen model.IDGenerator
 }
 
 // Handler for commands.
 type Handler struct {
 	*HandlerConfig
+	middleware Middleware
 }
 
 // NewHandler creates a new Command-Handler.
 func NewHandler(config *HandlerConfig) (*Handler, error) {
-	if config.Coll == nil {
-		return nil, errors.New("Coll cannot be nil")
+	if config.Items == nil {
+		return nil, errors.New("Items cannot be nil")
+	}
+	if config.Shipments == nil {
+		return nil, errors.New("Shipments cannot be nil")
+	}
+	if config.Processed == nil {
+		return nil, errors.New("Processed cannot be nil")
 	}
 	if config.EventProd == nil {
 		return nil, errors.New("EventProd cannot be nil")
@@ -40,57 +84,108 @@ func NewHandler(config *HandlerConfig) (*Handler, error) {
 	if config.ServiceName == "" {
 		return nil, errors.New("ServiceName cannot be blank")
 	}
+	if config.Clock == nil {
+		config.Clock = model.SystemClock{}
+	}
+	if config.IDGen == nil {
+		config.IDGen = model.RandomIDGenerator{}
+	}
 
 	return &Handler{
-		config,
+		HandlerConfig: config,
+		middleware:    Chain(config.Middlewares...),
 	}, nil
 }
 
-// Handle handles the provided command.
-func (h *Handler) Handle(cmd *model.Command) {
-	var (
-		result []byte
-		event  *model.Event
-		cmdErr *model.Error
-	)
+// Handle handles the provided command. An error is returned if it could not
+// be checked whether the Command was processed, and it can then be retried.
+func (h *Handler) Handle(cmd *cmodel.Command) error {
+	result, err := h.Process(cmd)
+	if err != nil {
+		return err
+	}
+	// Command was redelivered, so respond with original result
+	if result.Redelivered {
+		h.ResultProd <- result.Document
+		return nil
+	}
+
+	h.publish(cmd, result.Event, result.Document)
+	h.MarkProcessed(cmd, result)
+	return nil
+}
 
-	config := &cmdConfig{
-		coll:        h.Coll,
-		serviceName: h.ServiceName,
-		cmd:         cmd,
+// Result is the outcome of processing a Command.
+type Result struct {
+	// Event is nil if Command produced no Event.
+	Event    *cmodel.Event
+	Document *cmodel.Document
+	// Redelivered is true if Command was already processed. The Document
+	// is then the original result, and there is no Event.
+	Redelivered bool
+	// Audit are the AuditEntries for changes made by Event.
+	// These are only created if Audit is set.
+	Audit []*model.AuditEntry
+}
+
+// Process processes the Command without publishing its Event and result,
+// or recording it as processed. This is used when the caller publishes
+// them, such as in a Kafka-transaction, and MarkProcessed must be called
+// once they are published. An error is returned, without processing the
+// Command, if it could not be checked whether the Command was processed.
+func (h *Handler) Process(cmd *cmodel.Command) (*Result, error) {
+	prevDoc, err := findProcessed(h.Processed, cmd)
+	if err != nil {
+		err = errors.Wrap(err, "Error checking if Command was processed")
+		return nil, err
+	}
+	if prevDoc != nil {
+		log.Printf("Command with ID: %s was already processed", cmd.UUID)
+		return &Result{
+			Document:    prevDoc,
+			Redelivered: true,
+		}, nil
 	}
 
-	switch cmd.Action {
-	case "AddItem":
-		result, event, cmdErr = addItem(config)
-		if cmdErr == nil {
-			h.EventProd <- event
-		} else {
-			log.Println(cmdErr.Message)
-		}
+	config := &CmdConfig{
+		Items:       h.Items,
+		Shipments:   h.Shipments,
+		ServiceName: h.ServiceName,
+		Cmd:         cmd,
+		Ctx:         context.Background(),
+		Clock:       h.Clock,
+		IDGen:       h.IDGen,
+	}
 
-	case "DeleteItem":
-		result, event, cmdErr = deleteItem(config)
-		if cmdErr == nil {
-			h.EventProd <- event
-		} else {
-			log.Println(cmdErr.Message)
-		}
+	cmdFunc, isRegistered := registeredFunc(cmd.Action)
+	if !isRegistered {
+		cmdFunc = unknownAction
+	}
+	userUUID, err := commandUser(cmd)
+	if err != nil {
+		cmdFunc = invalidUser(err)
+	}
+	config.UserUUID = userUUID
 
-	case "UpdateItem":
-		result, event, cmdErr = updateItem(config)
-		if cmdErr == nil {
-			h.EventProd <- event
-		} else {
-			log.Println(cmdErr.Message)
-		}
+	result, event, cmdErr := h.middleware(cmdFunc)(config)
+	if cmdErr != nil {
+		log.Println(cmdErr.Message)
+		event = nil
+	}
 
-	default:
-		log.Printf("Command contains unregistered Action: %s", cmd.Action)
+	// Changes are read before the Event is published, since
+	// the Event is applied on Aggregate-state once published
+	var audit []*model.AuditEntry
+	if h.Audit != nil && event != nil {
+		audit, err = auditEntries(config, event)
+		if err != nil {
+			err = errors.Wrap(err, "Error creating AuditEntries")
+			log.Println(err)
+		}
 	}
 
 	// Producer result
-	docID, err := uuuid.NewV4()
+	docID, err := h.IDGen.NewID()
 	if err != nil {
 		err = errors.Wrap(err, "Erro generating CorrelationID")
 		log.Println(err)
@@ -103,7 +198,7 @@ func (h *Handler) Handle(cmd *model.Command) {
 		cmdErrMsg = cmdErr.Message
 		cmdErrCode = cmdErr.Code
 	}
-	doc := &model.Document{
+	doc := &cmodel.Document{
 		CorrelationID: cmd.UUID,
 		Data:          result,
 		Error:         cmdErrMsg,
@@ -112,5 +207,61 @@ func (h *Handler) Handle(cmd *model.Command) {
 		Topic:         cmd.ResponseTopic,
 		UUID:          docID,
 	}
+	return &Result{
+		Event:    event,
+		Document: doc,
+		Audit:    audit,
+	}, nil
+}
+
+// MarkProcessed records the result of Command, which is used to respond
+// if the Command is redelivered, and appends its changes to audit-trail.
+// Timed-out Commands are not recorded, so they are processed again
+// if redelivered.
+func (h *Handler) MarkProcessed(cmd *cmodel.Command, result *Result) {
+	if result.Document.ErrorCode != model.TimeoutError {
+		err := saveProcessed(h.Processed, cmd, result.Document, h.Clock.Now())
+		if err != nil {
+			err = errors.Wrap(err, "Error saving ProcessedCommand")
+			log.Println(err)
+		}
+	}
+
+	if h.Audit != nil {
+		err := saveAudit(h.Audit, result.Audit)
+		if err != nil {
+			err = errors.Wrap(err, "Error saving AuditEntries")
+			log.Println(err)
+		}
+	}
+}
+
+// publish writes the Event and result-Document to outbox if Outbox is
+// set, and otherwise sends them to producers. The event is nil if Command
+// produced no Event.
+func (h *Handler) publish(cmd *cmodel.Command, event *cmodel.Event, doc *cmodel.Document) {
+	if h.Outbox != nil {
+		err := saveOutbox(h.Outbox, cmd, event, doc, h.Clock.Now())
+		if err == nil {
+			return
+		}
+		// The existing entry will be published by outbox-relay
+		if err == errOutboxEntryExists {
+			log.Printf("Command with ID: %s is already in outbox", cmd.UUID)
+			return
+		}
+		err = errors.Wrap(err, "Error saving to outbox, sending to producers instead")
+		log.Println(err)
+	}
+
+	if event != nil {
+		h.EventProd <- event
+	}
 	h.ResultProd <- doc
 }
+
+// unknownAction responds to Commands with no registered CommandFunc.
+func unknownAction(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+	err := fmt.Errorf("Command contains unregistered Action: %s", c.Cmd.Action)
+	return nil, nil, cmodel.NewError(model.UnknownActionError, err.Error())
+}
@@ -0,0 +1,138 @@
+package command
+
+import (
+	"encoding/json"
+
+	"github.com/TerrexTech/agg-shipment-cmd/gs1"
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/validation"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+// itemSchema declares the constraints on Item-fields. Commands which
+// create or change Items must validate them using validateNewItem
+// or validateItemUpdate.
+var itemSchema = validation.Schema{
+	{
+		Name:      "itemID",
+		Kind:      validation.String,
+		Required:  true,
+		Immutable: true,
+		Format:    validation.UUIDFormat,
+	},
+	{
+		Name:     "dateArrived",
+		Kind:     validation.Number,
+		Required: true,
+		Min:      validation.Float(0),
+	},
+	{
+		Name:      "lot",
+		Kind:      validation.String,
+		Required:  true,
+		MaxLength: 64,
+	},
+	{
+		Name:      "name",
+		Kind:      validation.String,
+		Required:  true,
+		MaxLength: 256,
+	},
+	{
+		Name:      "origin",
+		Kind:      validation.String,
+		Required:  true,
+		MaxLength: 256,
+	},
+	{
+		Name:     "price",
+		Kind:     validation.Number,
+		Required: true,
+		Min:      validation.Float(0),
+	},
+	{
+		Name:      "rsCustomerID",
+		Kind:      validation.String,
+		Required:  true,
+		MaxLength: 64,
+	},
+	// ShipmentID is set using AddItemToShipment and RemoveItemFromShipment
+	{
+		Name:     "shipmentID",
+		Kind:     validation.String,
+		ReadOnly: true,
+	},
+	{
+		Name:      "sku",
+		Kind:      validation.String,
+		Required:  true,
+		MaxLength: 64,
+	},
+	{
+		Name:     "timestamp",
+		Kind:     validation.Number,
+		Required: true,
+		Min:      validation.Float(0),
+	},
+	{
+		Name:     "totalWeight",
+		Kind:     validation.Number,
+		Required: true,
+		Min:      validation.Float(0),
+	},
+	// UPC is normalized to GTIN-14 once validated
+	{
+		Name:      "upc",
+		Kind:      validation.String,
+		Required:  true,
+		MaxLength: gs1.GTINLength,
+		Format:    gtinFormat,
+	},
+	{
+		Name:     "version",
+		Kind:     validation.Number,
+		ReadOnly: true,
+	},
+}
+
+// gtinFormat matches UPC-A, EAN-13 and GTIN-14 with valid check digit.
+var gtinFormat = &validation.Format{
+	Name:  "GTIN",
+	Valid: gs1.ValidGTIN,
+}
+
+// validateNewItem validates the fields of Item being created.
+func validateNewItem(item *model.Item) *cmodel.Error {
+	itemMap, err := itemToMap(item)
+	if err != nil {
+		err = errors.Wrap(err, "Error getting item-map")
+		return cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+	return validationError(itemSchema.ValidateCreate(itemMap))
+}
+
+// validateItemUpdate validates the fields being updated on Item.
+func validateItemUpdate(item *model.Item, update map[string]interface{}) *cmodel.Error {
+	itemMap, err := itemToMap(item)
+	if err != nil {
+		err = errors.Wrap(err, "Error getting item-map")
+		return cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+	return validationError(itemSchema.ValidateUpdate(itemMap, update))
+}
+
+// validationError creates the ValidationError for the invalid fields,
+// with the JSON-encoded FieldErrors as message. Nil is returned if
+// there are no invalid fields.
+func validationError(fieldErrs validation.Errors) *cmodel.Error {
+	if len(fieldErrs) == 0 {
+		return nil
+	}
+	marshalErrs, err := json.Marshal(fieldErrs)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling validation-errors")
+		return cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+	return cmodel.NewError(model.ValidationError, string(marshalErrs))
+}
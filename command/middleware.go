@@ -0,0 +1,205 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+// Middleware wraps a CommandFunc to add behavior around Command-processing.
+type Middleware func(next CommandFunc) CommandFunc
+
+// Chain composes the Middlewares into a single Middleware.
+// The first Middleware is the outermost.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next CommandFunc) CommandFunc {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// LoggingMiddleware logs the Commands processed, and their duration and errors.
+func LoggingMiddleware() Middleware {
+	return func(next CommandFunc) CommandFunc {
+		return func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+			start := time.Now()
+			result, event, cmdErr := next(c)
+
+			if cmdErr != nil {
+				log.Printf(
+					"Command %s with ID: %s failed in %s: %d: %s",
+					c.Cmd.Action, c.Cmd.UUID, time.Since(start), cmdErr.Code, cmdErr.Message,
+				)
+			} else {
+				log.Printf(
+					"Command %s with ID: %s processed in %s",
+					c.Cmd.Action, c.Cmd.UUID, time.Since(start),
+				)
+			}
+			return result, event, cmdErr
+		}
+	}
+}
+
+// ActionMetrics are the metrics of Commands with an Action.
+type ActionMetrics struct {
+	Count         int64
+	Errors        int64
+	TotalDuration time.Duration
+}
+
+// CmdMetrics collects ActionMetrics for processed Commands.
+type CmdMetrics struct {
+	lock    sync.Mutex
+	actions map[string]ActionMetrics
+}
+
+// NewCmdMetrics creates a new CmdMetrics.
+func NewCmdMetrics() *CmdMetrics {
+	return &CmdMetrics{
+		actions: map[string]ActionMetrics{},
+	}
+}
+
+// Stats returns the ActionMetrics by Command-Action.
+func (m *CmdMetrics) Stats() map[string]ActionMetrics {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stats := make(map[string]ActionMetrics, len(m.actions))
+	for action, metrics := range m.actions {
+		stats[action] = metrics
+	}
+	return stats
+}
+
+func (m *CmdMetrics) record(action string, duration time.Duration, isErr bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	metrics := m.actions[action]
+	metrics.Count++
+	if isErr {
+		metrics.Errors++
+	}
+	metrics.TotalDuration += duration
+	m.actions[action] = metrics
+}
+
+// MetricsMiddleware records the ActionMetrics of processed Commands in metrics.
+func MetricsMiddleware(metrics *CmdMetrics) Middleware {
+	return func(next CommandFunc) CommandFunc {
+		return func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+			start := time.Now()
+			result, event, cmdErr := next(c)
+			metrics.record(c.Cmd.Action, time.Since(start), cmdErr != nil)
+			return result, event, cmdErr
+		}
+	}
+}
+
+// AuthMiddleware rejects the Commands for which authorize returns an error.
+func AuthMiddleware(authorize func(cmd *cmodel.Command) error) Middleware {
+	return func(next CommandFunc) CommandFunc {
+		return func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+			err := authorize(c.Cmd)
+			if err != nil {
+				err = errors.Wrap(err, "Command not authorized")
+				return nil, nil, cmodel.NewError(model.UnauthorizedError, err.Error())
+			}
+			return next(c)
+		}
+	}
+}
+
+// ValidationMiddleware rejects the Commands for which validate returns an error.
+func ValidationMiddleware(validate func(c *CmdConfig) *cmodel.Error) Middleware {
+	return func(next CommandFunc) CommandFunc {
+		return func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+			cmdErr := validate(c)
+			if cmdErr != nil {
+				return nil, nil, cmdErr
+			}
+			return next(c)
+		}
+	}
+}
+
+// TimeoutMiddleware responds with TimeoutError if the Command is not processed
+// within timeout. The CommandFunc runs with a Ctx which is cancelled once
+// timeout elapses, so it can stop early, and its result is discarded if it
+// completes after that. The CommandFunc still runs on the calling goroutine,
+// so it cannot overlap with the next Command on the same worker.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next CommandFunc) CommandFunc {
+		return func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+			parent := c.Ctx
+			if parent == nil {
+				parent = context.Background()
+			}
+			ctx, cancel := context.WithTimeout(parent, timeout)
+			defer cancel()
+
+			timedConfig := *c
+			timedConfig.Ctx = ctx
+			result, event, cmdErr := next(&timedConfig)
+			if ctx.Err() != nil {
+				err := fmt.Errorf("Command was not processed within %s", timeout)
+				return nil, nil, cmodel.NewError(model.TimeoutError, err.Error())
+			}
+			return result, event, cmdErr
+		}
+	}
+}
+
+// RecoveryMiddleware recovers from panics in Command-processing,
+// and responds with InternalError.
+func RecoveryMiddleware() Middleware {
+	return func(next CommandFunc) CommandFunc {
+		return func(c *CmdConfig) (
+			result []byte,
+			event *cmodel.Event,
+			cmdErr *cmodel.Error,
+		) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf(
+						"Recovered from panic in Command with ID: %s: %v\n%s",
+						c.Cmd.UUID, r, debug.Stack(),
+					)
+					err := fmt.Errorf("panic while processing command: %v", r)
+					result = nil
+					event = nil
+					cmdErr = cmodel.NewError(cmodel.InternalError, err.Error())
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+// SpanStarter starts a tracing-span for the Command, and returns
+// the function to finish the span.
+type SpanStarter func(c *CmdConfig) (finish func(cmdErr *cmodel.Error))
+
+// TracingMiddleware wraps Command-processing in tracing-spans
+// started using startSpan.
+func TracingMiddleware(startSpan SpanStarter) Middleware {
+	return func(next CommandFunc) CommandFunc {
+		return func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+			finish := startSpan(c)
+			result, event, cmdErr := next(c)
+			finish(cmdErr)
+			return result, event, cmdErr
+		}
+	}
+}
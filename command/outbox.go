@@ -0,0 +1,64 @@
+package command
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+// errOutboxEntryExists is returned when the Command already has an
+// OutboxEntry, which happens if the Command is redelivered before it
+// was recorded as processed.
+var errOutboxEntryExists = errors.New("OutboxEntry already exists for Command")
+
+// saveOutbox writes the Event and result-Document produced by Command as a
+// single OutboxEntry, so both are either published, or neither is.
+// The event is nil if Command produced no Event.
+func saveOutbox(
+	outbox repository.OutboxRepository,
+	cmd *cmodel.Command,
+	event *cmodel.Event,
+	doc *cmodel.Document,
+	createdAt time.Time,
+) error {
+	_, err := outbox.FindOne(cmd.UUID.String())
+	if err == nil {
+		return errOutboxEntryExists
+	}
+	if err != repository.ErrNotFound {
+		err = errors.Wrap(err, "Error finding OutboxEntry")
+		return err
+	}
+
+	entry := &model.OutboxEntry{
+		CommandUUID: cmd.UUID.String(),
+		CreatedAt:   createdAt.UnixNano(),
+		ResultTopic: doc.Topic,
+	}
+	if event != nil {
+		entry.Event, err = json.Marshal(event)
+		if err != nil {
+			err = errors.Wrap(err, "Error marshalling Event")
+			return err
+		}
+	} else {
+		// Nothing to send, so this part is complete
+		entry.EventSent = true
+	}
+	entry.Result, err = json.Marshal(doc)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling result-Document")
+		return err
+	}
+
+	err = outbox.Insert(entry)
+	if err != nil {
+		err = errors.Wrap(err, "Error inserting OutboxEntry")
+		return err
+	}
+	return nil
+}
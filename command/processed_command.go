@@ -0,0 +1,61 @@
+package command
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+// findProcessed returns the result-Document produced when the Command was
+// previously processed. A nil Document is returned if Command was not processed.
+func findProcessed(
+	processedRepo repository.ProcessedCommandRepository,
+	cmd *cmodel.Command,
+) (*cmodel.Document, error) {
+	processed, err := processedRepo.FindOne(cmd.UUID.String())
+	// Command not processed before
+	if err == repository.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		err = errors.Wrap(err, "Error finding ProcessedCommand")
+		return nil, err
+	}
+
+	doc := &cmodel.Document{}
+	err = json.Unmarshal(processed.Document, doc)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling ProcessedCommand-Document")
+		return nil, err
+	}
+	return doc, nil
+}
+
+// saveProcessed stores the result-Document produced by Command.
+func saveProcessed(
+	processedRepo repository.ProcessedCommandRepository,
+	cmd *cmodel.Command,
+	doc *cmodel.Document,
+	createdAt time.Time,
+) error {
+	marshalDoc, err := json.Marshal(doc)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling result-Document")
+		return err
+	}
+
+	err = processedRepo.Insert(&model.ProcessedCommand{
+		CommandUUID: cmd.UUID.String(),
+		Document:    marshalDoc,
+		CreatedAt:   createdAt.UTC(),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error inserting ProcessedCommand")
+		return err
+	}
+	return nil
+}
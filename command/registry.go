@@ -0,0 +1,83 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+// CommandFunc processes a Command, and returns the result and the
+// Event produced, or the error if the Command could not be processed.
+type CommandFunc func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error)
+
+var (
+	registryLock sync.RWMutex
+	registry     = map[string]CommandFunc{}
+)
+
+func init() {
+	builtinCmds := map[string]CommandFunc{
+		"AddItem":                addItem,
+		"AddItemFromBarcode":     addItemFromBarcode,
+		"DeleteItem":             deleteItem,
+		"UpdateItem":             updateItem,
+		"CreateShipment":         createShipment,
+		"AddItemToShipment":      addItemToShipment,
+		"RemoveItemFromShipment": removeItemFromShipment,
+	}
+	for action := range statusCommands {
+		builtinCmds[action] = updateShipmentStatus
+	}
+
+	for action, fn := range builtinCmds {
+		err := Register(action, fn)
+		if err != nil {
+			panic(errors.Wrap(err, "Error registering built-in Command"))
+		}
+	}
+}
+
+// Register registers the CommandFunc for processing Commands with specified
+// Action. Commands can be registered from other packages, usually in their
+// init functions. An Action can only be registered once.
+func Register(action string, fn CommandFunc) error {
+	if action == "" {
+		return errors.New("action cannot be blank")
+	}
+	if fn == nil {
+		return errors.New("fn cannot be nil")
+	}
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if _, exists := registry[action]; exists {
+		return fmt.Errorf("Action %s is already registered", action)
+	}
+	registry[action] = fn
+	return nil
+}
+
+// RegisteredActions returns the sorted list of registered Command-Actions.
+func RegisteredActions() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	actions := make([]string, 0, len(registry))
+	for action := range registry {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+func registeredFunc(action string) (CommandFunc, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	fn, exists := registry[action]
+	return fn, exists
+}
@@ -0,0 +1,86 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+func removeItemFromShipment(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+	params := &shipmentItemParams{}
+	err := json.Unmarshal(c.Cmd.Data, params)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling cmd-data into ShipmentItemParams")
+		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+
+	shipment, findErr := findShipment(c.Shipments, params.ShipmentID)
+	if findErr != nil {
+		return nil, nil, findErr
+	}
+	versionErr := checkVersion(params.Version, shipment.Version)
+	if versionErr != nil {
+		return nil, nil, versionErr
+	}
+	if model.IsShipmentFinal(shipment.Status) {
+		err = fmt.Errorf("cannot remove items from shipment with status %s", shipment.Status)
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	if params.ItemID == "" {
+		err = errors.New("missing ItemID")
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+
+	itemFound := false
+	for _, itemID := range shipment.ItemIDs {
+		if itemID == params.ItemID {
+			itemFound = true
+			break
+		}
+	}
+	if !itemFound {
+		err = errors.New("item does not belong to shipment")
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+
+	// Items deleted while in Shipment can still be removed from it,
+	// in which case there is no Item-version to change
+	var itemVersion int64
+	item, err := c.Items.FindOne(&model.Item{
+		ItemID: params.ItemID,
+	})
+	if err != nil && errors.Cause(err) != repository.ErrNotFound {
+		err = errors.Wrap(err, "Error finding Item")
+		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+	if err == nil {
+		versionErr = checkVersion(params.ItemVersion, item.Version)
+		if versionErr != nil {
+			return nil, nil, versionErr
+		}
+		itemVersion = item.Version + 1
+	}
+
+	eventData := model.ShipmentItemData{
+		ShipmentID:  params.ShipmentID,
+		ItemID:      params.ItemID,
+		Version:     shipment.Version + 1,
+		ItemVersion: itemVersion,
+	}
+	marshalData, err := json.Marshal(eventData)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling ShipmentItemData")
+		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+
+	event, eventErr := newEvent(c, model.EventItemRemovedFromShipment, marshalData, eventData.Version)
+	if eventErr != nil {
+		return nil, nil, eventErr
+	}
+
+	return marshalData, event, nil
+}
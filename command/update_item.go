@@ -2,58 +2,90 @@ package command
 
 import (
 	"encoding/json"
-	"time"
+	"fmt"
 
+	"github.com/TerrexTech/agg-shipment-cmd/gs1"
 	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
 	cmodel "github.com/TerrexTech/go-common-models/model"
-	"github.com/TerrexTech/uuuid"
 	"github.com/pkg/errors"
 )
 
 type updateParams struct {
 	Filter *model.Item `json:"filter,omitempty"`
 	Update *model.Item `json:"update,omitempty"`
+	// Version is the version of Item expected by command.
+	// The version-check is skipped if this is 0.
+	Version int64 `json:"version,omitempty"`
 }
 
-func updateItem(c *cmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+func updateItem(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
 	params := &updateParams{}
-	err := json.Unmarshal(c.cmd.Data, params)
+	err := json.Unmarshal(c.Cmd.Data, params)
 	if err != nil {
 		err = errors.Wrap(err, "Error while unmarshalling cmd-data")
 		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
 	}
 
 	validateErr := validateParams(params)
-	if err != nil {
+	if validateErr != nil {
 		return nil, nil, validateErr
 	}
 
-	match, err := c.coll.FindOne(params.Filter)
+	// The ItemUpdated Event sets the whole Item, along with its version,
+	// so the filter must match a single Item
+	matchedItems, err := c.Items.Find(params.Filter)
 	if err != nil {
 		err = errors.Wrap(err, "Error finding Item")
+		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+	if len(matchedItems) == 0 {
+		err = errors.Wrap(repository.ErrNotFound, "Error finding Item")
 		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
 	}
-	matchedItem, assertOK := match.(*model.Item)
-	if !assertOK {
-		err = errors.New("error asserting find-result to item-map")
-		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	if len(matchedItems) > 1 {
+		err = fmt.Errorf("filter matches %d Items, but only one Item can be updated", len(matchedItems))
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	matchedItem := matchedItems[0]
+	versionErr := checkVersion(params.Version, matchedItem.Version)
+	if versionErr != nil {
+		return nil, nil, versionErr
 	}
 
-	itemMap, err := itemToMap(matchedItem)
+	update, err := updateFields(c.Cmd.Data)
 	if err != nil {
-		err = errors.Wrap(err, "error getting item-map")
-		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+		err = errors.Wrap(err, "Error getting update-fields")
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	validateErr = validateItemUpdate(matchedItem, update)
+	if validateErr != nil {
+		return nil, nil, validateErr
+	}
+	if upc, isString := update["upc"].(string); isString {
+		update["upc"], err = gs1.NormalizeGTIN(upc)
+		if err != nil {
+			err = errors.Wrap(err, "Error normalizing UPC")
+			return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+		}
 	}
 
-	updatedItem, err := patchItem(c.cmd.Data, itemMap)
+	itemMap, err := itemToMap(matchedItem)
 	if err != nil {
-		err = errors.Wrap(err, "Error patching item")
+		err = errors.Wrap(err, "error getting item-map")
 		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
 	}
-
-	updateResult := map[string]interface{}{
-		"filter": params.Filter,
-		"update": updatedItem,
+	updatedItem := patchItem(update, itemMap)
+	version := matchedItem.Version + 1
+	updatedItem["version"] = version
+
+	// The Event only applies to the matched Item, even if other
+	// Items match the filter by the time the Event is applied
+	updateResult := model.ItemUpdatedData{
+		Filter: map[string]interface{}{
+			"itemID": matchedItem.ItemID,
+		},
+		Update: updatedItem,
 	}
 	marshalResult, err := json.Marshal(updateResult)
 	if err != nil {
@@ -61,20 +93,9 @@ func updateItem(c *cmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
 		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
 	}
 
-	uuid, err := uuuid.NewV4()
-	if err != nil {
-		err = errors.Wrap(err, "Error generating Event-UUID")
-		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
-	}
-	event := &cmodel.Event{
-		Action:        "ItemUpdated",
-		AggregateID:   model.AggregateID,
-		CorrelationID: c.cmd.UUID,
-		Data:          marshalResult,
-		NanoTime:      time.Now().UnixNano(),
-		Source:        c.serviceName,
-		UUID:          uuid,
-		YearBucket:    2018,
+	event, eventErr := newEvent(c, model.EventItemUpdated, marshalResult, version)
+	if eventErr != nil {
+		return nil, nil, eventErr
 	}
 
 	return marshalResult, event, nil
@@ -96,53 +117,51 @@ func itemToMap(u *model.Item) (map[string]interface{}, error) {
 	return itemMap, nil
 }
 
-func patchItem(
-	updateParams []byte,
-	itemMap map[string]interface{},
-) (map[string]interface{}, error) {
-	// Extract Update from UpdateParams
-	updateParamsMap := map[string]map[string]interface{}{}
+// updateFields returns the fields set in Update of UpdateParams. Unlike
+// updateParams.Update, this includes the fields being cleared.
+func updateFields(updateParams []byte) (map[string]interface{}, error) {
+	// Only the update-field is unmarshalled as map, since the other
+	// fields, such as version, are not objects
+	updateParamsMap := struct {
+		Update map[string]interface{} `json:"update"`
+	}{}
 	err := json.Unmarshal(updateParams, &updateParamsMap)
 	if err != nil {
 		err = errors.Wrap(err, "Error unmarshalling UpdateParams")
 		return nil, err
 	}
 
-	if updateParamsMap["update"] == nil {
-		err = errors.New("Update-field not found in updateParamsMap")
+	if len(updateParamsMap.Update) == 0 {
+		err = errors.New("Update-field not found or empty in updateParamsMap")
 		return nil, err
 	}
-	for k, v := range updateParamsMap["update"] {
+	return updateParamsMap.Update, nil
+}
+
+func patchItem(
+	update map[string]interface{},
+	itemMap map[string]interface{},
+) map[string]interface{} {
+	for k, v := range update {
 		itemMap[k] = v
 	}
-
-	return itemMap, nil
+	return itemMap
 }
 
 func validateParams(params *updateParams) *cmodel.Error {
-	// filter := params.Filter
-	// if filter == nil {
-	// 	err := errors.New("nil filter provided")
-	// 	return cmodel.NewError(cmodel.UserError, err.Error())
-	// }
-
-	// update := params.Update
-	// if update == nil {
-	// 	err := errors.New("nil update provided")
-	// 	return cmodel.NewError(cmodel.UserError, err.Error())
-	// }
-	// if update.ItemID != "" {
-	// 	err := errors.New("itemID cannot be changed")
-	// 	return cmodel.NewError(cmodel.UserError, err.Error())
-	// }
-	// if update.ItemName != "" {
-	// 	err := errors.New("itemname cannot be changed")
-	// 	return cmodel.NewError(cmodel.UserError, err.Error())
-	// }
-	// if update.Password == "" {
-	// 	err := errors.New("found blank password")
-	// 	return cmodel.NewError(cmodel.UserError, err.Error())
-	// }
+	if params.Filter == nil {
+		err := errors.New("nil filter provided")
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	// An empty filter would match any Item
+	if *params.Filter == (model.Item{}) {
+		err := errors.New("empty filter provided")
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
+	if params.Update == nil {
+		err := errors.New("nil update provided")
+		return cmodel.NewError(cmodel.UserError, err.Error())
+	}
 
 	return nil
 }
@@ -0,0 +1,92 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+// statusTransition is the Shipment-status a command transitions to,
+// and the event-action produced as a result.
+type statusTransition struct {
+	status      string
+	eventAction string
+}
+
+// statusCommands maps Shipment-lifecycle commands to their transitions.
+var statusCommands = map[string]statusTransition{
+	"DispatchShipment":   statusTransition{model.ShipmentInTransit, model.EventShipmentDispatched},
+	"MarkArrived":        statusTransition{model.ShipmentArrived, model.EventShipmentArrived},
+	"CompleteInspection": statusTransition{model.ShipmentInspected, model.EventShipmentInspected},
+	"ReceiveShipment":    statusTransition{model.ShipmentReceived, model.EventShipmentReceived},
+	"CloseShipment":      statusTransition{model.ShipmentClosed, model.EventShipmentClosed},
+	"RejectShipment":     statusTransition{model.ShipmentRejected, model.EventShipmentRejected},
+	"CancelShipment":     statusTransition{model.ShipmentCancelled, model.EventShipmentCancelled},
+}
+
+type shipmentStatusParams struct {
+	ShipmentID    string `json:"shipmentID,omitempty"`
+	ActualArrival int64  `json:"actualArrival,omitempty"`
+	// Version is the version of Shipment expected by command.
+	// The version-check is skipped if this is 0.
+	Version int64 `json:"version,omitempty"`
+}
+
+func updateShipmentStatus(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+	transition, isStatusCmd := statusCommands[c.Cmd.Action]
+	if !isStatusCmd {
+		err := fmt.Errorf("%s is not a shipment-status command", c.Cmd.Action)
+		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+
+	params := &shipmentStatusParams{}
+	err := json.Unmarshal(c.Cmd.Data, params)
+	if err != nil {
+		err = errors.Wrap(err, "Error unmarshalling cmd-data into ShipmentStatusParams")
+		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+
+	shipment, findErr := findShipment(c.Shipments, params.ShipmentID)
+	if findErr != nil {
+		return nil, nil, findErr
+	}
+	versionErr := checkVersion(params.Version, shipment.Version)
+	if versionErr != nil {
+		return nil, nil, versionErr
+	}
+	if !model.CanTransitionShipment(shipment.Status, transition.status) {
+		err = fmt.Errorf(
+			"shipment cannot transition from %s to %s",
+			shipment.Status, transition.status,
+		)
+		return nil, nil, cmodel.NewError(cmodel.UserError, err.Error())
+	}
+
+	eventData := model.ShipmentStatusData{
+		ShipmentID: params.ShipmentID,
+		Status:     transition.status,
+		Version:    shipment.Version + 1,
+	}
+	if transition.status == model.ShipmentArrived {
+		eventData.ActualArrival = params.ActualArrival
+		if eventData.ActualArrival == 0 {
+			eventData.ActualArrival = c.Clock.Now().UTC().Unix()
+		}
+	}
+
+	marshalData, err := json.Marshal(eventData)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling ShipmentStatusData")
+		return nil, nil, cmodel.NewError(cmodel.InternalError, err.Error())
+	}
+
+	event, eventErr := newEvent(c, transition.eventAction, marshalData, eventData.Version)
+	if eventErr != nil {
+		return nil, nil, eventErr
+	}
+
+	return marshalData, event, nil
+}
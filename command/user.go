@@ -0,0 +1,40 @@
+package command
+
+import (
+	"encoding/json"
+
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/TerrexTech/uuuid"
+	"github.com/pkg/errors"
+)
+
+// cmdUser is the identity of user who issued the Command,
+// as provided in Command-data.
+type cmdUser struct {
+	UserUUID string `json:"userUUID,omitempty"`
+}
+
+// commandUser returns the UUID of user who issued the Command.
+// A zero UUID is returned if the Command has no user.
+func commandUser(cmd *cmodel.Command) (uuuid.UUID, error) {
+	user := &cmdUser{}
+	// Command-data is not necessarily an object, in which case there is no user
+	err := json.Unmarshal(cmd.Data, user)
+	if err != nil || user.UserUUID == "" {
+		return uuuid.UUID{}, nil
+	}
+
+	userUUID, err := uuuid.FromString(user.UserUUID)
+	if err != nil {
+		err = errors.Wrap(err, "Error parsing UserUUID")
+		return uuuid.UUID{}, err
+	}
+	return userUUID, nil
+}
+
+// invalidUser responds to Commands with an unparseable user-identity.
+func invalidUser(userErr error) CommandFunc {
+	return func(c *CmdConfig) ([]byte, *cmodel.Event, *cmodel.Error) {
+		return nil, nil, cmodel.NewError(cmodel.UserError, userErr.Error())
+	}
+}
@@ -0,0 +1,25 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+)
+
+// checkVersion validates the version expected by a command against the
+// current version of the entity. An expected version of 0 skips the check.
+// The check is against Aggregate-state built before the Command is processed,
+// so it is only reliable if Commands for the entity are processed in order,
+// which the Command-consumer ensures by sharding Commands on the Items and
+// Shipments they change.
+func checkVersion(expected int64, current int64) *cmodel.Error {
+	if expected == 0 || expected == current {
+		return nil
+	}
+	err := fmt.Errorf(
+		"version conflict: expected version %d, but current version is %d",
+		expected, current,
+	)
+	return cmodel.NewError(model.ConflictError, err.Error())
+}
@@ -1,14 +1,18 @@
 package connutil
 
 import (
+	"context"
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/TerrexTech/agg-shipment-cmd/model"
 	"github.com/TerrexTech/go-agg-builder/builder"
 	"github.com/TerrexTech/go-commonutils/commonutil"
 	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/mongodb/mongo-go-driver/bson"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
 	"github.com/pkg/errors"
 )
 
@@ -112,3 +116,376 @@ func createMongoCollection(
 	}
 	return collection, nil
 }
+
+// LoadShipmentCollection creates the Shipment-collection using the connection
+// from provided MongoConfig.
+func LoadShipmentCollection(mc *builder.MongoConfig) (*mongo.Collection, error) {
+	shipmentCollection := os.Getenv("MONGO_SHIPMENT_COLLECTION")
+
+	// Index Configuration
+	indexConfigs := []mongo.IndexConfig{
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name: "shipmentID",
+				},
+			},
+			IsUnique: true,
+			Name:     "shipmentID_index",
+		},
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name:        "timestamp",
+					IsDescOrder: true,
+				},
+			},
+			Name: "timestamp_index",
+		},
+	}
+
+	collection, err := mongo.EnsureCollection(&mongo.Collection{
+		Connection:   mc.Connection,
+		Database:     mc.MetaDatabaseName,
+		Name:         shipmentCollection,
+		SchemaStruct: &model.Shipment{},
+		Indexes:      indexConfigs,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error creating Shipment-Collection")
+		return nil, err
+	}
+	return collection, nil
+}
+
+// LoadProcessedCmdCollection creates the collection for storing results of
+// processed Commands. The entries expire after MONGO_PROCESSED_CMD_TTL_SEC.
+func LoadProcessedCmdCollection(mc *builder.MongoConfig) (*mongo.Collection, error) {
+	processedCollection := os.Getenv("MONGO_PROCESSED_CMD_COLLECTION")
+
+	ttlSecStr := os.Getenv("MONGO_PROCESSED_CMD_TTL_SEC")
+	ttlSec, err := strconv.Atoi(ttlSecStr)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting MONGO_PROCESSED_CMD_TTL_SEC to integer")
+		log.Println(err)
+		log.Println("A default value of 86400 will be used for MONGO_PROCESSED_CMD_TTL_SEC")
+		ttlSec = 86400
+	}
+
+	// Index Configuration
+	indexConfigs := []mongo.IndexConfig{
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name: "commandUUID",
+				},
+			},
+			IsUnique: true,
+			Name:     "commandUUID_index",
+		},
+	}
+
+	collection, err := mongo.EnsureCollection(&mongo.Collection{
+		Connection:   mc.Connection,
+		Database:     mc.MetaDatabaseName,
+		Name:         processedCollection,
+		SchemaStruct: &model.ProcessedCommand{},
+		Indexes:      indexConfigs,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error creating ProcessedCmd-Collection")
+		return nil, err
+	}
+
+	// TTL-Indexes are not supported by IndexConfig, so the driver is used directly
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		time.Duration(mc.Connection.Timeout)*time.Millisecond,
+	)
+	defer cancel()
+	_, err = collection.Collection().Indexes().CreateOne(ctx, mgo.IndexModel{
+		Keys: bson.NewDocument(
+			bson.EC.Int32("createdAt", 1),
+		),
+		Options: bson.NewDocument(
+			bson.EC.Int32("expireAfterSeconds", int32(ttlSec)),
+			bson.EC.String("name", "createdAt_ttl_index"),
+		),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error creating TTL-Index on ProcessedCmd-Collection")
+		return nil, err
+	}
+	return collection, nil
+}
+
+// LoadOutboxCollection creates the collection for storing Events and
+// results which are yet to be published.
+func LoadOutboxCollection(mc *builder.MongoConfig) (*mongo.Collection, error) {
+	outboxCollection := os.Getenv("MONGO_OUTBOX_COLLECTION")
+
+	// Index Configuration
+	indexConfigs := []mongo.IndexConfig{
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name: "commandUUID",
+				},
+			},
+			IsUnique: true,
+			Name:     "commandUUID_index",
+		},
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name: "sent",
+				},
+				mongo.IndexColumnConfig{
+					Name: "nextAttemptAt",
+				},
+			},
+			Name: "sent_nextAttemptAt_index",
+		},
+	}
+
+	collection, err := mongo.EnsureCollection(&mongo.Collection{
+		Connection:   mc.Connection,
+		Database:     mc.MetaDatabaseName,
+		Name:         outboxCollection,
+		SchemaStruct: &model.OutboxEntry{},
+		Indexes:      indexConfigs,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error creating Outbox-Collection")
+		return nil, err
+	}
+	return collection, nil
+}
+
+// LoadAuditCollection creates the collection for storing the
+// audit-trail of changes made by Commands.
+func LoadAuditCollection(mc *builder.MongoConfig) (*mongo.Collection, error) {
+	auditCollection := os.Getenv("MONGO_AUDIT_COLLECTION")
+
+	// Index Configuration
+	indexConfigs := []mongo.IndexConfig{
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name: "auditID",
+				},
+			},
+			IsUnique: true,
+			Name:     "auditID_index",
+		},
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name: "itemID",
+				},
+				mongo.IndexColumnConfig{
+					Name: "timestamp",
+				},
+			},
+			Name: "itemID_timestamp_index",
+		},
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name: "userUUID",
+				},
+				mongo.IndexColumnConfig{
+					Name: "timestamp",
+				},
+			},
+			Name: "userUUID_timestamp_index",
+		},
+	}
+
+	collection, err := mongo.EnsureCollection(&mongo.Collection{
+		Connection:   mc.Connection,
+		Database:     mc.MetaDatabaseName,
+		Name:         auditCollection,
+		SchemaStruct: &model.AuditEntry{},
+		Indexes:      indexConfigs,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error creating Audit-Collection")
+		return nil, err
+	}
+	return collection, nil
+}
+
+// LoadHWMCollection creates the collection for storing the HighWaterMark
+// of Aggregate-state, used for building the state incrementally.
+func LoadHWMCollection(mc *builder.MongoConfig) (*mongo.Collection, error) {
+	hwmCollection := os.Getenv("MONGO_HWM_COLLECTION")
+
+	// Index Configuration
+	indexConfigs := []mongo.IndexConfig{
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name: "aggregateID",
+				},
+			},
+			IsUnique: true,
+			Name:     "aggregateID_index",
+		},
+	}
+
+	collection, err := mongo.EnsureCollection(&mongo.Collection{
+		Connection:   mc.Connection,
+		Database:     mc.MetaDatabaseName,
+		Name:         hwmCollection,
+		SchemaStruct: &model.HighWaterMark{},
+		Indexes:      indexConfigs,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error creating HWM-Collection")
+		return nil, err
+	}
+	return collection, nil
+}
+
+// LoadParkedEventCollection creates the collection for storing Events
+// which could not be applied on Aggregate-state.
+func LoadParkedEventCollection(mc *builder.MongoConfig) (*mongo.Collection, error) {
+	parkedCollection := os.Getenv("MONGO_PARKED_EVENT_COLLECTION")
+
+	// Index Configuration
+	indexConfigs := []mongo.IndexConfig{
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name: "eventUUID",
+				},
+			},
+			IsUnique: true,
+			Name:     "eventUUID_index",
+		},
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name: "action",
+				},
+			},
+			Name: "action_index",
+		},
+	}
+
+	collection, err := mongo.EnsureCollection(&mongo.Collection{
+		Connection:   mc.Connection,
+		Database:     mc.MetaDatabaseName,
+		Name:         parkedCollection,
+		SchemaStruct: &model.ParkedEvent{},
+		Indexes:      indexConfigs,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error creating ParkedEvent-Collection")
+		return nil, err
+	}
+	return collection, nil
+}
+
+// LoadSnapshotCollection creates the collection for storing Snapshots
+// of Aggregate-state.
+func LoadSnapshotCollection(mc *builder.MongoConfig) (*mongo.Collection, error) {
+	snapshotCollection := os.Getenv("MONGO_SNAPSHOT_COLLECTION")
+
+	// Index Configuration
+	indexConfigs := []mongo.IndexConfig{
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name: "snapshotID",
+				},
+			},
+			IsUnique: true,
+			Name:     "snapshotID_index",
+		},
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name:        "nanoTime",
+					IsDescOrder: true,
+				},
+			},
+			Name: "nanoTime_index",
+		},
+	}
+
+	collection, err := mongo.EnsureCollection(&mongo.Collection{
+		Connection:   mc.Connection,
+		Database:     mc.MetaDatabaseName,
+		Name:         snapshotCollection,
+		SchemaStruct: &model.Snapshot{},
+		Indexes:      indexConfigs,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error creating Snapshot-Collection")
+		return nil, err
+	}
+	return collection, nil
+}
+
+// LoadSnapshotChunkCollection creates the collection for storing the
+// Items and Shipments of Snapshots in chunks.
+func LoadSnapshotChunkCollection(mc *builder.MongoConfig) (*mongo.Collection, error) {
+	chunkCollection := os.Getenv("MONGO_SNAPSHOT_COLLECTION") + "_chunks"
+
+	// Index Configuration
+	indexConfigs := []mongo.IndexConfig{
+		mongo.IndexConfig{
+			ColumnConfig: []mongo.IndexColumnConfig{
+				mongo.IndexColumnConfig{
+					Name: "snapshotID",
+				},
+				mongo.IndexColumnConfig{
+					Name: "chunk",
+				},
+			},
+			IsUnique: true,
+			Name:     "snapshotID_chunk_index",
+		},
+	}
+
+	collection, err := mongo.EnsureCollection(&mongo.Collection{
+		Connection:   mc.Connection,
+		Database:     mc.MetaDatabaseName,
+		Name:         chunkCollection,
+		SchemaStruct: &model.SnapshotChunk{},
+		Indexes:      indexConfigs,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error creating SnapshotChunk-Collection")
+		return nil, err
+	}
+	return collection, nil
+}
+
+// LoadVerifyCollections creates the scratch Item and Shipment collections
+// used for verifying a Snapshot against a full replay of Events.
+func LoadVerifyCollections(
+	mc *builder.MongoConfig,
+) (*mongo.Collection, *mongo.Collection, error) {
+	aggCollection := os.Getenv("MONGO_AGG_COLLECTION") + "_verify"
+	shipmentCollection := os.Getenv("MONGO_SHIPMENT_COLLECTION") + "_verify"
+
+	coll, err := createMongoCollection(mc.Connection, mc.MetaDatabaseName, aggCollection)
+	if err != nil {
+		err = errors.Wrap(err, "Error creating Item verify-Collection")
+		return nil, nil, err
+	}
+	shipmentColl, err := mongo.EnsureCollection(&mongo.Collection{
+		Connection:   mc.Connection,
+		Database:     mc.MetaDatabaseName,
+		Name:         shipmentCollection,
+		SchemaStruct: &model.Shipment{},
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error creating Shipment verify-Collection")
+		return nil, nil, err
+	}
+	return coll, shipmentColl, nil
+}
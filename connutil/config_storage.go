@@ -0,0 +1,184 @@
+package connutil
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	"github.com/TerrexTech/go-agg-builder/builder"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// Storage-backends for Aggregate-state, as set in STORAGE_BACKEND.
+const (
+	StorageMongo = "mongo"
+	StorageBolt  = "bolt"
+)
+
+// boltOpenTimeout is the duration to wait for the lock on Bolt-database.
+const boltOpenTimeout = 5 * time.Second
+
+// Storage is the Aggregate-state storage, along with the metadata
+// stored with it.
+type Storage struct {
+	Items     repository.ItemRepository
+	Shipments repository.ShipmentRepository
+	// Processed stores the results of processed Commands, and HWMs stores
+	// the HighWaterMark for building Aggregate-state incrementally. These
+	// are kept in same backend as the Aggregate-state, so the state and its
+	// metadata are lost or restored together.
+	Processed repository.ProcessedCommandRepository
+	HWMs      repository.HWMRepository
+
+	// db is the Bolt-database, and is nil for other backends.
+	db *bolt.DB
+}
+
+// Close closes the Bolt-database, if used. Mongo-connection is
+// closed separately, since it is also used for other service-state.
+func (s *Storage) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// StorageBackend returns the backend set in STORAGE_BACKEND, which
+// defaults to Mongo.
+//
+// The Event-metadata of go-agg-builder, and the outbox, audit, parked-Event
+// and Snapshot stores are kept in Mongo with either backend.
+func StorageBackend() (string, error) {
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend == "" {
+		log.Printf("A default value of %s will be used for STORAGE_BACKEND", StorageMongo)
+		backend = StorageMongo
+	}
+
+	switch backend {
+	case StorageMongo, StorageBolt:
+		return backend, nil
+	}
+	return "", fmt.Errorf("unknown STORAGE_BACKEND: %s", backend)
+}
+
+// LoadStorage creates the Aggregate-state storage using the backend
+// returned by StorageBackend.
+func LoadStorage(backend string, mc *builder.MongoConfig) (*Storage, error) {
+	switch backend {
+	case StorageMongo:
+		return loadMongoStorage(mc)
+	case StorageBolt:
+		return loadBoltStorage()
+	}
+	return nil, fmt.Errorf("unsupported storage-backend: %s", backend)
+}
+
+func loadMongoStorage(mc *builder.MongoConfig) (*Storage, error) {
+	shipmentColl, err := LoadShipmentCollection(mc)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing Shipment-Collection")
+		return nil, err
+	}
+	processedColl, err := LoadProcessedCmdCollection(mc)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing ProcessedCmd-Collection")
+		return nil, err
+	}
+	hwmColl, err := LoadHWMCollection(mc)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing HWM-Collection")
+		return nil, err
+	}
+
+	items, err := repository.NewMongoItemRepository(mc.AggCollection)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing Item-Repository")
+		return nil, err
+	}
+	shipments, err := repository.NewMongoShipmentRepository(shipmentColl)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing Shipment-Repository")
+		return nil, err
+	}
+	processed, err := repository.NewMongoProcessedCommandRepository(processedColl)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing ProcessedCmd-Repository")
+		return nil, err
+	}
+	hwms, err := repository.NewMongoHWMRepository(hwmColl)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing HWM-Repository")
+		return nil, err
+	}
+
+	return &Storage{
+		Items:     items,
+		Shipments: shipments,
+		Processed: processed,
+		HWMs:      hwms,
+	}, nil
+}
+
+// loadBoltStorage opens the Bolt-database at BOLT_DB_PATH, creating
+// it if it does not exist.
+func loadBoltStorage() (*Storage, error) {
+	dbPath := os.Getenv("BOLT_DB_PATH")
+	if dbPath == "" {
+		return nil, errors.New("BOLT_DB_PATH is required for bolt STORAGE_BACKEND")
+	}
+	// The database is locked by the instance using it, so a second
+	// instance fails instead of waiting indefinitely
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{
+		Timeout: boltOpenTimeout,
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "Error opening Bolt-database at %s", dbPath)
+		return nil, err
+	}
+
+	storage, err := newBoltStorage(db)
+	if err != nil {
+		closeErr := db.Close()
+		if closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "Error closing Bolt-database")
+			log.Println(closeErr)
+		}
+		return nil, err
+	}
+	return storage, nil
+}
+
+func newBoltStorage(db *bolt.DB) (*Storage, error) {
+	items, err := repository.NewBoltItemRepository(db)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing Item-Repository")
+		return nil, err
+	}
+	shipments, err := repository.NewBoltShipmentRepository(db)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing Shipment-Repository")
+		return nil, err
+	}
+	processed, err := repository.NewBoltProcessedCommandRepository(db)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing ProcessedCmd-Repository")
+		return nil, err
+	}
+	hwms, err := repository.NewBoltHWMRepository(db)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing HWM-Repository")
+		return nil, err
+	}
+
+	return &Storage{
+		Items:     items,
+		Shipments: shipments,
+		Processed: processed,
+		HWMs:      hwms,
+		db:        db,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package domain
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+// EventApplier applies an Event on Aggregate-state.
+type EventApplier func(
+	items repository.ItemRepository,
+	shipments repository.ShipmentRepository,
+	event *cmodel.Event,
+) error
+
+// applierKey identifies an EventApplier. version is 0 for the
+// EventApplier used for all Versions of an Action.
+type applierKey struct {
+	action  string
+	version int64
+}
+
+// appliers are the EventAppliers by Event-action and optionally Event-version.
+// Event-version is the version of the Item or Shipment the Event changed,
+// and not of the Event-schema, so most appliers are registered for all
+// versions. Changes to Event-schema are instead handled by upcasting the
+// historical Events, as in model.UpcastEvent.
+var (
+	applierLock sync.RWMutex
+	appliers    = map[applierKey]EventApplier{}
+)
+
+func init() {
+	itemApplier := func(fn func(repository.ItemRepository, *cmodel.Event) error) EventApplier {
+		return func(
+			items repository.ItemRepository,
+			_ repository.ShipmentRepository,
+			event *cmodel.Event,
+		) error {
+			return fn(items, event)
+		}
+	}
+	shipmentApplier := func(fn func(repository.ShipmentRepository, *cmodel.Event) error) EventApplier {
+		return func(
+			_ repository.ItemRepository,
+			shipments repository.ShipmentRepository,
+			event *cmodel.Event,
+		) error {
+			return fn(shipments, event)
+		}
+	}
+
+	builtinAppliers := map[string]EventApplier{
+		model.EventItemAdded:               itemApplier(itemAdded),
+		model.EventItemUpdated:             itemApplier(itemUpdated),
+		model.EventItemDeleted:             itemApplier(itemDeleted),
+		model.EventShipmentCreated:         shipmentApplier(shipmentCreated),
+		model.EventItemAddedToShipment:     itemAddedToShipment,
+		model.EventItemRemovedFromShipment: itemRemovedFromShipment,
+		model.EventShipmentDispatched:      shipmentApplier(shipmentStatusUpdated),
+		model.EventShipmentArrived:         shipmentApplier(shipmentStatusUpdated),
+		model.EventShipmentInspected:       shipmentApplier(shipmentStatusUpdated),
+		model.EventShipmentReceived:        shipmentApplier(shipmentStatusUpdated),
+		model.EventShipmentClosed:          shipmentApplier(shipmentStatusUpdated),
+		model.EventShipmentRejected:        shipmentApplier(shipmentStatusUpdated),
+		model.EventShipmentCancelled:       shipmentApplier(shipmentStatusUpdated),
+	}
+	for action, applier := range builtinAppliers {
+		err := RegisterApplier(action, applier)
+		if err != nil {
+			panic(errors.Wrap(err, "Error registering built-in EventApplier"))
+		}
+	}
+}
+
+// RegisterApplier registers the EventApplier for Events with specified
+// Action, regardless of their Version. An Action can only be registered once.
+func RegisterApplier(action string, applier EventApplier) error {
+	return registerApplier(applierKey{action, 0}, applier)
+}
+
+// RegisterVersionedApplier registers the EventApplier for Events with
+// specified Action and Version. This takes precedence over the EventApplier
+// registered using RegisterApplier, which is used for all other Versions.
+// An Action and Version can only be registered once.
+func RegisterVersionedApplier(action string, version int64, applier EventApplier) error {
+	if version <= 0 {
+		return errors.New("version must be greater than 0")
+	}
+	return registerApplier(applierKey{action, version}, applier)
+}
+
+func registerApplier(key applierKey, applier EventApplier) error {
+	if key.action == "" {
+		return errors.New("action cannot be blank")
+	}
+	if applier == nil {
+		return errors.New("applier cannot be nil")
+	}
+
+	applierLock.Lock()
+	defer applierLock.Unlock()
+
+	if _, exists := appliers[key]; exists {
+		if key.version == 0 {
+			return fmt.Errorf("Action %s is already registered", key.action)
+		}
+		return fmt.Errorf("Action %s with version %d is already registered", key.action, key.version)
+	}
+	appliers[key] = applier
+	return nil
+}
+
+// registeredApplier returns the EventApplier for the Event, which is
+// the one registered for its Version if any, or else for all Versions.
+func registeredApplier(event *cmodel.Event) (EventApplier, bool) {
+	applierLock.RLock()
+	defer applierLock.RUnlock()
+
+	applier, exists := appliers[applierKey{event.Action, event.Version}]
+	if exists {
+		return applier, true
+	}
+	applier, exists = appliers[applierKey{event.Action, 0}]
+	return applier, exists
+}
+
+// unknownEventError is returned when no EventApplier is registered for an Event.
+type unknownEventError struct {
+	action string
+}
+
+func (e *unknownEventError) Error() string {
+	return fmt.Sprintf("Event contains unregistered Action: %s", e.action)
+}
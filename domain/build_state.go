@@ -1,10 +1,10 @@
 package domain
 
 import (
-	"log"
-
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
 	"github.com/TerrexTech/go-agg-builder/builder"
-	"github.com/TerrexTech/go-mongoutils/mongo"
+	cmodel "github.com/TerrexTech/go-common-models/model"
 	"github.com/TerrexTech/uuuid"
 	"github.com/pkg/errors"
 )
@@ -15,55 +15,62 @@ type BuilderFunc func(
 	timeoutSec int,
 ) (<-chan *builder.EventResponse, error)
 
-// BuildState builds Aggregate-State by applying previous Events.
-func BuildState(coll *mongo.Collection, builderFunc BuilderFunc, timeoutSec int) error {
-	cid, err := uuuid.NewV4()
+// BuildState builds Aggregate-State once by applying all previous Events.
+// The config is same as for StateBuilder, except that Incremental is not
+// used. Events with no registered EventApplier are handled as per
+// config.UnknownEvents, same as by StateBuilder.
+func BuildState(config *StateBuilderConfig) (*BuildStats, error) {
+	buildConfig := *config
+	buildConfig.Incremental = false
+	b, err := NewStateBuilder(&buildConfig)
+	if err != nil {
+		err = errors.Wrap(err, "Error creating StateBuilder")
+		return nil, err
+	}
+	return b.build()
+}
+
+// fetchEvents requests the Event-stream for building Aggregate-state.
+func fetchEvents(
+	builderFunc BuilderFunc,
+	timeoutSec int,
+	idGen model.IDGenerator,
+) (<-chan *builder.EventResponse, error) {
+	cid, err := idGen.NewID()
 	if err != nil {
 		err = errors.Wrap(err, "Error generating CorrelationID")
-		return err
+		return nil, err
 	}
 	eventRespChan, err := builderFunc(cid, timeoutSec)
 	if err != nil {
 		err = errors.Wrap(err, "Failed to build Aggregate-state from Event-stream")
-		return err
+		return nil, err
 	}
+	return eventRespChan, nil
+}
 
-	for eventResp := range eventRespChan {
-		if eventResp == nil {
-			continue
-		}
-		if eventResp.Error != nil {
-			err = errors.Wrap(err, "BuildState: Error in EventResp")
-			log.Println(err)
-		}
-
-		event := &eventResp.Event
-		switch event.Action {
-		case "ItemAdded":
-			err := itemAdded(coll, event)
-			if err != nil {
-				err = errors.Wrap(err, "Error adding item")
-				log.Println(err)
-			}
-
-		case "ItemUpdated":
-			err := itemUpdated(coll, event)
-			if err != nil {
-				err = errors.Wrap(err, "Error updating item")
-				log.Println(err)
-			}
-
-		case "ItemDeleted":
-			err := itemDeleted(coll, event)
-			if err != nil {
-				err = errors.Wrap(err, "Error deleting item")
-				log.Println(err)
-			}
+// applyEvent applies the Event on Aggregate-state using its registered
+// EventApplier. An unknownEventError is returned if no EventApplier is
+// registered for the Event.
+func applyEvent(
+	items repository.ItemRepository,
+	shipments repository.ShipmentRepository,
+	event *cmodel.Event,
+) error {
+	err := model.UpcastEvent(event)
+	if err != nil {
+		return errors.Wrap(err, "Error upcasting Event")
+	}
 
-		default:
-			log.Printf("Event contains unregistered Action: %s", event.Action)
+	applier, isRegistered := registeredApplier(event)
+	if !isRegistered {
+		return &unknownEventError{
+			action: event.Action,
 		}
 	}
-
+	err = applier(items, shipments, event)
+	if err != nil {
+		return errors.Wrapf(err, "Error applying %s Event", event.Action)
+	}
 	return nil
 }
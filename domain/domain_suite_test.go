@@ -2,10 +2,13 @@ package domain
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/TerrexTech/go-agg-builder/builder"
 	cmodel "github.com/TerrexTech/go-common-models/model"
 	"github.com/TerrexTech/go-commonutils/commonutil"
 	"github.com/joho/godotenv"
@@ -13,6 +16,7 @@ import (
 
 	"github.com/TerrexTech/agg-shipment-cmd/connutil"
 	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
 	"github.com/TerrexTech/go-mongoutils/mongo"
 	"github.com/TerrexTech/uuuid"
 	. "github.com/onsi/ginkgo"
@@ -50,6 +54,11 @@ func TestEvent(t *testing.T) {
 		"MONGO_DATABASE",
 		"MONGO_AGG_COLLECTION",
 		"MONGO_META_COLLECTION",
+		"MONGO_SHIPMENT_COLLECTION",
+		"MONGO_PROCESSED_CMD_COLLECTION",
+		"MONGO_HWM_COLLECTION",
+		"MONGO_SNAPSHOT_COLLECTION",
+		"MONGO_PARKED_EVENT_COLLECTION",
 
 		"MONGO_CONNECTION_TIMEOUT_MS",
 	)
@@ -63,15 +72,683 @@ func TestEvent(t *testing.T) {
 	RunSpecs(t, "EventHandler Suite")
 }
 
+// manualClock is a Clock whose time only changes when advanced.
+type manualClock struct {
+	time time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	return c.time
+}
+
+// fixedIDGenerator is an IDGenerator which always returns the same ID.
+type fixedIDGenerator struct {
+	id uuuid.UUID
+}
+
+func (g fixedIDGenerator) NewID() (uuuid.UUID, error) {
+	return g.id, nil
+}
+
 var _ = Describe("EventHandler", func() {
 	var (
-		coll *mongo.Collection
+		coll         *mongo.Collection
+		shipmentColl *mongo.Collection
+		snapshotColl *mongo.Collection
+		chunkColl    *mongo.Collection
+		parkedColl   *mongo.Collection
+
+		itemRepo     repository.ItemRepository
+		shipmentRepo repository.ShipmentRepository
+		hwmRepo      repository.HWMRepository
 	)
 
 	BeforeSuite(func() {
 		mc, err := connutil.LoadMongoConfig()
 		Expect(err).ToNot(HaveOccurred())
 		coll = mc.AggCollection
+
+		shipmentColl, err = connutil.LoadShipmentCollection(mc)
+		Expect(err).ToNot(HaveOccurred())
+		hwmColl, err := connutil.LoadHWMCollection(mc)
+		Expect(err).ToNot(HaveOccurred())
+		hwmRepo, err = repository.NewMongoHWMRepository(hwmColl)
+		Expect(err).ToNot(HaveOccurred())
+		snapshotColl, err = connutil.LoadSnapshotCollection(mc)
+		Expect(err).ToNot(HaveOccurred())
+		chunkColl, err = connutil.LoadSnapshotChunkCollection(mc)
+		Expect(err).ToNot(HaveOccurred())
+		parkedColl, err = connutil.LoadParkedEventCollection(mc)
+		Expect(err).ToNot(HaveOccurred())
+
+		itemRepo, err = repository.NewMongoItemRepository(coll)
+		Expect(err).ToNot(HaveOccurred())
+		shipmentRepo, err = repository.NewMongoShipmentRepository(shipmentColl)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Describe("Snapshotter", func() {
+		It("should calculate same checksum regardless of order", func() {
+			items := []model.Item{
+				model.Item{ItemID: "item-1"},
+				model.Item{ItemID: "item-2"},
+			}
+			shipments := []model.Shipment{
+				model.Shipment{ShipmentID: "shipment-1"},
+				model.Shipment{ShipmentID: "shipment-2"},
+			}
+			checksum, err := stateChecksum(items, shipments)
+			Expect(err).ToNot(HaveOccurred())
+
+			reversedItems := []model.Item{items[1], items[0]}
+			reversedShipments := []model.Shipment{shipments[1], shipments[0]}
+			reversedChecksum, err := stateChecksum(reversedItems, reversedShipments)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reversedChecksum).To(Equal(checksum))
+
+			items[0].Lot = "test-lot"
+			changedChecksum, err := stateChecksum(items, shipments)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changedChecksum).ToNot(Equal(checksum))
+		})
+
+		It("should take Snapshot of current Aggregate-state", func() {
+			stateBuilder, err := NewStateBuilder(&StateBuilderConfig{
+				Items:     itemRepo,
+				Shipments: shipmentRepo,
+				BuilderFunc: func(uuuid.UUID, int) (<-chan *builder.EventResponse, error) {
+					return nil, nil
+				},
+				TimeoutSec:  5,
+				Incremental: true,
+				HWMs:        hwmRepo,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			snapshotter, err := NewSnapshotter(&SnapshotterConfig{
+				StateBuilder: stateBuilder,
+				SnapshotColl: snapshotColl,
+				ChunkColl:    chunkColl,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			snapshot, err := snapshotter.Take()
+			Expect(err).ToNot(HaveOccurred())
+			checksum, err := stateChecksum(snapshot.Items, snapshot.Shipments)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshot.Checksum).To(Equal(checksum))
+
+			latest, err := snapshotter.Latest()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(latest.SnapshotID).To(Equal(snapshot.SnapshotID))
+			latestChecksum, err := stateChecksum(latest.Items, latest.Shipments)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(latestChecksum).To(Equal(snapshot.Checksum))
+		})
+
+		It("should split Snapshot into chunks within size-limit", func() {
+			name := strings.Repeat("n", snapshotChunkBytes/4)
+			items := []model.Item{}
+			for i := 0; i < 10; i++ {
+				items = append(items, model.Item{
+					ItemID: fmt.Sprintf("item-%d", i),
+					Name:   name,
+				})
+			}
+			snapshot := &model.Snapshot{
+				SnapshotID: "test-snapshot",
+				Items:      items,
+				Shipments: []model.Shipment{
+					model.Shipment{ShipmentID: "shipment-1"},
+				},
+			}
+
+			chunks, err := snapshotChunks(snapshot)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(chunks)).To(BeNumerically(">", 1))
+
+			chunkedItems := []model.Item{}
+			chunkedShipments := []model.Shipment{}
+			for i, chunk := range chunks {
+				Expect(chunk.SnapshotID).To(Equal(snapshot.SnapshotID))
+				Expect(chunk.Chunk).To(Equal(i + 1))
+				marshalChunk, err := json.Marshal(chunk)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(len(marshalChunk)).To(BeNumerically("<", snapshotChunkBytes))
+
+				chunkedItems = append(chunkedItems, chunk.Items...)
+				chunkedShipments = append(chunkedShipments, chunk.Shipments...)
+			}
+			Expect(chunkedItems).To(Equal(snapshot.Items))
+			Expect(chunkedShipments).To(Equal(snapshot.Shipments))
+		})
+
+		It("should create a chunk for empty Aggregate-state", func() {
+			chunks, err := snapshotChunks(&model.Snapshot{SnapshotID: "test-snapshot"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(chunks).To(HaveLen(1))
+			Expect(chunks[0].Chunk).To(Equal(1))
+		})
+	})
+
+	Describe("StateBuilder", func() {
+		var (
+			mockEvent   *cmodel.Event
+			builderFunc BuilderFunc
+		)
+
+		BeforeEach(func() {
+			shipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			marshalShipment, err := json.Marshal(model.Shipment{
+				ShipmentID: shipmentID.String(),
+				Carrier:    "test-carrier",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			eventID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+
+			mockEvent = &cmodel.Event{
+				Action:      "ShipmentCreated",
+				AggregateID: 2,
+				Data:        marshalShipment,
+				NanoTime:    time.Now().UTC().UnixNano(),
+				Source:      "test-source",
+				UUID:        eventID,
+				Version:     1,
+				YearBucket:  2018,
+			}
+			builderFunc = func(uuuid.UUID, int) (<-chan *builder.EventResponse, error) {
+				eventRespChan := make(chan *builder.EventResponse, 1)
+				eventRespChan <- &builder.EventResponse{
+					Event: *mockEvent,
+				}
+				close(eventRespChan)
+				return eventRespChan, nil
+			}
+		})
+
+		It("should only apply Events newer than HighWaterMark", func() {
+			stateBuilder, err := NewStateBuilder(&StateBuilderConfig{
+				Items:       itemRepo,
+				Shipments:   shipmentRepo,
+				BuilderFunc: builderFunc,
+				TimeoutSec:  5,
+				Incremental: true,
+				HWMs:        hwmRepo,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			stats, err := stateBuilder.Build()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats.EventsApplied).To(Equal(1))
+
+			stateBuilder.MarkDirty()
+			stats, err = stateBuilder.Build()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats.Skipped).To(BeFalse())
+			Expect(stats.EventsApplied).To(Equal(0))
+			Expect(stats.EventsSkipped).To(Equal(1))
+
+			builderStats := stateBuilder.Stats()
+			Expect(builderStats.Builds).To(Equal(int64(2)))
+			Expect(builderStats.EventsApplied).To(Equal(int64(1)))
+		})
+
+		It("should skip build if no Events were produced within MinInterval", func() {
+			stateBuilder, err := NewStateBuilder(&StateBuilderConfig{
+				Items:       itemRepo,
+				Shipments:   shipmentRepo,
+				BuilderFunc: builderFunc,
+				TimeoutSec:  5,
+				Incremental: true,
+				HWMs:        hwmRepo,
+				MinInterval: time.Minute,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			stats, err := stateBuilder.Build()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats.Skipped).To(BeFalse())
+
+			stats, err = stateBuilder.Build()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats.Skipped).To(BeTrue())
+			Expect(stateBuilder.Stats().SkippedBuilds).To(Equal(int64(1)))
+		})
+
+		It("should not skip build once MinInterval has passed", func() {
+			clock := &manualClock{
+				time: time.Now(),
+			}
+			stateBuilder, err := NewStateBuilder(&StateBuilderConfig{
+				Items:       itemRepo,
+				Shipments:   shipmentRepo,
+				BuilderFunc: builderFunc,
+				TimeoutSec:  5,
+				Incremental: true,
+				HWMs:        hwmRepo,
+				MinInterval: time.Minute,
+				Clock:       clock,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			stats, err := stateBuilder.Build()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats.Skipped).To(BeFalse())
+
+			clock.time = clock.time.Add(time.Minute + time.Second)
+			stats, err = stateBuilder.Build()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats.Skipped).To(BeFalse())
+		})
+
+		It("should keep HighWaterMark monotonic", func() {
+			hwm := &model.HighWaterMark{}
+			markApplied(hwm, mockEvent, time.Minute)
+
+			lateEvent := *mockEvent
+			lateEventID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			lateEvent.UUID = lateEventID
+			lateEvent.NanoTime = mockEvent.NanoTime - time.Second.Nanoseconds()
+			markApplied(hwm, &lateEvent, time.Minute)
+
+			Expect(hwm.NanoTime).To(Equal(mockEvent.NanoTime))
+			Expect(hwm.EventUUID).To(Equal(mockEvent.UUID.String()))
+			Expect(isApplied(hwm, &lateEvent, time.Minute)).To(BeTrue())
+		})
+
+		It("should apply late Events within late-window", func() {
+			hwm := &model.HighWaterMark{}
+			markApplied(hwm, mockEvent, time.Minute)
+			Expect(isApplied(hwm, mockEvent, time.Minute)).To(BeTrue())
+
+			lateEvent := *mockEvent
+			lateEventID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			lateEvent.UUID = lateEventID
+			lateEvent.NanoTime = mockEvent.NanoTime - time.Second.Nanoseconds()
+			Expect(isApplied(hwm, &lateEvent, time.Minute)).To(BeFalse())
+
+			lateEvent.NanoTime = mockEvent.NanoTime - 2*time.Minute.Nanoseconds()
+			Expect(isApplied(hwm, &lateEvent, time.Minute)).To(BeTrue())
+		})
+
+		It("should not advance HighWaterMark when Event fails to apply", func() {
+			mockEvent.Action = model.EventItemAddedToShipment
+			mockEvent.Data = []byte("invalid-data")
+			stateBuilder, err := NewStateBuilder(&StateBuilderConfig{
+				Items:       itemRepo,
+				Shipments:   shipmentRepo,
+				BuilderFunc: builderFunc,
+				TimeoutSec:  5,
+				Incremental: true,
+				HWMs:        hwmRepo,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			stats, err := stateBuilder.Build()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats.EventsApplied).To(Equal(0))
+			Expect(isApplied(stateBuilder.hwm, mockEvent, time.Minute)).To(BeFalse())
+		})
+
+		It("should fail build on unknown Event if configured", func() {
+			mockEvent.Action = "TestUnknownEvent"
+			stateBuilder, err := NewStateBuilder(&StateBuilderConfig{
+				Items:         itemRepo,
+				Shipments:     shipmentRepo,
+				BuilderFunc:   builderFunc,
+				TimeoutSec:    5,
+				UnknownEvents: FailOnUnknownEvents,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = stateBuilder.Build()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should park unknown Event if configured", func() {
+			mockEvent.Action = "TestUnknownEvent"
+			stateBuilder, err := NewStateBuilder(&StateBuilderConfig{
+				Items:         itemRepo,
+				Shipments:     shipmentRepo,
+				BuilderFunc:   builderFunc,
+				TimeoutSec:    5,
+				UnknownEvents: ParkUnknownEvents,
+				ParkedColl:    parkedColl,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			stats, err := stateBuilder.Build()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats.EventsUnknown).To(Equal(1))
+
+			result, err := parkedColl.FindOne(map[string]interface{}{
+				"eventUUID": mockEvent.UUID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			parkedEvent, assertOK := result.(*model.ParkedEvent)
+			Expect(assertOK).To(BeTrue())
+			Expect(parkedEvent.Action).To(Equal("TestUnknownEvent"))
+		})
+
+		It("should apply unknown-Event policy when building state once", func() {
+			mockEvent.Action = "TestUnknownEvent"
+			_, err := BuildState(&StateBuilderConfig{
+				Items:         itemRepo,
+				Shipments:     shipmentRepo,
+				BuilderFunc:   builderFunc,
+				TimeoutSec:    5,
+				UnknownEvents: FailOnUnknownEvents,
+			})
+			Expect(err).To(HaveOccurred())
+
+			stats, err := BuildState(&StateBuilderConfig{
+				Items:       itemRepo,
+				Shipments:   shipmentRepo,
+				BuilderFunc: builderFunc,
+				TimeoutSec:  5,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats.EventsUnknown).To(Equal(1))
+		})
+
+		It("should use IDGen for the CorrelationID when building state once", func() {
+			cid, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+
+			var requestedCID uuuid.UUID
+			_, err = BuildState(&StateBuilderConfig{
+				Items:     itemRepo,
+				Shipments: shipmentRepo,
+				BuilderFunc: func(id uuuid.UUID, timeoutSec int) (<-chan *builder.EventResponse, error) {
+					requestedCID = id
+					return builderFunc(id, timeoutSec)
+				},
+				TimeoutSec: 5,
+				IDGen:      fixedIDGenerator{cid},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requestedCID).To(Equal(cid))
+		})
+
+		It("should require ParkedColl when parking unknown Events", func() {
+			_, err := NewStateBuilder(&StateBuilderConfig{
+				Items:         itemRepo,
+				Shipments:     shipmentRepo,
+				BuilderFunc:   builderFunc,
+				TimeoutSec:    5,
+				UnknownEvents: ParkUnknownEvents,
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("EventApplier Registry", func() {
+		It("should return error when registering existing action", func() {
+			err := RegisterApplier(model.EventItemAdded, func(
+				repository.ItemRepository, repository.ShipmentRepository, *cmodel.Event,
+			) error {
+				return nil
+			})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should apply Events with same EventApplier regardless of Version", func() {
+			appliedVersions := []int64{}
+			err := RegisterApplier("TestAnyVersionEvent", func(
+				_ repository.ItemRepository,
+				_ repository.ShipmentRepository,
+				event *cmodel.Event,
+			) error {
+				appliedVersions = append(appliedVersions, event.Version)
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, version := range []int64{1, 2, 7} {
+				err = applyEvent(itemRepo, shipmentRepo, &cmodel.Event{
+					Action:  "TestAnyVersionEvent",
+					Version: version,
+				})
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(appliedVersions).To(Equal([]int64{1, 2, 7}))
+		})
+
+		It("should prefer EventApplier registered for Event-version", func() {
+			applied := []string{}
+			applier := func(name string) EventApplier {
+				return func(
+					_ repository.ItemRepository,
+					_ repository.ShipmentRepository,
+					_ *cmodel.Event,
+				) error {
+					applied = append(applied, name)
+					return nil
+				}
+			}
+			err := RegisterApplier("TestVersionedEvent", applier("any"))
+			Expect(err).ToNot(HaveOccurred())
+			err = RegisterVersionedApplier("TestVersionedEvent", 2, applier("v2"))
+			Expect(err).ToNot(HaveOccurred())
+			err = RegisterVersionedApplier("TestVersionedEvent", 2, applier("v2"))
+			Expect(err).To(HaveOccurred())
+			err = RegisterVersionedApplier("TestVersionedEvent", 0, applier("v0"))
+			Expect(err).To(HaveOccurred())
+
+			for _, version := range []int64{1, 2, 3} {
+				err = applyEvent(itemRepo, shipmentRepo, &cmodel.Event{
+					Action:  "TestVersionedEvent",
+					Version: version,
+				})
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(applied).To(Equal([]string{"any", "v2", "any"}))
+		})
+
+		It("should return unknownEventError for unregistered action", func() {
+			err := applyEvent(itemRepo, shipmentRepo, &cmodel.Event{
+				Action: "TestUnknownEvent",
+			})
+			_, isUnknown := err.(*unknownEventError)
+			Expect(isUnknown).To(BeTrue())
+		})
+	})
+
+	Describe("ShipmentCreated", func() {
+		It("should insert shipment", func() {
+			shipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			mockShipment := model.Shipment{
+				ShipmentID:      shipmentID.String(),
+				Carrier:         "test-carrier",
+				Destination:     "test-destination",
+				ExpectedArrival: time.Now().UTC().Unix(),
+				Origin:          "test-origin",
+				Timestamp:       time.Now().UTC().Unix(),
+				TrackingNumber:  "test-tracking",
+			}
+			marshalShipment, err := json.Marshal(mockShipment)
+			Expect(err).ToNot(HaveOccurred())
+
+			mockEvent := &cmodel.Event{
+				Action:      "ShipmentCreated",
+				AggregateID: 2,
+				Data:        marshalShipment,
+				NanoTime:    time.Now().UTC().UnixNano(),
+				Source:      "test-source",
+				Version:     1,
+				YearBucket:  2018,
+			}
+
+			err = shipmentCreated(shipmentRepo, mockEvent)
+			Expect(err).ToNot(HaveOccurred())
+
+			result, err := shipmentColl.FindOne(model.Shipment{
+				ShipmentID: mockShipment.ShipmentID,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			findShipment, assertOK := result.(*model.Shipment)
+			Expect(assertOK).To(BeTrue())
+			Expect(*findShipment).To(Equal(mockShipment))
+		})
+	})
+
+	Describe("ItemAddedToShipment and ItemRemovedFromShipment", func() {
+		It("should link and unlink item and shipment", func() {
+			shipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = shipmentColl.InsertOne(model.Shipment{
+				ShipmentID: shipmentID.String(),
+				Carrier:    "test-carrier",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = coll.InsertOne(model.Item{
+				ItemID: itemID.String(),
+				Lot:    itemID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			marshalParams, err := json.Marshal(model.ShipmentItemData{
+				ShipmentID: shipmentID.String(),
+				ItemID:     itemID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			mockEvent := &cmodel.Event{
+				Action:      "ItemAddedToShipment",
+				AggregateID: 2,
+				Data:        marshalParams,
+				NanoTime:    time.Now().UTC().UnixNano(),
+				Source:      "test-source",
+				Version:     1,
+				YearBucket:  2018,
+			}
+
+			err = itemAddedToShipment(itemRepo, shipmentRepo, mockEvent)
+			Expect(err).ToNot(HaveOccurred())
+
+			result, err := shipmentColl.FindOne(model.Shipment{
+				ShipmentID: shipmentID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			findShipment, assertOK := result.(*model.Shipment)
+			Expect(assertOK).To(BeTrue())
+			Expect(findShipment.ItemIDs).To(ConsistOf(itemID.String()))
+
+			result, err = coll.FindOne(model.Item{
+				ItemID: itemID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			findItem, assertOK := result.(*model.Item)
+			Expect(assertOK).To(BeTrue())
+			Expect(findItem.ShipmentID).To(Equal(shipmentID.String()))
+
+			mockEvent.Action = "ItemRemovedFromShipment"
+			err = itemRemovedFromShipment(itemRepo, shipmentRepo, mockEvent)
+			Expect(err).ToNot(HaveOccurred())
+
+			result, err = shipmentColl.FindOne(model.Shipment{
+				ShipmentID: shipmentID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			findShipment, assertOK = result.(*model.Shipment)
+			Expect(assertOK).To(BeTrue())
+			Expect(findShipment.ItemIDs).To(BeEmpty())
+		})
+
+		It("should set the Item version from ItemVersion", func() {
+			shipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = shipmentColl.InsertOne(model.Shipment{
+				ShipmentID: shipmentID.String(),
+				Carrier:    "test-carrier",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = coll.InsertOne(model.Item{
+				ItemID:  itemID.String(),
+				Lot:     itemID.String(),
+				Version: 1,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			marshalParams, err := json.Marshal(model.ShipmentItemData{
+				ShipmentID:  shipmentID.String(),
+				ItemID:      itemID.String(),
+				Version:     1,
+				ItemVersion: 2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			mockEvent := &cmodel.Event{
+				Action:      "ItemAddedToShipment",
+				AggregateID: 2,
+				Data:        marshalParams,
+				NanoTime:    time.Now().UTC().UnixNano(),
+				Source:      "test-source",
+				Version:     1,
+				YearBucket:  2018,
+			}
+
+			err = itemAddedToShipment(itemRepo, shipmentRepo, mockEvent)
+			Expect(err).ToNot(HaveOccurred())
+
+			result, err := coll.FindOne(model.Item{
+				ItemID: itemID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			findItem, assertOK := result.(*model.Item)
+			Expect(assertOK).To(BeTrue())
+			Expect(findItem.Version).To(Equal(int64(2)))
+		})
+	})
+
+	Describe("ShipmentStatusUpdated", func() {
+		It("should update shipment-status", func() {
+			shipmentID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = shipmentColl.InsertOne(model.Shipment{
+				ShipmentID: shipmentID.String(),
+				Carrier:    "test-carrier",
+				Status:     model.ShipmentInTransit,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			arrival := time.Now().UTC().Unix()
+			marshalParams, err := json.Marshal(model.ShipmentStatusData{
+				ShipmentID:    shipmentID.String(),
+				ActualArrival: arrival,
+				Status:        model.ShipmentArrived,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			mockEvent := &cmodel.Event{
+				Action:      "ShipmentArrived",
+				AggregateID: 2,
+				Data:        marshalParams,
+				NanoTime:    time.Now().UTC().UnixNano(),
+				Source:      "test-source",
+				Version:     1,
+				YearBucket:  2018,
+			}
+
+			err = shipmentStatusUpdated(shipmentRepo, mockEvent)
+			Expect(err).ToNot(HaveOccurred())
+
+			result, err := shipmentColl.FindOne(model.Shipment{
+				ShipmentID: shipmentID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			findShipment, assertOK := result.(*model.Shipment)
+			Expect(assertOK).To(BeTrue())
+			Expect(findShipment.Status).To(Equal(model.ShipmentArrived))
+			Expect(findShipment.ActualArrival).To(Equal(arrival))
+		})
 	})
 
 	Describe("ItemDeleted", func() {
@@ -107,12 +784,45 @@ var _ = Describe("EventHandler", func() {
 				YearBucket:    2018,
 			}
 
-			err = itemDeleted(coll, mockEvent)
+			err = itemDeleted(itemRepo, mockEvent)
 			Expect(err).ToNot(HaveOccurred())
 
 			_, err = coll.FindOne(mockItem)
 			Expect(err).To(HaveOccurred())
 		})
+
+		It("should not delete items if filter is empty", func() {
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			mockItem := model.Item{
+				ItemID: itemID.String(),
+				Lot:    itemID.String(),
+			}
+			_, err = coll.InsertOne(mockItem)
+			Expect(err).ToNot(HaveOccurred())
+
+			cid, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			uuid, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			mockEvent := &cmodel.Event{
+				Action:        "ItemDeleted",
+				AggregateID:   1,
+				CorrelationID: cid,
+				Data:          []byte(`{"userUUID":"test-user"}`),
+				NanoTime:      time.Now().UTC().UnixNano(),
+				Source:        "test-source",
+				UUID:          uuid,
+				Version:       1,
+				YearBucket:    2018,
+			}
+
+			err = itemDeleted(itemRepo, mockEvent)
+			Expect(err).To(HaveOccurred())
+
+			_, err = coll.FindOne(mockItem)
+			Expect(err).ToNot(HaveOccurred())
+		})
 	})
 
 	Describe("ItemRegistered", func() {
@@ -157,7 +867,7 @@ var _ = Describe("EventHandler", func() {
 				YearBucket:    2018,
 			}
 
-			err = itemAdded(coll, mockEvent)
+			err = itemAdded(itemRepo, mockEvent)
 			Expect(err).ToNot(HaveOccurred())
 
 			result, err := coll.FindOne(mockItem)
@@ -167,6 +877,78 @@ var _ = Describe("EventHandler", func() {
 			Expect(assertOK).To(BeTrue())
 			Expect(mockItem).To(Equal(*findItem))
 		})
+
+		It("should apply historical event as ItemAdded", func() {
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			mockItem := model.Item{
+				ItemID:    itemID.String(),
+				Name:      "test-name",
+				SKU:       "test-sku",
+				Timestamp: time.Now().UTC().Unix(),
+			}
+
+			marshalItem, err := json.Marshal(mockItem)
+			Expect(err).ToNot(HaveOccurred())
+			cid, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			uuid, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+
+			mockEvent := &cmodel.Event{
+				Action:        "ItemRegistered",
+				AggregateID:   1,
+				CorrelationID: cid,
+				Data:          marshalItem,
+				NanoTime:      time.Now().UTC().UnixNano(),
+				Source:        "test-source",
+				UUID:          uuid,
+				Version:       1,
+				YearBucket:    2018,
+			}
+
+			err = applyEvent(itemRepo, shipmentRepo, mockEvent)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mockEvent.Action).To(Equal(model.EventItemAdded))
+
+			_, err = coll.FindOne(model.Item{
+				ItemID: itemID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Describe("ItemAdded", func() {
+		It("should skip Items which already exist", func() {
+			items := repository.NewMemoryItemRepository()
+			itemID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			err = items.Insert(&model.Item{
+				ItemID:  itemID.String(),
+				Name:    "updated-name",
+				Version: 2,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			marshalItem, err := json.Marshal(model.Item{
+				ItemID: itemID.String(),
+				Name:   "test-name",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = itemAdded(items, &cmodel.Event{
+				Action:  model.EventItemAdded,
+				Data:    marshalItem,
+				Version: 1,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			item, err := items.FindOne(&model.Item{
+				ItemID: itemID.String(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(item.Name).To(Equal("updated-name"))
+			Expect(item.Version).To(Equal(int64(2)))
+		})
 	})
 
 	Describe("ItemUpdated", func() {
@@ -182,7 +964,7 @@ var _ = Describe("EventHandler", func() {
 
 			newLot, err := uuuid.NewV4()
 			Expect(err).ToNot(HaveOccurred())
-			params := &updateParams{
+			params := &model.ItemUpdatedData{
 				Filter: map[string]interface{}{
 					"itemID": itemID.String(),
 				},
@@ -213,7 +995,7 @@ var _ = Describe("EventHandler", func() {
 				YearBucket:    2018,
 			}
 
-			err = itemUpdated(coll, mockEvent)
+			err = itemUpdated(itemRepo, mockEvent)
 			Expect(err).ToNot(HaveOccurred())
 
 			mockItem.Lot = newLot.String()
@@ -4,12 +4,12 @@ import (
 	"encoding/json"
 
 	model "github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
 	cmodel "github.com/TerrexTech/go-common-models/model"
-	"github.com/TerrexTech/go-mongoutils/mongo"
 	"github.com/pkg/errors"
 )
 
-func itemAdded(coll *mongo.Collection, event *cmodel.Event) error {
+func itemAdded(items repository.ItemRepository, event *cmodel.Event) error {
 	item := &model.Item{}
 	err := json.Unmarshal(event.Data, item)
 	if err != nil {
@@ -17,7 +17,20 @@ func itemAdded(coll *mongo.Collection, event *cmodel.Event) error {
 		return err
 	}
 
-	_, err = coll.InsertOne(item)
+	// The Item already exists if the Event was applied before, such as
+	// when replaying Events over existing Aggregate-state
+	_, err = items.FindOne(&model.Item{
+		ItemID: item.ItemID,
+	})
+	if err == nil {
+		return nil
+	}
+	if errors.Cause(err) != repository.ErrNotFound {
+		err = errors.Wrap(err, "Error finding existing Item")
+		return err
+	}
+
+	err = items.Insert(item)
 	if err != nil {
 		err = errors.Wrap(err, "Error Inserting Item into database")
 		return err
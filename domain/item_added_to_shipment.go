@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"encoding/json"
+
+	model "github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+func itemAddedToShipment(
+	items repository.ItemRepository,
+	shipments repository.ShipmentRepository,
+	event *cmodel.Event,
+) error {
+	params := &model.ShipmentItemData{}
+	err := json.Unmarshal(event.Data, params)
+	if err != nil {
+		err = errors.Wrap(err, "Error while unmarshalling Event-data")
+		return err
+	}
+
+	shipment, err := findShipment(shipments, params.ShipmentID)
+	if err != nil {
+		err = errors.Wrap(err, "Error finding Shipment")
+		return err
+	}
+	itemIDs := shipment.ItemIDs
+	for _, itemID := range itemIDs {
+		if itemID == params.ItemID {
+			return nil
+		}
+	}
+	itemIDs = append(itemIDs, params.ItemID)
+
+	update := map[string]interface{}{
+		"itemIDs": itemIDs,
+	}
+	if event.Version != 0 {
+		update["version"] = event.Version
+	}
+	err = shipments.Update(
+		map[string]interface{}{
+			"shipmentID": params.ShipmentID,
+		},
+		update,
+	)
+	if err != nil {
+		err = errors.Wrap(err, "Error Updating Shipment in database")
+		return err
+	}
+
+	itemUpdate := map[string]interface{}{
+		"shipmentID": params.ShipmentID,
+	}
+	if params.ItemVersion != 0 {
+		itemUpdate["version"] = params.ItemVersion
+	}
+	err = items.Update(
+		map[string]interface{}{
+			"itemID": params.ItemID,
+		},
+		itemUpdate,
+	)
+	if err != nil {
+		err = errors.Wrap(err, "Error Updating Item in database")
+		return err
+	}
+
+	return nil
+}
+
+func findShipment(
+	shipments repository.ShipmentRepository,
+	shipmentID string,
+) (*model.Shipment, error) {
+	return shipments.FindOne(&model.Shipment{
+		ShipmentID: shipmentID,
+	})
+}
@@ -3,21 +3,27 @@ package domain
 import (
 	"encoding/json"
 
-	"github.com/TerrexTech/go-common-models/model"
-
-	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
 	"github.com/pkg/errors"
 )
 
-func itemDeleted(coll *mongo.Collection, event *model.Event) error {
-	params := map[string]interface{}{}
-	err := json.Unmarshal(event.Data, &params)
+func itemDeleted(items repository.ItemRepository, event *cmodel.Event) error {
+	// Event-data might contain other Command-fields, which are not Item-fields
+	params := &model.Item{}
+	err := json.Unmarshal(event.Data, params)
 	if err != nil {
 		err = errors.Wrap(err, "Error while unmarshalling Event-data")
 		return err
 	}
+	// Event-data with only non-Item fields results in an empty
+	// filter, which would match all Items
+	if *params == (model.Item{}) {
+		return errors.New("empty filter in Event-data, no Items deleted")
+	}
 
-	_, err = coll.DeleteMany(params)
+	err = items.Delete(params)
 	if err != nil {
 		err = errors.Wrap(err, "Error Deleting Item from database")
 		return err
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"encoding/json"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+func itemRemovedFromShipment(
+	items repository.ItemRepository,
+	shipments repository.ShipmentRepository,
+	event *cmodel.Event,
+) error {
+	params := &model.ShipmentItemData{}
+	err := json.Unmarshal(event.Data, params)
+	if err != nil {
+		err = errors.Wrap(err, "Error while unmarshalling Event-data")
+		return err
+	}
+
+	shipment, err := findShipment(shipments, params.ShipmentID)
+	if err != nil {
+		err = errors.Wrap(err, "Error finding Shipment")
+		return err
+	}
+	itemIDs := []string{}
+	for _, itemID := range shipment.ItemIDs {
+		if itemID != params.ItemID {
+			itemIDs = append(itemIDs, itemID)
+		}
+	}
+
+	update := map[string]interface{}{
+		"itemIDs": itemIDs,
+	}
+	if event.Version != 0 {
+		update["version"] = event.Version
+	}
+	err = shipments.Update(
+		map[string]interface{}{
+			"shipmentID": params.ShipmentID,
+		},
+		update,
+	)
+	if err != nil {
+		err = errors.Wrap(err, "Error Updating Shipment in database")
+		return err
+	}
+
+	itemUpdate := map[string]interface{}{
+		"shipmentID": "",
+	}
+	if params.ItemVersion != 0 {
+		itemUpdate["version"] = params.ItemVersion
+	}
+	err = items.Update(
+		map[string]interface{}{
+			"itemID": params.ItemID,
+		},
+		itemUpdate,
+	)
+	if err != nil {
+		err = errors.Wrap(err, "Error Updating Item in database")
+		return err
+	}
+
+	return nil
+}
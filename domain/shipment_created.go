@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"encoding/json"
+
+	model "github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+func shipmentCreated(shipments repository.ShipmentRepository, event *cmodel.Event) error {
+	shipment := &model.Shipment{}
+	err := json.Unmarshal(event.Data, shipment)
+	if err != nil {
+		err = errors.Wrap(err, "Error while unmarshalling Event-data")
+		return err
+	}
+
+	err = shipments.Insert(shipment)
+	if err != nil {
+		err = errors.Wrap(err, "Error Inserting Shipment into database")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"encoding/json"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+func shipmentStatusUpdated(shipments repository.ShipmentRepository, event *cmodel.Event) error {
+	params := &model.ShipmentStatusData{}
+	err := json.Unmarshal(event.Data, params)
+	if err != nil {
+		err = errors.Wrap(err, "Error while unmarshalling Event-data")
+		return err
+	}
+	if params.Status == "" {
+		return errors.New("Event-data contains empty Status")
+	}
+
+	update := map[string]interface{}{
+		"status": params.Status,
+	}
+	if params.ActualArrival != 0 {
+		update["actualArrival"] = params.ActualArrival
+	}
+	if event.Version != 0 {
+		update["version"] = event.Version
+	}
+
+	err = shipments.Update(
+		map[string]interface{}{
+			"shipmentID": params.ShipmentID,
+		},
+		update,
+	)
+	if err != nil {
+		err = errors.Wrap(err, "Error Updating Shipment-status in database")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,554 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/pkg/errors"
+)
+
+// snapshotRetainCount is the number of latest Snapshots retained.
+// Older Snapshots are deleted when a new Snapshot is taken.
+const snapshotRetainCount = 2
+
+// snapshotChunkBytes is the approximate maximum size of a SnapshotChunk,
+// which keeps chunks well within Mongo's 16MB document-size limit.
+const snapshotChunkBytes = 4 << 20
+
+// SnapshotterConfig is the config for Snapshotter.
+type SnapshotterConfig struct {
+	// StateBuilder must be in incremental mode, since Snapshots
+	// record the HighWaterMark of Aggregate-state.
+	StateBuilder *StateBuilder
+	// SnapshotColl stores Snapshots without their Items and Shipments,
+	// which are stored in ChunkColl.
+	SnapshotColl *mongo.Collection
+	ChunkColl    *mongo.Collection
+	// Interval is the duration between periodic Snapshots.
+	Interval time.Duration
+}
+
+// Snapshotter takes Snapshots of Aggregate-state, and restores
+// Aggregate-state from them.
+type Snapshotter struct {
+	*SnapshotterConfig
+}
+
+// NewSnapshotter creates a new Snapshotter.
+func NewSnapshotter(config *SnapshotterConfig) (*Snapshotter, error) {
+	if config.StateBuilder == nil {
+		return nil, errors.New("StateBuilder cannot be nil")
+	}
+	if !config.StateBuilder.Incremental {
+		return nil, errors.New("StateBuilder must be in incremental mode")
+	}
+	if config.SnapshotColl == nil {
+		return nil, errors.New("SnapshotColl cannot be nil")
+	}
+	if config.ChunkColl == nil {
+		return nil, errors.New("ChunkColl cannot be nil")
+	}
+
+	return &Snapshotter{
+		config,
+	}, nil
+}
+
+// Run takes Snapshots periodically until the context is closed.
+func (s *Snapshotter) Run(ctx context.Context) {
+	if s.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			snapshot, err := s.Take()
+			if err != nil {
+				err = errors.Wrap(err, "Error taking periodic Snapshot")
+				log.Println(err)
+				continue
+			}
+			log.Printf("Took Snapshot with ID: %s", snapshot.SnapshotID)
+		}
+	}
+}
+
+// Take takes a Snapshot of current Aggregate-state.
+func (s *Snapshotter) Take() (*model.Snapshot, error) {
+	b := s.StateBuilder
+	release, _ := b.reserve(nil)
+	defer release()
+
+	if b.hwm == nil {
+		err := b.loadHWM()
+		if err != nil {
+			err = errors.Wrap(err, "Error loading HighWaterMark")
+			return nil, err
+		}
+	}
+
+	items, shipments, err := loadState(b.Items, b.Shipments)
+	if err != nil {
+		err = errors.Wrap(err, "Error loading Aggregate-state")
+		return nil, err
+	}
+	checksum, err := stateChecksum(items, shipments)
+	if err != nil {
+		err = errors.Wrap(err, "Error calculating checksum")
+		return nil, err
+	}
+
+	snapshotID, err := b.IDGen.NewID()
+	if err != nil {
+		err = errors.Wrap(err, "Error generating SnapshotID")
+		return nil, err
+	}
+	snapshot := &model.Snapshot{
+		SnapshotID:   snapshotID.String(),
+		AggregateID:  model.AggregateID,
+		Checksum:     checksum,
+		EventUUID:    b.hwm.EventUUID,
+		Items:        items,
+		NanoTime:     b.hwm.NanoTime,
+		RecentEvents: b.hwm.RecentEvents,
+		Shipments:    shipments,
+		Timestamp:    b.Clock.Now().UTC().Unix(),
+	}
+	err = s.insert(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.prune()
+	if err != nil {
+		err = errors.Wrap(err, "Error deleting old Snapshots")
+		log.Println(err)
+	}
+	return snapshot, nil
+}
+
+// insert stores the Snapshot's chunks, and then the Snapshot without its
+// Items and Shipments. So a Snapshot is only found once all its chunks are
+// stored. The chunks stored so far are deleted if inserting fails.
+func (s *Snapshotter) insert(snapshot *model.Snapshot) error {
+	chunks, err := snapshotChunks(snapshot)
+	if err != nil {
+		err = errors.Wrap(err, "Error splitting Snapshot into chunks")
+		return err
+	}
+	for _, chunk := range chunks {
+		_, err = s.ChunkColl.InsertOne(chunk)
+		if err != nil {
+			err = errors.Wrap(err, "Error inserting SnapshotChunk")
+			s.deleteChunks(snapshot.SnapshotID)
+			return err
+		}
+	}
+
+	header := *snapshot
+	header.ChunkCount = len(chunks)
+	header.Items = nil
+	header.Shipments = nil
+	_, err = s.SnapshotColl.InsertOne(&header)
+	if err != nil {
+		err = errors.Wrap(err, "Error inserting Snapshot")
+		s.deleteChunks(snapshot.SnapshotID)
+		return err
+	}
+	snapshot.ChunkCount = len(chunks)
+	return nil
+}
+
+// deleteChunks deletes the chunks of Snapshot, logging any errors.
+func (s *Snapshotter) deleteChunks(snapshotID string) {
+	_, err := s.ChunkColl.DeleteMany(map[string]interface{}{
+		"snapshotID": snapshotID,
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "Error deleting chunks of Snapshot with ID: %s", snapshotID)
+		log.Println(err)
+	}
+}
+
+// Latest returns the latest Snapshot. A nil Snapshot is
+// returned if no Snapshots exist.
+func (s *Snapshotter) Latest() (*model.Snapshot, error) {
+	snapshots, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, nil
+	}
+	snapshot := snapshots[0]
+	err = s.loadChunks(snapshot)
+	if err != nil {
+		err = errors.Wrapf(err, "Error loading chunks of Snapshot with ID: %s", snapshot.SnapshotID)
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// loadChunks loads the Items and Shipments of Snapshot from its chunks.
+// Snapshots without chunks already contain their Items and Shipments.
+func (s *Snapshotter) loadChunks(snapshot *model.Snapshot) error {
+	if snapshot.ChunkCount == 0 {
+		return nil
+	}
+	results, err := s.ChunkColl.Find(map[string]interface{}{
+		"snapshotID": snapshot.SnapshotID,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error finding SnapshotChunks")
+		return err
+	}
+
+	chunks := []*model.SnapshotChunk{}
+	for _, result := range results {
+		chunk, assertOK := result.(*model.SnapshotChunk)
+		if !assertOK {
+			return errors.New("error asserting find-result to SnapshotChunk")
+		}
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) != snapshot.ChunkCount {
+		return errors.Errorf(
+			"found %d chunks, but Snapshot has %d chunks", len(chunks), snapshot.ChunkCount,
+		)
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].Chunk < chunks[j].Chunk
+	})
+
+	snapshot.Items = []model.Item{}
+	snapshot.Shipments = []model.Shipment{}
+	for _, chunk := range chunks {
+		snapshot.Items = append(snapshot.Items, chunk.Items...)
+		snapshot.Shipments = append(snapshot.Shipments, chunk.Shipments...)
+	}
+	return nil
+}
+
+// snapshotChunks splits the Items and Shipments of Snapshot into chunks of
+// upto snapshotChunkBytes, as estimated by their JSON-size. A Snapshot
+// always has at least one chunk.
+func snapshotChunks(snapshot *model.Snapshot) ([]*model.SnapshotChunk, error) {
+	chunks := []*model.SnapshotChunk{}
+	var (
+		chunk     *model.SnapshotChunk
+		chunkSize int
+	)
+	// nextChunk returns the chunk to add an entity of size to
+	nextChunk := func(size int) *model.SnapshotChunk {
+		if chunk == nil || (chunkSize > 0 && chunkSize+size > snapshotChunkBytes) {
+			chunk = &model.SnapshotChunk{
+				SnapshotID: snapshot.SnapshotID,
+				Chunk:      len(chunks) + 1,
+			}
+			chunks = append(chunks, chunk)
+			chunkSize = 0
+		}
+		chunkSize += size
+		return chunk
+	}
+
+	for _, item := range snapshot.Items {
+		marshalItem, err := json.Marshal(item)
+		if err != nil {
+			err = errors.Wrap(err, "Error marshalling Item")
+			return nil, err
+		}
+		c := nextChunk(len(marshalItem))
+		c.Items = append(c.Items, item)
+	}
+	for _, shipment := range snapshot.Shipments {
+		marshalShipment, err := json.Marshal(shipment)
+		if err != nil {
+			err = errors.Wrap(err, "Error marshalling Shipment")
+			return nil, err
+		}
+		c := nextChunk(len(marshalShipment))
+		c.Shipments = append(c.Shipments, shipment)
+	}
+	// Empty Aggregate-state
+	if len(chunks) == 0 {
+		nextChunk(0)
+	}
+	return chunks, nil
+}
+
+// Restore restores Aggregate-state from the latest Snapshot, if the
+// Aggregate-state has not been built yet. Returns true if the state
+// was restored.
+func (s *Snapshotter) Restore() (bool, error) {
+	b := s.StateBuilder
+	release, _ := b.reserve(nil)
+	defer release()
+
+	if b.hwm == nil {
+		err := b.loadHWM()
+		if err != nil {
+			err = errors.Wrap(err, "Error loading HighWaterMark")
+			return false, err
+		}
+	}
+	// Aggregate-state already exists
+	if b.hwm.NanoTime != 0 {
+		return false, nil
+	}
+
+	snapshot, err := s.Latest()
+	if err != nil {
+		err = errors.Wrap(err, "Error loading latest Snapshot")
+		return false, err
+	}
+	if snapshot == nil {
+		return false, nil
+	}
+	checksum, err := stateChecksum(snapshot.Items, snapshot.Shipments)
+	if err != nil {
+		err = errors.Wrap(err, "Error calculating Snapshot checksum")
+		return false, err
+	}
+	if checksum != snapshot.Checksum {
+		return false, errors.New("Snapshot checksum does not match its contents")
+	}
+
+	err = writeState(b.Items, b.Shipments, snapshot.Items, snapshot.Shipments)
+	if err != nil {
+		err = errors.Wrap(err, "Error writing Snapshot to Aggregate-state")
+		return false, err
+	}
+	b.hwm.EventUUID = snapshot.EventUUID
+	b.hwm.NanoTime = snapshot.NanoTime
+	b.hwm.RecentEvents = snapshot.RecentEvents
+	err = b.saveHWM()
+	if err != nil {
+		err = errors.Wrap(err, "Error saving HighWaterMark")
+		return false, err
+	}
+
+	log.Printf("Restored Aggregate-state from Snapshot with ID: %s", snapshot.SnapshotID)
+	return true, nil
+}
+
+// Verify replays the Events returned by builderFunc, upto the Snapshot's
+// HighWaterMark, into the provided scratch repositories, and checks if
+// the resulting state matches the Snapshot. The builderFunc must return
+// the complete Event-stream for the verification to be meaningful.
+func (s *Snapshotter) Verify(
+	snapshot *model.Snapshot,
+	verifyItems repository.ItemRepository,
+	verifyShipments repository.ShipmentRepository,
+	builderFunc BuilderFunc,
+) (bool, error) {
+	err := writeState(verifyItems, verifyShipments, nil, nil)
+	if err != nil {
+		err = errors.Wrap(err, "Error clearing verify-repositories")
+		return false, err
+	}
+
+	eventRespChan, err := fetchEvents(
+		builderFunc,
+		s.StateBuilder.TimeoutSec,
+		s.StateBuilder.IDGen,
+	)
+	if err != nil {
+		return false, err
+	}
+	snapshotHWM := &model.HighWaterMark{
+		EventUUID:    snapshot.EventUUID,
+		NanoTime:     snapshot.NanoTime,
+		RecentEvents: snapshot.RecentEvents,
+	}
+	for eventResp := range eventRespChan {
+		if eventResp == nil {
+			continue
+		}
+		if eventResp.Error != nil {
+			err = errors.Wrap(eventResp.Error, "Verify: Error in EventResp")
+			log.Println(err)
+		}
+
+		event := &eventResp.Event
+		// Event was not applied on the Snapshot
+		if !isApplied(snapshotHWM, event, s.StateBuilder.LateEventWindow) {
+			continue
+		}
+		err := applyEvent(verifyItems, verifyShipments, event)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	items, shipments, err := loadState(verifyItems, verifyShipments)
+	if err != nil {
+		err = errors.Wrap(err, "Error loading replayed state")
+		return false, err
+	}
+	checksum, err := stateChecksum(items, shipments)
+	if err != nil {
+		err = errors.Wrap(err, "Error calculating replayed state checksum")
+		return false, err
+	}
+	return checksum == snapshot.Checksum, nil
+}
+
+// list returns all Snapshots, latest first. Snapshots with chunks
+// are returned without their Items and Shipments.
+func (s *Snapshotter) list() ([]*model.Snapshot, error) {
+	results, err := s.SnapshotColl.Find(map[string]interface{}{
+		"aggregateID": model.AggregateID,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error finding Snapshots")
+		return nil, err
+	}
+
+	snapshots := []*model.Snapshot{}
+	for _, result := range results {
+		snapshot, assertOK := result.(*model.Snapshot)
+		if !assertOK {
+			return nil, errors.New("error asserting find-result to Snapshot")
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].NanoTime == snapshots[j].NanoTime {
+			return snapshots[i].Timestamp > snapshots[j].Timestamp
+		}
+		return snapshots[i].NanoTime > snapshots[j].NanoTime
+	})
+	return snapshots, nil
+}
+
+// prune deletes all but the latest snapshotRetainCount Snapshots.
+func (s *Snapshotter) prune() error {
+	snapshots, err := s.list()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) <= snapshotRetainCount {
+		return nil
+	}
+
+	for _, snapshot := range snapshots[snapshotRetainCount:] {
+		// Snapshot is deleted first, so it is never found with missing chunks
+		_, err = s.SnapshotColl.DeleteMany(map[string]interface{}{
+			"snapshotID": snapshot.SnapshotID,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = s.ChunkColl.DeleteMany(map[string]interface{}{
+			"snapshotID": snapshot.SnapshotID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadState returns all Items and Shipments in Aggregate-state.
+func loadState(
+	itemRepo repository.ItemRepository,
+	shipmentRepo repository.ShipmentRepository,
+) ([]model.Item, []model.Shipment, error) {
+	itemResults, err := itemRepo.Find(&model.Item{})
+	if err != nil {
+		err = errors.Wrap(err, "Error finding Items")
+		return nil, nil, err
+	}
+	items := []model.Item{}
+	for _, item := range itemResults {
+		items = append(items, *item)
+	}
+
+	shipmentResults, err := shipmentRepo.Find(&model.Shipment{})
+	if err != nil {
+		err = errors.Wrap(err, "Error finding Shipments")
+		return nil, nil, err
+	}
+	shipments := []model.Shipment{}
+	for _, shipment := range shipmentResults {
+		shipments = append(shipments, *shipment)
+	}
+
+	return items, shipments, nil
+}
+
+// writeState replaces the Items and Shipments in Aggregate-state.
+func writeState(
+	itemRepo repository.ItemRepository,
+	shipmentRepo repository.ShipmentRepository,
+	items []model.Item,
+	shipments []model.Shipment,
+) error {
+	err := itemRepo.Delete(&model.Item{})
+	if err != nil {
+		err = errors.Wrap(err, "Error deleting Items")
+		return err
+	}
+	err = shipmentRepo.Delete(&model.Shipment{})
+	if err != nil {
+		err = errors.Wrap(err, "Error deleting Shipments")
+		return err
+	}
+
+	for i := range items {
+		err = itemRepo.Insert(&items[i])
+		if err != nil {
+			err = errors.Wrap(err, "Error inserting Item")
+			return err
+		}
+	}
+	for i := range shipments {
+		err = shipmentRepo.Insert(&shipments[i])
+		if err != nil {
+			err = errors.Wrap(err, "Error inserting Shipment")
+			return err
+		}
+	}
+	return nil
+}
+
+// stateChecksum calculates the SHA256 checksum of Items and Shipments.
+// The checksum is independent of the order of Items and Shipments.
+func stateChecksum(items []model.Item, shipments []model.Shipment) (string, error) {
+	sortedItems := make([]model.Item, len(items))
+	copy(sortedItems, items)
+	sort.Slice(sortedItems, func(i, j int) bool {
+		return sortedItems[i].ItemID < sortedItems[j].ItemID
+	})
+
+	sortedShipments := make([]model.Shipment, len(shipments))
+	copy(sortedShipments, shipments)
+	sort.Slice(sortedShipments, func(i, j int) bool {
+		return sortedShipments[i].ShipmentID < sortedShipments[j].ShipmentID
+	})
+
+	marshalState, err := json.Marshal(map[string]interface{}{
+		"items":     sortedItems,
+		"shipments": sortedShipments,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling Aggregate-state")
+		return "", err
+	}
+	checksum := sha256.Sum256(marshalState)
+	return hex.EncodeToString(checksum[:]), nil
+}
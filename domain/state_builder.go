@@ -0,0 +1,391 @@
+package domain
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/pkg/errors"
+)
+
+// StateBuilderConfig is the config for StateBuilder.
+type StateBuilderConfig struct {
+	// Items and Shipments are the Aggregate-state being built.
+	Items       repository.ItemRepository
+	Shipments   repository.ShipmentRepository
+	BuilderFunc BuilderFunc
+	TimeoutSec  int
+
+	// Incremental enables building the state by only applying Events newer
+	// than the HighWaterMark persisted in HWMs. HWMs is required
+	// when this is true.
+	Incremental bool
+	HWMs        repository.HWMRepository
+	// MinInterval is the duration within which a build is skipped if a
+	// previous build completed, and no Events were produced since then.
+	// Only used in incremental mode.
+	MinInterval time.Duration
+	// LateEventWindow is the duration before the HighWaterMark within which
+	// Events not yet applied are still applied, such as Events which arrive
+	// late or failed to apply previously. Defaults to DefaultLateEventWindow.
+	// Only used in incremental mode.
+	LateEventWindow time.Duration
+
+	// UnknownEvents is the policy for handling Events for which no
+	// EventApplier is registered. ParkedColl is required when this
+	// is ParkUnknownEvents.
+	UnknownEvents UnknownEventPolicy
+	ParkedColl    *mongo.Collection
+
+	// Clock provides the time for builds and records, and defaults to
+	// model.SystemClock. IDGen generates their UUIDs, and defaults to
+	// model.RandomIDGenerator.
+	Clock model.Clock
+	IDGen model.IDGenerator
+}
+
+// BuildStats are the statistics of a single Aggregate-state build.
+type BuildStats struct {
+	Duration      time.Duration
+	EventsApplied int
+	// EventsSkipped are the Events skipped for being at or before HighWaterMark.
+	EventsSkipped int
+	// EventsUnknown are the Events for which no EventApplier is registered.
+	EventsUnknown int
+	// Skipped is true if the build itself was skipped.
+	Skipped bool
+}
+
+// BuilderStats are the cumulative statistics of all Aggregate-state builds.
+type BuilderStats struct {
+	Builds        int64
+	SkippedBuilds int64
+	EventsApplied int64
+	TotalDuration time.Duration
+	LastBuild     BuildStats
+}
+
+// DefaultLateEventWindow is the default StateBuilderConfig.LateEventWindow.
+const DefaultLateEventWindow = time.Minute
+
+// StateBuilder builds Aggregate-state, optionally applying only the Events
+// not yet applied. Only a single build runs at a time, and callers waiting
+// on a build reuse its result if it started after they requested the build.
+type StateBuilder struct {
+	*StateBuilderConfig
+
+	// lock guards the fields below it. The HighWaterMark is only used
+	// by the build or Snapshot-operation holding the reservation.
+	lock sync.Mutex
+	// busy is closed once the running build or Snapshot-operation
+	// completes, and is nil if none are running.
+	busy       chan struct{}
+	buildStart time.Time
+	dirtyAt    time.Time
+	stats      BuilderStats
+
+	hwm *model.HighWaterMark
+}
+
+// NewStateBuilder creates a new StateBuilder.
+func NewStateBuilder(config *StateBuilderConfig) (*StateBuilder, error) {
+	if config.Items == nil {
+		return nil, errors.New("Items cannot be nil")
+	}
+	if config.Shipments == nil {
+		return nil, errors.New("Shipments cannot be nil")
+	}
+	if config.BuilderFunc == nil {
+		return nil, errors.New("BuilderFunc cannot be nil")
+	}
+	if config.TimeoutSec == 0 {
+		return nil, errors.New("TimeoutSec cannot be 0")
+	}
+	if config.Incremental && config.HWMs == nil {
+		return nil, errors.New("HWMs cannot be nil in incremental mode")
+	}
+	if config.UnknownEvents == ParkUnknownEvents && config.ParkedColl == nil {
+		return nil, errors.New("ParkedColl cannot be nil when parking unknown Events")
+	}
+	if config.Clock == nil {
+		config.Clock = model.SystemClock{}
+	}
+	if config.IDGen == nil {
+		config.IDGen = model.RandomIDGenerator{}
+	}
+	if config.LateEventWindow == 0 {
+		config.LateEventWindow = DefaultLateEventWindow
+	}
+
+	return &StateBuilder{
+		StateBuilderConfig: config,
+	}, nil
+}
+
+// MarkDirty notifies the StateBuilder that new Events were produced,
+// so the next build cannot be skipped.
+func (b *StateBuilder) MarkDirty() {
+	b.lock.Lock()
+	b.dirtyAt = b.Clock.Now()
+	b.lock.Unlock()
+}
+
+// Stats returns the cumulative statistics of all builds.
+func (b *StateBuilder) Stats() BuilderStats {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.stats
+}
+
+// Build builds the Aggregate-state.
+func (b *StateBuilder) Build() (*BuildStats, error) {
+	requestedAt := b.Clock.Now()
+
+	release, canSkip := b.reserve(func() bool {
+		return b.canSkip(requestedAt)
+	})
+	if canSkip {
+		stats := BuildStats{
+			Skipped: true,
+		}
+		b.stats.SkippedBuilds++
+		b.stats.LastBuild = stats
+		b.lock.Unlock()
+		return &stats, nil
+	}
+	defer release()
+
+	buildStart := b.Clock.Now()
+	stats, err := b.build()
+	if err != nil {
+		return nil, err
+	}
+	stats.Duration = b.Clock.Now().Sub(buildStart)
+
+	b.lock.Lock()
+	b.buildStart = buildStart
+	b.stats.Builds++
+	b.stats.EventsApplied += int64(stats.EventsApplied)
+	b.stats.TotalDuration += stats.Duration
+	b.stats.LastBuild = *stats
+	b.lock.Unlock()
+
+	log.Printf(
+		"Built Aggregate-state in %s: "+
+			"%d Events applied, %d Events skipped, %d unknown Events",
+		stats.Duration, stats.EventsApplied, stats.EventsSkipped, stats.EventsUnknown,
+	)
+	return stats, nil
+}
+
+// reserve waits until no build or Snapshot-operation is running, and
+// reserves the StateBuilder for the caller, which must call release once
+// done. If canSkip returns true, the StateBuilder is not reserved, and
+// reserve returns with lock held instead, which the caller must unlock.
+// canSkip is called with lock held.
+func (b *StateBuilder) reserve(canSkip func() bool) (release func(), skipped bool) {
+	for {
+		b.lock.Lock()
+		if canSkip != nil && canSkip() {
+			return nil, true
+		}
+		if b.busy == nil {
+			break
+		}
+		busy := b.busy
+		b.lock.Unlock()
+		<-busy
+	}
+
+	busy := make(chan struct{})
+	b.busy = busy
+	b.lock.Unlock()
+
+	return func() {
+		b.lock.Lock()
+		b.busy = nil
+		b.lock.Unlock()
+		close(busy)
+	}, false
+}
+
+// build applies the Events not yet applied. The StateBuilder
+// must be reserved by caller.
+func (b *StateBuilder) build() (*BuildStats, error) {
+	if b.Incremental && b.hwm == nil {
+		err := b.loadHWM()
+		if err != nil {
+			err = errors.Wrap(err, "Error loading HighWaterMark")
+			return nil, err
+		}
+	}
+
+	eventRespChan, err := fetchEvents(b.BuilderFunc, b.TimeoutSec, b.IDGen)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &BuildStats{}
+	hwmUpdated := false
+	for eventResp := range eventRespChan {
+		if eventResp == nil {
+			continue
+		}
+		if eventResp.Error != nil {
+			err = errors.Wrap(eventResp.Error, "StateBuilder: Error in EventResp")
+			log.Println(err)
+		}
+
+		event := &eventResp.Event
+		if b.Incremental && isApplied(b.hwm, event, b.LateEventWindow) {
+			stats.EventsSkipped++
+			continue
+		}
+		err := applyEvent(b.Items, b.Shipments, event)
+		if _, isUnknown := err.(*unknownEventError); isUnknown {
+			stats.EventsUnknown++
+			err = b.handleUnknown(event, err)
+			if err != nil {
+				// Drain remaining Events so the Event-stream is not blocked
+				go func() {
+					for range eventRespChan {
+					}
+				}()
+				if hwmUpdated {
+					saveErr := b.saveHWM()
+					if saveErr != nil {
+						saveErr = errors.Wrap(saveErr, "Error saving HighWaterMark")
+						log.Println(saveErr)
+					}
+				}
+				return nil, err
+			}
+		} else if err != nil {
+			// Event is not marked as applied, so it is retried
+			// if it is received again within the late-window
+			log.Println(err)
+			continue
+		} else {
+			stats.EventsApplied++
+		}
+		if b.Incremental {
+			markApplied(b.hwm, event, b.LateEventWindow)
+			hwmUpdated = true
+		}
+	}
+
+	if hwmUpdated {
+		err = b.saveHWM()
+		if err != nil {
+			err = errors.Wrap(err, "Error saving HighWaterMark")
+			log.Println(err)
+		}
+	}
+	return stats, nil
+}
+
+// handleUnknown handles the Event with no registered EventApplier
+// as per UnknownEventPolicy. An error is returned if the build must fail.
+func (b *StateBuilder) handleUnknown(event *cmodel.Event, err error) error {
+	switch b.UnknownEvents {
+	case FailOnUnknownEvents:
+		return errors.Wrapf(err, "Error applying Event with ID: %s", event.UUID)
+
+	case ParkUnknownEvents:
+		parkErr := parkEvent(b.ParkedColl, event, err, b.Clock.Now())
+		if parkErr != nil {
+			return errors.Wrapf(parkErr, "Error parking Event with ID: %s", event.UUID)
+		}
+		log.Printf("Parked Event with ID: %s: %s", event.UUID, err)
+
+	default:
+		log.Printf("Skipped Event with ID: %s: %s", event.UUID, err)
+	}
+	return nil
+}
+
+// canSkip checks if the previous build already includes all Events
+// produced until the build was requested.
+func (b *StateBuilder) canSkip(requestedAt time.Time) bool {
+	if !b.Incremental || b.buildStart.IsZero() {
+		return false
+	}
+	// Events were produced after the last build started
+	if !b.buildStart.After(b.dirtyAt) {
+		return false
+	}
+	// Last build started after this build was requested
+	if b.buildStart.After(requestedAt) {
+		return true
+	}
+	return requestedAt.Sub(b.buildStart) <= b.MinInterval
+}
+
+// isApplied checks if the Event was applied as per the HighWaterMark.
+// Events older than the late-window are considered as applied.
+func isApplied(
+	hwm *model.HighWaterMark,
+	event *cmodel.Event,
+	lateWindow time.Duration,
+) bool {
+	eventUUID := event.UUID.String()
+	for _, applied := range hwm.RecentEvents {
+		if applied.EventUUID == eventUUID {
+			return true
+		}
+	}
+	return event.NanoTime < hwm.NanoTime-lateWindow.Nanoseconds()
+}
+
+// markApplied records the Event as applied in the HighWaterMark, which only
+// moves forward. Events older than the late-window are dropped from
+// RecentEvents, since they are now considered as applied.
+func markApplied(
+	hwm *model.HighWaterMark,
+	event *cmodel.Event,
+	lateWindow time.Duration,
+) {
+	if event.NanoTime > hwm.NanoTime {
+		hwm.EventUUID = event.UUID.String()
+		hwm.NanoTime = event.NanoTime
+	}
+
+	windowStart := hwm.NanoTime - lateWindow.Nanoseconds()
+	recentEvents := []model.AppliedEvent{}
+	for _, applied := range hwm.RecentEvents {
+		if applied.NanoTime >= windowStart {
+			recentEvents = append(recentEvents, applied)
+		}
+	}
+	if event.NanoTime >= windowStart {
+		recentEvents = append(recentEvents, model.AppliedEvent{
+			EventUUID: event.UUID.String(),
+			NanoTime:  event.NanoTime,
+		})
+	}
+	hwm.RecentEvents = recentEvents
+}
+
+func (b *StateBuilder) loadHWM() error {
+	hwm, err := b.HWMs.FindOne(model.AggregateID)
+	// No HighWaterMark yet, so all Events are applied
+	if err == repository.ErrNotFound {
+		b.hwm = &model.HighWaterMark{
+			AggregateID: model.AggregateID,
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b.hwm = hwm
+	return nil
+}
+
+func (b *StateBuilder) saveHWM() error {
+	return b.HWMs.Save(b.hwm)
+}
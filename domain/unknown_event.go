@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/pkg/errors"
+)
+
+// UnknownEventPolicy defines how StateBuilder handles Events
+// for which no EventApplier is registered.
+type UnknownEventPolicy int
+
+const (
+	// SkipUnknownEvents logs and skips the unknown Events.
+	SkipUnknownEvents UnknownEventPolicy = iota
+	// FailOnUnknownEvents fails the build on an unknown Event.
+	FailOnUnknownEvents
+	// ParkUnknownEvents stores the unknown Events in a side-collection
+	// for inspection, and continues the build.
+	ParkUnknownEvents
+)
+
+// ParseUnknownEventPolicy parses the UnknownEventPolicy from its name,
+// which is one of "skip", "fail" or "park". A blank name is parsed as "skip".
+func ParseUnknownEventPolicy(name string) (UnknownEventPolicy, error) {
+	switch name {
+	case "", "skip":
+		return SkipUnknownEvents, nil
+	case "fail":
+		return FailOnUnknownEvents, nil
+	case "park":
+		return ParkUnknownEvents, nil
+	default:
+		return SkipUnknownEvents, fmt.Errorf("Unknown UnknownEventPolicy: %s", name)
+	}
+}
+
+// parkEvent stores the Event in parkedColl. Events already parked are ignored,
+// since the same Events are received again on non-incremental builds.
+func parkEvent(
+	parkedColl *mongo.Collection,
+	event *cmodel.Event,
+	reason error,
+	parkedAt time.Time,
+) error {
+	eventUUID := event.UUID.String()
+	_, err := parkedColl.FindOne(map[string]interface{}{
+		"eventUUID": eventUUID,
+	})
+	if err == nil {
+		return nil
+	}
+
+	_, err = parkedColl.InsertOne(&model.ParkedEvent{
+		EventUUID:     eventUUID,
+		Action:        event.Action,
+		AggregateID:   event.AggregateID,
+		CorrelationID: event.CorrelationID.String(),
+		Data:          event.Data,
+		NanoTime:      event.NanoTime,
+		Reason:        reason.Error(),
+		Source:        event.Source,
+		Timestamp:     parkedAt.UTC().Unix(),
+		Version:       event.Version,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error inserting ParkedEvent")
+		return err
+	}
+	return nil
+}
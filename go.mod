@@ -0,0 +1,55 @@
+module github.com/TerrexTech/agg-shipment-cmd
+
+go 1.19
+
+require (
+	github.com/Shopify/sarama v1.37.2
+	github.com/TerrexTech/go-agg-builder v2.0.0+incompatible
+	github.com/TerrexTech/go-common-models v2.0.0+incompatible
+	github.com/TerrexTech/go-commonutils v3.1.0+incompatible
+	github.com/TerrexTech/go-kafkautils v3.1.0+incompatible
+	github.com/TerrexTech/go-mongoutils v3.1.0+incompatible
+	github.com/TerrexTech/uuuid v1.2.0
+	github.com/boltdb/bolt v1.3.1
+	github.com/buger/jsonparser v0.0.0-20181115193947-bf1c66bbce23
+	github.com/go-stack/stack v1.8.0
+	github.com/gocql/gocql v0.0.0-20181124151448-70385f88b28b
+	github.com/gofrs/uuid v3.1.0+incompatible
+	github.com/hailocab/go-hostpool v0.0.0-20160125115350-e80d13ce29ed
+	github.com/hpcloud/tail v1.0.0
+	github.com/joho/godotenv v1.3.0
+	github.com/mongodb/mongo-go-driver v0.0.14
+	github.com/onsi/ginkgo v1.7.0
+	github.com/onsi/gomega v1.4.3
+	github.com/pkg/errors v0.8.0
+	github.com/xdg/scram v0.0.1
+	github.com/xdg/stringprep v1.0.0
+	golang.org/x/sync v0.0.0-20220923202941-7f9b1623fab7
+	gopkg.in/fsnotify.v1 v1.4.7
+	gopkg.in/inf.v0 v0.9.1
+	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7
+	gopkg.in/yaml.v2 v2.2.2
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/eapache/go-resiliency v1.3.0 // indirect
+	github.com/eapache/go-xerial-snappy v0.0.0-20180814174437-776d5712da21 // indirect
+	github.com/eapache/queue v1.1.0 // indirect
+	github.com/golang/snappy v0.0.4 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/hashicorp/go-uuid v1.0.3 // indirect
+	github.com/jcmturner/aescts/v2 v2.0.0 // indirect
+	github.com/jcmturner/dnsutils/v2 v2.0.0 // indirect
+	github.com/jcmturner/gofork v1.7.6 // indirect
+	github.com/jcmturner/gokrb5/v8 v8.4.3 // indirect
+	github.com/jcmturner/rpc/v2 v2.0.3 // indirect
+	github.com/klauspost/compress v1.15.11 // indirect
+	github.com/pierrec/lz4/v4 v4.1.17 // indirect
+	github.com/rcrowley/go-metrics v0.0.0-20201227073835-cf1acfcdf475 // indirect
+	golang.org/x/crypto v0.0.0-20220722155217-630584e8d5aa // indirect
+	golang.org/x/net v0.0.0-20220927171203-f486391704dc // indirect
+	golang.org/x/sys v0.0.0-20220728004956-3c1f35247d10 // indirect
+	golang.org/x/text v0.3.7 // indirect
+)
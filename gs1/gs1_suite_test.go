@@ -0,0 +1,108 @@
+package gs1
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// TestGS1 tests GTIN-validation and GS1-128 parsing.
+func TestGS1(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "GS1 Suite")
+}
+
+var _ = Describe("GTIN", func() {
+	It("should calculate check digit", func() {
+		checkDigit, err := CheckDigit("03600029145")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(checkDigit).To(Equal(2))
+
+		checkDigit, err = CheckDigit("400638133393")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(checkDigit).To(Equal(1))
+
+		_, err = CheckDigit("4006381a3393")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should normalize UPC-A, EAN-13 and GTIN-14 to GTIN-14", func() {
+		gtin, err := NormalizeGTIN("036000291452")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gtin).To(Equal("00036000291452"))
+
+		gtin, err = NormalizeGTIN("4006381333931")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gtin).To(Equal("04006381333931"))
+
+		gtin, err = NormalizeGTIN("10036000291459")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gtin).To(Equal("10036000291459"))
+	})
+
+	It("should return error for invalid GTINs", func() {
+		Expect(ValidGTIN("036000291453")).To(BeFalse())
+		Expect(ValidGTIN("03600029145")).To(BeFalse())
+		Expect(ValidGTIN("03600029145x")).To(BeFalse())
+		Expect(ValidGTIN("test-upc")).To(BeFalse())
+		Expect(ValidGTIN("036000291452")).To(BeTrue())
+	})
+})
+
+var _ = Describe("ParseLabel", func() {
+	now := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	It("should parse human-readable labels", func() {
+		label, err := ParseLabel("(01)10036000291459(17)190101(10)LOT-42(13)180915(3102)001250", now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(label).To(Equal(&Label{
+			GTIN:        "10036000291459",
+			Lot:         "LOT-42",
+			PackDate:    time.Date(2018, 9, 15, 0, 0, 0, 0, time.UTC),
+			NetWeightKg: 12.5,
+		}))
+	})
+
+	It("should parse scanned labels", func() {
+		label, err := ParseLabel("]C10110036000291459310300125013180900"+"10LOT-42\x1d17190101", now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(label).To(Equal(&Label{
+			GTIN:        "10036000291459",
+			Lot:         "LOT-42",
+			PackDate:    time.Date(2018, 9, 30, 0, 0, 0, 0, time.UTC),
+			NetWeightKg: 1.25,
+		}))
+	})
+
+	It("should choose century of dates as specified by GS1", func() {
+		label, err := ParseLabel("(13)680101", now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(label.PackDate.Year()).To(Equal(2068))
+
+		label, err = ParseLabel("(13)690101", now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(label.PackDate.Year()).To(Equal(1969))
+	})
+
+	It("should return error for invalid labels", func() {
+		_, err := ParseLabel("(01)10036000291458", now)
+		Expect(err).To(HaveOccurred())
+
+		_, err = ParseLabel("(13)180231", now)
+		Expect(err).To(HaveOccurred())
+
+		_, err = ParseLabel("(10)LOT-1(10)LOT-2", now)
+		Expect(err).To(HaveOccurred())
+
+		_, err = ParseLabel("(3102)12", now)
+		Expect(err).To(HaveOccurred())
+
+		_, err = ParseLabel("9912345", now)
+		Expect(err).To(HaveOccurred())
+
+		_, err = ParseLabel("", now)
+		Expect(err).To(HaveOccurred())
+	})
+})
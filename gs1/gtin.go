@@ -0,0 +1,71 @@
+// Package gs1 validates and normalizes GS1 barcodes, and parses
+// GS1-128 labels into their application identifiers.
+package gs1
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GTINLength is the length of GTIN-14, to which all GTINs are normalized.
+const GTINLength = 14
+
+// CheckDigit calculates the GS1 check digit for the digits,
+// which exclude the check digit itself.
+func CheckDigit(digits string) (int, error) {
+	if digits == "" {
+		return 0, errors.New("digits cannot be blank")
+	}
+
+	sum := 0
+	// Starting from the rightmost digit, digits are alternately weighted 3 and 1
+	weight := 3
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := digits[i]
+		if digit < '0' || digit > '9' {
+			return 0, fmt.Errorf("invalid digit %q", digit)
+		}
+		sum += int(digit-'0') * weight
+		weight = 4 - weight
+	}
+	return (10 - sum%10) % 10, nil
+}
+
+// ValidGTIN checks if the code is a UPC-A, EAN-13 or GTIN-14
+// with valid check digit.
+func ValidGTIN(code string) bool {
+	_, err := NormalizeGTIN(code)
+	return err == nil
+}
+
+// NormalizeGTIN validates the UPC-A, EAN-13 or GTIN-14, and returns it
+// as GTIN-14 by padding it with leading zeros.
+func NormalizeGTIN(code string) (string, error) {
+	switch len(code) {
+	case 12, 13, GTINLength:
+	default:
+		err := fmt.Errorf(
+			"GTIN must have 12, 13 or 14 digits, but has %d characters", len(code),
+		)
+		return "", err
+	}
+
+	lastIndex := len(code) - 1
+	checkDigit, err := CheckDigit(code[:lastIndex])
+	if err != nil {
+		err = errors.Wrap(err, "Error calculating check digit")
+		return "", err
+	}
+	lastDigit := code[lastIndex]
+	if lastDigit < '0' || lastDigit > '9' {
+		return "", fmt.Errorf("invalid digit %q", lastDigit)
+	}
+	if int(lastDigit-'0') != checkDigit {
+		err = fmt.Errorf("invalid check digit, expected %d", checkDigit)
+		return "", err
+	}
+
+	return strings.Repeat("0", GTINLength-len(code)) + code, nil
+}
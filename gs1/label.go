@@ -0,0 +1,280 @@
+package gs1
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Application Identifiers (AIs) used from GS1-128 labels.
+const (
+	AIGTIN     = "01"
+	AILot      = "10"
+	AIPackDate = "13"
+	// AINetWeight is the prefix of AIs 3100 to 3105, which are the net
+	// weight in kg with the last digit of AI as the number of decimals.
+	AINetWeight = "310"
+)
+
+// GroupSeparator is the FNC1 character in scanned GS1-128 data, which
+// terminates variable-length fields.
+const GroupSeparator = '\x1d'
+
+// aiSpec is the length of data for an AI. Fixed-length data is not
+// terminated by GroupSeparator, so its length must be known to parse
+// scanned data.
+type aiSpec struct {
+	length int
+	fixed  bool
+}
+
+// aiSpecs are the AIs which can be parsed from scanned data. Besides the
+// AIs used, this includes the common AIs on trade-item labels, so labels
+// containing them can be parsed.
+var aiSpecs = map[string]aiSpec{
+	"00":       {18, true},
+	AIGTIN:     {14, true},
+	"02":       {14, true},
+	AILot:      {20, false},
+	"11":       {6, true},
+	"12":       {6, true},
+	AIPackDate: {6, true},
+	"15":       {6, true},
+	"16":       {6, true},
+	"17":       {6, true},
+	"21":       {20, false},
+	"37":       {8, false},
+	"3100":     {6, true},
+	"3101":     {6, true},
+	"3102":     {6, true},
+	"3103":     {6, true},
+	"3104":     {6, true},
+	"3105":     {6, true},
+}
+
+// Label is the data parsed from a GS1-128 label. Fields are
+// zero-valued if their AI is not on the label.
+type Label struct {
+	// GTIN is normalized to GTIN-14.
+	GTIN        string
+	Lot         string
+	PackDate    time.Time
+	NetWeightKg float64
+}
+
+// ParseLabel parses the GS1-128 data, either in human-readable form with AIs
+// in parentheses, such as "(01)00036000291452(10)L123", or as scanned, with
+// FNC1 as GroupSeparator. The current time is used to determine the century
+// of dates, as specified by GS1.
+func ParseLabel(data string, now time.Time) (*Label, error) {
+	var (
+		elements map[string]string
+		err      error
+	)
+	if strings.HasPrefix(data, "(") {
+		elements, err = splitBracketed(data)
+	} else {
+		elements, err = splitScanned(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) == 0 {
+		return nil, errors.New("label contains no application identifiers")
+	}
+
+	label := &Label{}
+	for ai, value := range elements {
+		switch {
+		case ai == AIGTIN:
+			label.GTIN, err = NormalizeGTIN(value)
+			if err != nil {
+				err = errors.Wrap(err, "Error parsing GTIN")
+				return nil, err
+			}
+
+		case ai == AILot:
+			label.Lot = value
+
+		case ai == AIPackDate:
+			label.PackDate, err = parseDate(value, now)
+			if err != nil {
+				err = errors.Wrap(err, "Error parsing pack date")
+				return nil, err
+			}
+
+		case strings.HasPrefix(ai, AINetWeight):
+			label.NetWeightKg, err = parseDecimal(value, ai[len(ai)-1])
+			if err != nil {
+				err = errors.Wrap(err, "Error parsing net weight")
+				return nil, err
+			}
+		}
+	}
+	return label, nil
+}
+
+// splitBracketed splits human-readable data into values by AI.
+// AIs which are not used are skipped without validation.
+func splitBracketed(data string) (map[string]string, error) {
+	elements := map[string]string{}
+	for data != "" {
+		if data[0] != '(' {
+			return nil, fmt.Errorf("expected \"(\" at %q", data)
+		}
+		aiEnd := strings.IndexByte(data, ')')
+		if aiEnd == -1 {
+			return nil, fmt.Errorf("unterminated application identifier at %q", data)
+		}
+		ai := data[1:aiEnd]
+		data = data[aiEnd+1:]
+
+		valueEnd := strings.IndexByte(data, '(')
+		if valueEnd == -1 {
+			valueEnd = len(data)
+		}
+		value := data[:valueEnd]
+		data = data[valueEnd:]
+
+		spec, isKnown := aiSpecs[ai]
+		if !isKnown {
+			continue
+		}
+		err := addElement(elements, ai, spec, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return elements, nil
+}
+
+// splitScanned splits scanned data into values by AI. Scanned data
+// can only be split if all its AIs are known.
+func splitScanned(data string) (map[string]string, error) {
+	// Remove symbology-identifier, such as "]C1" for GS1-128
+	if strings.HasPrefix(data, "]") && len(data) >= 3 {
+		data = data[3:]
+	}
+
+	elements := map[string]string{}
+	for data != "" {
+		if data[0] == GroupSeparator {
+			data = data[1:]
+			continue
+		}
+
+		ai, spec, isKnown := matchAI(data)
+		if !isKnown {
+			return nil, fmt.Errorf("unsupported application identifier at %q", data)
+		}
+		data = data[len(ai):]
+
+		valueEnd := strings.IndexByte(data, GroupSeparator)
+		if valueEnd == -1 {
+			valueEnd = len(data)
+		}
+		if spec.fixed && valueEnd > spec.length {
+			valueEnd = spec.length
+		}
+		value := data[:valueEnd]
+		data = data[valueEnd:]
+
+		err := addElement(elements, ai, spec, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return elements, nil
+}
+
+// matchAI returns the known AI at start of data.
+func matchAI(data string) (string, aiSpec, bool) {
+	for aiLength := 2; aiLength <= 4 && aiLength <= len(data); aiLength++ {
+		ai := data[:aiLength]
+		if spec, isKnown := aiSpecs[ai]; isKnown {
+			return ai, spec, true
+		}
+	}
+	return "", aiSpec{}, false
+}
+
+// addElement validates the length of value and adds it to elements.
+func addElement(elements map[string]string, ai string, spec aiSpec, value string) error {
+	if spec.fixed && len(value) != spec.length {
+		return fmt.Errorf(
+			"AI (%s) must have %d characters, but has %d", ai, spec.length, len(value),
+		)
+	}
+	if value == "" || len(value) > spec.length {
+		return fmt.Errorf(
+			"AI (%s) must have 1 to %d characters, but has %d", ai, spec.length, len(value),
+		)
+	}
+	if _, exists := elements[ai]; exists {
+		return fmt.Errorf("AI (%s) is repeated", ai)
+	}
+	elements[ai] = value
+	return nil
+}
+
+// parseDate parses the YYMMDD date. A day of 00 is the last day of month.
+// The century is chosen so the date is within 49 years before, or
+// 50 years after, the current year.
+func parseDate(value string, now time.Time) (time.Time, error) {
+	if !isDigits(value) {
+		return time.Time{}, fmt.Errorf("date must be YYMMDD, but is %q", value)
+	}
+	yy, _ := strconv.Atoi(value[0:2])
+	month, _ := strconv.Atoi(value[2:4])
+	day, _ := strconv.Atoi(value[4:6])
+	if month < 1 || month > 12 {
+		return time.Time{}, fmt.Errorf("invalid month %d", month)
+	}
+
+	curYear := now.UTC().Year()
+	year := curYear - curYear%100 + yy
+	if diff := yy - curYear%100; diff >= 51 {
+		year -= 100
+	} else if diff <= -50 {
+		year += 100
+	}
+
+	if day == 0 {
+		// Day 0 of next month is the last day of this month
+		return time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC), nil
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Day() != day {
+		return time.Time{}, fmt.Errorf("invalid day %d for month %d", day, month)
+	}
+	return date, nil
+}
+
+// parseDecimal parses the digits, with decimals as the number of decimal places.
+func parseDecimal(value string, decimals byte) (float64, error) {
+	if !isDigits(value) {
+		return 0, fmt.Errorf("value must be digits, but is %q", value)
+	}
+	num, err := strconv.Atoi(value)
+	if err != nil {
+		err = errors.Wrap(err, "Error parsing value")
+		return 0, err
+	}
+	return float64(num) / math.Pow10(int(decimals-'0')), nil
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
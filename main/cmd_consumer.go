@@ -2,52 +2,138 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/TerrexTech/agg-shipment-cmd/domain"
-
-	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/TerrexTech/agg-shipment-cmd/model"
 
 	"github.com/Shopify/sarama"
-	"github.com/TerrexTech/go-common-models/model"
+	cmodel "github.com/TerrexTech/go-common-models/model"
 	"github.com/pkg/errors"
 )
 
+// cmdError is an error from processing a Command,
+// along with the error-code sent in response.
+type cmdError struct {
+	code int16
+	err  error
+}
+
+func (e *cmdError) Error() string {
+	return e.err.Error()
+}
+
 type cmdConsConfig struct {
-	collection        *mongo.Collection
-	builderFunc       domain.BuilderFunc
-	builderTimeoutSec int
+	stateBuilder *domain.StateBuilder
+
+	handle func(*cmodel.Command) error
+	// handleTxn, if set, is used instead of handle for exactly-once processing.
+	// It publishes the Command's Event and result, and commits the message's
+	// offset, in a single Kafka-transaction. Offsets are then not marked
+	// on the consumer-session.
+	handleTxn func(*cmodel.Command, *sarama.ConsumerMessage) error
+	// commitOffset commits the offset of messages not handled by handleTxn,
+	// such as dead-lettered, expired or invalid Commands. This is required
+	// if handleTxn is set.
+	commitOffset func(*sarama.ConsumerMessage) error
 
-	handle func(*model.Command)
+	// workerCount is the number of Commands processed concurrently
+	workerCount int
+
+	serviceName    string
+	respProd       chan<- *cmodel.Document
+	deadLetterProd chan<- *model.DeadLetter
+	// maxAttempts is the number of times processing a Command is attempted
+	// before it is published to dead-letter topic.
+	maxAttempts int
+	// retryBackoff is the delay before retrying a failed Command, multiplied
+	// by the number of attempts so far. The delay is limited to
+	// maxRetryBackoff, since it blocks other Commands in the shard.
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	// drainTimeout is the maximum duration to wait for in-flight Commands
+	// when a claim ends, such as on rebalance. On shutdown, this is limited
+	// to the deadline set using drainBy.
+	drainTimeout time.Duration
+
+	// clock provides the time for Command-expiry and records, and idGen
+	// generates their UUIDs. These default to system-time and random UUIDs.
+	clock model.Clock
+	idGen model.IDGenerator
 }
 
 // Handler for Consumer Messages
 type cmdConsumer struct {
 	cmdConsConfig
+	workerPool *cmdWorkerPool
+
+	lock sync.Mutex
+	// shutdownDeadline, if set, is the latest time claims wait
+	// for their in-flight Commands.
+	shutdownDeadline time.Time
 }
 
 func newCmdConsumer(config cmdConsConfig) (*cmdConsumer, error) {
-	if config.collection == nil {
-		err := errors.New("collection cannot be nil")
+	if config.stateBuilder == nil {
+		err := errors.New("stateBuilder cannot be nil")
+		return nil, err
+	}
+	if config.handle == nil && config.handleTxn == nil {
+		err := errors.New("handle and handleTxn cannot both be nil")
+		return nil, err
+	}
+	if config.handleTxn != nil && config.commitOffset == nil {
+		err := errors.New("commitOffset cannot be nil if handleTxn is set")
+		return nil, err
+	}
+	if config.workerCount <= 0 {
+		err := errors.New("workerCount must be greater than 0")
+		return nil, err
+	}
+	if config.serviceName == "" {
+		err := errors.New("serviceName cannot be blank")
+		return nil, err
+	}
+	if config.respProd == nil {
+		err := errors.New("respProd cannot be nil")
+		return nil, err
+	}
+	if config.deadLetterProd == nil {
+		err := errors.New("deadLetterProd cannot be nil")
+		return nil, err
+	}
+	if config.maxAttempts <= 0 {
+		err := errors.New("maxAttempts must be greater than 0")
 		return nil, err
 	}
-	if config.builderFunc == nil {
-		err := errors.New("builderFunc cannot be nil")
+	if config.retryBackoff < 0 {
+		err := errors.New("retryBackoff cannot be negative")
 		return nil, err
 	}
-	if config.builderTimeoutSec == 0 {
-		err := errors.New("builderTimeoutSec cannot be 0")
+	if config.maxRetryBackoff < config.retryBackoff {
+		err := errors.New("maxRetryBackoff cannot be less than retryBackoff")
 		return nil, err
 	}
-	if config.handle == nil {
-		err := errors.New("handle cannot be nil")
+	if config.drainTimeout <= 0 {
+		err := errors.New("drainTimeout must be greater than 0")
 		return nil, err
 	}
+	if config.clock == nil {
+		config.clock = model.SystemClock{}
+	}
+	if config.idGen == nil {
+		config.idGen = model.RandomIDGenerator{}
+	}
 
-	return &cmdConsumer{
-		config,
-	}, nil
+	consumer := &cmdConsumer{
+		cmdConsConfig: config,
+	}
+	consumer.workerPool = newCmdWorkerPool(config.workerCount, 64, consumer.processJob)
+	return consumer, nil
 }
 
 func (*cmdConsumer) Setup(sarama.ConsumerGroupSession) error {
@@ -65,50 +151,275 @@ func (m *cmdConsumer) ConsumeClaim(
 	claim sarama.ConsumerGroupClaim,
 ) error {
 	log.Println("Listening for Commands...")
+	tracker := newOffsetTracker(session)
+	// inFlight tracks the Commands dispatched from this claim which
+	// are not yet processed
+	inFlight := &sync.WaitGroup{}
 
 	for msg := range claim.Messages() {
 		if msg == nil {
 			continue
 		}
+		inFlight.Add(1)
+		// Offsets are committed in Kafka-transactions in exactly-once mode
+		done := inFlight.Done
+		if m.handleTxn == nil {
+			tm := tracker.track(msg)
+			done = func() {
+				tracker.complete(tm)
+				inFlight.Done()
+			}
+		}
 
-		go func(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) {
-			session.MarkMessage(msg, "")
+		cmd := &cmodel.Command{}
+		err := json.Unmarshal(msg.Value, cmd)
+		if err != nil {
+			err = errors.Wrap(err, "Error unmarshalling to Command")
+			log.Println(err)
+			m.deadLetter(msg, nil, 1, err)
+			m.commitSkipped(msg)
+			done()
+			continue
+		}
+		log.Printf("Received Command with ID: %s", cmd.UUID)
 
-			cmd := &model.Command{}
-			err := json.Unmarshal(msg.Value, cmd)
-			if err != nil {
-				err = errors.Wrap(err, "Error unmarshalling to Command")
-				log.Println(err)
-				return
-			}
-			log.Printf("Received Command with ID: %s", cmd.UUID)
+		keys := shardKeys(cmd)
+		// Transactions commit offsets of each Command, so Commands
+		// must be processed in order they were received
+		if m.handleTxn != nil {
+			keys = append(keys, orderedShardKey)
+		}
+		m.workerPool.dispatch(keys, &cmdJob{
+			cmd:  cmd,
+			msg:  msg,
+			done: done,
+		})
+	}
 
-			if cmd.ResponseTopic == "" {
-				log.Println("Command contains empty ResponseTopic")
-				return
-			}
-			if cmd.Action == "" {
-				log.Println("Comman contains empty Action")
-				return
-			}
+	// Offsets of Commands completed before the session ends are
+	// still committed, so these are not redelivered
+	log.Println("Waiting for in-flight Commands...")
+	deadline := m.drainDeadline()
+	if !waitTimeout(inFlight, time.Until(deadline)) {
+		log.Printf(
+			"In-flight Commands did not finish by %s, these might be redelivered",
+			deadline.Format(time.RFC3339),
+		)
+	}
+	return errors.New("context-closed")
+}
 
-			ttlSec := time.Duration(cmd.TTLSec) * time.Second
-			expTime := time.Unix(cmd.Timestamp, 0).Add(ttlSec).UTC()
-			curTime := time.Now().UTC()
-			if expTime.Before(curTime) {
-				log.Printf("Command expired, ignoring")
-				return
-			}
+// drainBy limits the time claims wait for their in-flight Commands once they
+// end, so shutdown can complete by its deadline.
+func (m *cmdConsumer) drainBy(deadline time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.shutdownDeadline = deadline
+}
 
-			err = domain.BuildState(m.collection, m.builderFunc, m.builderTimeoutSec)
-			if err != nil {
-				err = errors.Wrap(err, "Error building Aggregate-state")
-				log.Println(err)
-				return
-			}
+// drainDeadline is the latest time a claim ending now waits for
+// its in-flight Commands.
+func (m *cmdConsumer) drainDeadline() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 
-			m.handle(cmd)
-		}(session, msg)
+	deadline := time.Now().Add(m.drainTimeout)
+	if !m.shutdownDeadline.IsZero() && m.shutdownDeadline.Before(deadline) {
+		return m.shutdownDeadline
 	}
-	return errors.New("context-closed")
+	return deadline
+}
+
+// close stops processing Commands once the queued Commands are processed.
+// The returned channel is closed when processing has stopped.
+// This must only be called after consuming has stopped.
+func (m *cmdConsumer) close() <-chan struct{} {
+	return m.workerPool.stop()
+}
+
+// retryDelay is the delay before retrying a Command after the attempts.
+func (m *cmdConsumer) retryDelay(attempts int) time.Duration {
+	delay := time.Duration(attempts) * m.retryBackoff
+	if delay > m.maxRetryBackoff || delay < 0 {
+		return m.maxRetryBackoff
+	}
+	return delay
+}
+
+// processJob processes the Command, retrying upto maxAttempts if processing
+// fails. Commands which panic or still fail are published to dead-letter
+// topic, and an error is sent as response.
+func (m *cmdConsumer) processJob(job *cmdJob) {
+	// Commands not handled in a Kafka-transaction still need their
+	// offsets committed in exactly-once mode
+	defer func() {
+		if !job.committed {
+			m.commitSkipped(job.msg)
+		}
+	}()
+
+	var err error
+	for attempt := 1; attempt <= m.maxAttempts; attempt++ {
+		var isPanic bool
+		isPanic, err = m.safeProcessCmd(job)
+		if err == nil {
+			return
+		}
+		log.Printf(
+			"Error processing Command with ID: %s, attempt %d of %d: %s",
+			job.cmd.UUID, attempt, m.maxAttempts, err,
+		)
+		// Panics are not transient, so retrying would panic again
+		if isPanic {
+			m.deadLetter(job.msg, job.cmd, attempt, err)
+			m.respondError(job.cmd, cmodel.InternalError, err)
+			return
+		}
+		if attempt < m.maxAttempts {
+			time.Sleep(m.retryDelay(attempt))
+		}
+	}
+
+	m.deadLetter(job.msg, job.cmd, m.maxAttempts, err)
+	code := int16(cmodel.InternalError)
+	if cmdErr, isCmdErr := err.(*cmdError); isCmdErr {
+		code = cmdErr.code
+	}
+	m.respondError(job.cmd, code, err)
+}
+
+// safeProcessCmd processes the Command, converting panics into errors.
+func (m *cmdConsumer) safeProcessCmd(job *cmdJob) (isPanic bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf(
+				"Recovered from panic in Command with ID: %s: %v\n%s",
+				job.cmd.UUID, r, debug.Stack(),
+			)
+			isPanic = true
+			err = fmt.Errorf("panic while processing command: %v", r)
+		}
+	}()
+	return false, m.processCmd(job)
+}
+
+// processCmd validates the Command and handles it after building Aggregate-state.
+// Invalid Commands are responded with an error. A cmdError is returned if the
+// Command could not be handled and can be retried.
+func (m *cmdConsumer) processCmd(job *cmdJob) error {
+	cmd := job.cmd
+	if cmd.ResponseTopic == "" {
+		log.Println("Command contains empty ResponseTopic")
+		return nil
+	}
+	if cmd.Action == "" {
+		err := errors.New("Command contains empty Action")
+		log.Println(err)
+		m.respondError(cmd, model.MissingActionError, err)
+		return nil
+	}
+
+	ttlSec := time.Duration(cmd.TTLSec) * time.Second
+	expTime := time.Unix(cmd.Timestamp, 0).Add(ttlSec).UTC()
+	curTime := m.clock.Now().UTC()
+	if expTime.Before(curTime) {
+		err := fmt.Errorf("Command expired at %s", expTime.Format(time.RFC3339))
+		log.Printf("Command with ID: %s: %s", cmd.UUID, err)
+		m.respondError(cmd, model.ExpiredError, err)
+		return nil
+	}
+
+	_, err := m.stateBuilder.Build()
+	if err != nil {
+		return &cmdError{
+			code: model.StateUnavailableError,
+			err:  errors.Wrap(err, "Error building Aggregate-state"),
+		}
+	}
+
+	if m.handleTxn != nil {
+		err = m.handleTxn(cmd, job.msg)
+		if err != nil {
+			return errors.Wrap(err, "Error handling Command in transaction")
+		}
+		job.committed = true
+	} else {
+		err = m.handle(cmd)
+		if err != nil {
+			return errors.Wrap(err, "Error handling Command")
+		}
+	}
+	// Handling the Command might have produced new Events
+	m.stateBuilder.MarkDirty()
+	return nil
+}
+
+// commitSkipped commits the offset of a message which was not handled in
+// a Kafka-transaction, in exactly-once mode. Offsets are otherwise marked
+// by offsetTracker once the message completes.
+func (m *cmdConsumer) commitSkipped(msg *sarama.ConsumerMessage) {
+	if m.handleTxn == nil {
+		return
+	}
+	err := m.commitOffset(msg)
+	if err != nil {
+		err = errors.Wrapf(
+			err,
+			"Error committing offset %d of partition %d, message will be redelivered",
+			msg.Offset, msg.Partition,
+		)
+		log.Println(err)
+	}
+}
+
+// respondError sends the error as response to the Command.
+func (m *cmdConsumer) respondError(cmd *cmodel.Command, code int16, err error) {
+	if cmd.ResponseTopic == "" {
+		log.Printf("Cannot respond to Command with ID: %s: empty ResponseTopic", cmd.UUID)
+		return
+	}
+
+	docID, uuidErr := m.idGen.NewID()
+	if uuidErr != nil {
+		uuidErr = errors.Wrap(uuidErr, "Error generating Document-UUID")
+		log.Println(uuidErr)
+	}
+	m.respProd <- &cmodel.Document{
+		CorrelationID: cmd.UUID,
+		Error:         err.Error(),
+		ErrorCode:     code,
+		Source:        m.serviceName,
+		Topic:         cmd.ResponseTopic,
+		UUID:          docID,
+	}
+}
+
+// deadLetter publishes the message to dead-letter topic.
+// cmd is nil if the message could not be decoded into Command.
+func (m *cmdConsumer) deadLetter(
+	msg *sarama.ConsumerMessage,
+	cmd *cmodel.Command,
+	attempts int,
+	err error,
+) {
+	deadLetter := &model.DeadLetter{
+		Attempts:  attempts,
+		Error:     err.Error(),
+		FailedAt:  m.clock.Now().UTC().Unix(),
+		Key:       msg.Key,
+		Offset:    msg.Offset,
+		Partition: msg.Partition,
+		Payload:   msg.Value,
+		Timestamp: msg.Timestamp.UTC().Unix(),
+		Topic:     msg.Topic,
+	}
+	if cmd != nil {
+		deadLetter.CommandUUID = cmd.UUID.String()
+	}
+
+	log.Printf(
+		"Publishing message from topic %s, partition %d, offset %d to dead-letter topic",
+		msg.Topic, msg.Partition, msg.Offset,
+	)
+	m.deadLetterProd <- deadLetter
 }
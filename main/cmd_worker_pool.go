@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/TerrexTech/go-common-models/model"
+)
+
+// cmdJob is a Command queued for processing by a worker, along with the
+// message it was received in. done is called once the Command has been processed.
+type cmdJob struct {
+	cmd  *model.Command
+	msg  *sarama.ConsumerMessage
+	done func()
+	// committed is true once the message's offset was committed
+	// in a Kafka-transaction.
+	committed bool
+
+	// keys are the shard-keys of the job. waits is the number of unfinished
+	// jobs the job must wait for, and next are the jobs waiting for it.
+	// These are guarded by the pool's lock.
+	keys  []string
+	waits int
+	next  []*cmdJob
+}
+
+// cmdWorkerPool processes Commands using a fixed number of workers.
+// A job only starts once the jobs dispatched before it with any of same
+// shard-keys have been processed, so Commands for same key are processed in
+// order they were received. Jobs with itemFilterShardKey wait for all jobs
+// with Item-keys, and those wait for them.
+type cmdWorkerPool struct {
+	ready chan *cmdJob
+	// slots limits the jobs dispatched but not yet processed.
+	slots   chan struct{}
+	pending sync.WaitGroup
+	wg      sync.WaitGroup
+
+	lock sync.Mutex
+	// last is the latest unfinished job for each shard-key.
+	last map[string]*cmdJob
+	// itemJobs are the unfinished jobs with Item-keys dispatched since
+	// lastFilter, which is the latest unfinished job with itemFilterShardKey.
+	itemJobs   map[*cmdJob]struct{}
+	lastFilter *cmdJob
+}
+
+func newCmdWorkerPool(
+	workerCount int,
+	bufferSize int,
+	process func(*cmdJob),
+) *cmdWorkerPool {
+	// All dispatched jobs fit in ready, so finishing
+	// jobs never block on queueing the jobs waiting for them
+	capacity := workerCount * bufferSize
+	pool := &cmdWorkerPool{
+		ready:    make(chan *cmdJob, capacity),
+		slots:    make(chan struct{}, capacity),
+		last:     map[string]*cmdJob{},
+		itemJobs: map[*cmdJob]struct{}{},
+	}
+	for i := 0; i < workerCount; i++ {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for job := range pool.ready {
+				process(job)
+				pool.finish(job)
+				job.done()
+			}
+		}()
+	}
+	return pool
+}
+
+// stop stops the workers once they have processed the dispatched jobs.
+// The returned channel is closed when all workers have stopped.
+// No jobs must be dispatched after calling stop.
+func (p *cmdWorkerPool) stop() <-chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		p.pending.Wait()
+		close(p.ready)
+		p.wg.Wait()
+		close(stopped)
+	}()
+	return stopped
+}
+
+// dispatch queues the job to be processed once the jobs it waits for
+// have been processed. This blocks if the pool is full.
+func (p *cmdWorkerPool) dispatch(keys []string, job *cmdJob) {
+	p.slots <- struct{}{}
+	p.pending.Add(1)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	job.keys = keys
+	waitFor := func(prev *cmdJob) {
+		if prev != nil && prev != job {
+			prev.next = append(prev.next, job)
+			job.waits++
+		}
+	}
+
+	isItemJob := false
+	for _, key := range keys {
+		// Jobs with duplicate keys only wait once
+		if p.last[key] != job {
+			waitFor(p.last[key])
+			p.last[key] = job
+		}
+		if strings.HasPrefix(key, itemShardKeyPrefix) {
+			isItemJob = true
+		}
+		if key == itemFilterShardKey {
+			for itemJob := range p.itemJobs {
+				waitFor(itemJob)
+			}
+			// Later jobs wait for this job, which waits for these
+			p.itemJobs = map[*cmdJob]struct{}{}
+			p.lastFilter = job
+		}
+	}
+	if isItemJob {
+		if p.lastFilter != job {
+			waitFor(p.lastFilter)
+		}
+		p.itemJobs[job] = struct{}{}
+	}
+
+	if job.waits == 0 {
+		p.ready <- job
+	}
+}
+
+// finish queues the jobs which were only waiting for the processed job.
+func (p *cmdWorkerPool) finish(job *cmdJob) {
+	p.lock.Lock()
+	for _, key := range job.keys {
+		if p.last[key] == job {
+			delete(p.last, key)
+		}
+	}
+	delete(p.itemJobs, job)
+	if p.lastFilter == job {
+		p.lastFilter = nil
+	}
+	for _, next := range job.next {
+		next.waits--
+		if next.waits == 0 {
+			p.ready <- next
+		}
+	}
+	job.next = nil
+	p.lock.Unlock()
+
+	<-p.slots
+	p.pending.Done()
+}
+
+// shardKeyParams are the fields used from Command-data to generate shard-keys.
+type shardKeyParams struct {
+	ShipmentID string `json:"shipmentID,omitempty"`
+	ItemID     string `json:"itemID,omitempty"`
+	Filter     *struct {
+		ItemID string `json:"itemID,omitempty"`
+	} `json:"filter,omitempty"`
+}
+
+// Shard-keys of Commands. Commands changing an Item or Shipment are keyed
+// using its ID with these prefixes.
+const (
+	itemShardKeyPrefix     = "item:"
+	shipmentShardKeyPrefix = "shipment:"
+	// itemFilterShardKey is the shard-key for Commands which change the
+	// Items matching a filter without an ItemID. These can change any Item,
+	// so they are processed in order with all Commands changing Items.
+	itemFilterShardKey = "items:filter"
+	// orderedShardKey is added to all Commands when these must be processed
+	// in order they were received, such as in exactly-once mode.
+	orderedShardKey = "cmd:ordered"
+)
+
+// shardKeys returns the keys used for ordering Commands, which are the
+// Items and Shipments changed by the Command. Commands adding or removing
+// an Item from a Shipment are keyed on both, so these are in order with the
+// other Commands for the Shipment, and with Commands changing the Item's
+// version. Commands without a Shipment or Item have no keys, since those
+// can be processed in any order.
+func shardKeys(cmd *model.Command) []string {
+	params := &shardKeyParams{}
+	err := json.Unmarshal(cmd.Data, params)
+	if err != nil {
+		return nil
+	}
+
+	keys := []string{}
+	if params.ShipmentID != "" {
+		keys = append(keys, shipmentShardKeyPrefix+params.ShipmentID)
+	}
+	switch {
+	case params.ItemID != "":
+		keys = append(keys, itemShardKeyPrefix+params.ItemID)
+	case params.Filter != nil && params.Filter.ItemID != "":
+		keys = append(keys, itemShardKeyPrefix+params.Filter.ItemID)
+	case params.Filter != nil:
+		keys = append(keys, itemFilterShardKey)
+	// DeleteItem-data is the filter itself
+	case cmd.Action == "DeleteItem":
+		keys = append(keys, itemFilterShardKey)
+	}
+	return keys
+}
@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/TerrexTech/agg-shipment-cmd/command"
 	"github.com/TerrexTech/agg-shipment-cmd/connutil"
+	"github.com/TerrexTech/agg-shipment-cmd/domain"
 	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
 	"github.com/TerrexTech/go-agg-builder/builder"
 	"github.com/TerrexTech/go-commonutils/commonutil"
 	"github.com/TerrexTech/go-kafkautils/kafka"
@@ -41,6 +49,7 @@ func validateEnv() {
 
 		"KAFKA_PRODUCER_TOPIC_ESREQ",
 		"KAFKA_PRODUCER_TOPIC_EVENTS",
+		"KAFKA_PRODUCER_TOPIC_DEADLETTER",
 
 		"KAFKA_END_OF_STREAM_TOKEN",
 
@@ -49,6 +58,8 @@ func validateEnv() {
 		"MONGO_DATABASE",
 		"MONGO_AGG_COLLECTION",
 		"MONGO_META_COLLECTION",
+		"MONGO_SHIPMENT_COLLECTION",
+		"MONGO_PROCESSED_CMD_COLLECTION",
 
 		"MONGO_CONNECTION_TIMEOUT_MS",
 	)
@@ -60,6 +71,16 @@ func validateEnv() {
 }
 
 func main() {
+	forceSnapshotFlag := flag.Bool(
+		"snapshot", false,
+		"Build Aggregate-state, take its Snapshot, and exit",
+	)
+	verifySnapshotFlag := flag.Bool(
+		"verify-snapshot", false,
+		"Verify the latest Snapshot against a replay of Events, and exit",
+	)
+	flag.Parse()
+
 	validateEnv()
 
 	kafkaBrokersStr := os.Getenv("KAFKA_BROKERS")
@@ -89,12 +110,25 @@ func main() {
 		EOSToken:        eosToken,
 	}
 
+	// Checked before connecting to Mongo, so an unsupported
+	// backend is reported as such
+	storageBackend, err := connutil.StorageBackend()
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing Aggregate-state storage")
+		log.Fatalln(err)
+	}
+
 	// Mongo Config
 	mc, err := connutil.LoadMongoConfig()
 	if err != nil {
 		err = errors.Wrap(err, "Error initializing MongoConfig")
 		log.Fatalln(err)
 	}
+	storage, err := connutil.LoadStorage(storageBackend, mc)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing Aggregate-state storage")
+		log.Fatalln(err)
+	}
 	eventsIO, err := builder.Init(builder.IOConfig{
 		KafkaConfig: kc,
 		MongoConfig: *mc,
@@ -104,10 +138,29 @@ func main() {
 		log.Fatalln(err)
 	}
 
+	prodRetryMaxStr := os.Getenv("KAFKA_PRODUCER_RETRY_MAX")
+	prodRetryMax, err := strconv.Atoi(prodRetryMaxStr)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting KAFKA_PRODUCER_RETRY_MAX to integer")
+		log.Println(err)
+		log.Println("A default value of 5 will be used for KAFKA_PRODUCER_RETRY_MAX")
+		prodRetryMax = 5
+	}
+	prodRetryBackoffStr := os.Getenv("KAFKA_PRODUCER_RETRY_BACKOFF_MS")
+	prodRetryBackoff, err := strconv.Atoi(prodRetryBackoffStr)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting KAFKA_PRODUCER_RETRY_BACKOFF_MS to integer")
+		log.Println(err)
+		log.Println("A default value of 250 will be used for KAFKA_PRODUCER_RETRY_BACKOFF_MS")
+		prodRetryBackoff = 250
+	}
 	prodConfig := &producerConfig{
-		ctx:         eventsIO.Context(),
-		kafkaConfig: kafkaProdConfig,
-		g:           eventsIO.ErrGroup(),
+		ctx:          eventsIO.Context(),
+		kafkaConfig:  kafkaProdConfig,
+		g:            eventsIO.ErrGroup(),
+		retryMax:     prodRetryMax,
+		retryBackoff: time.Duration(prodRetryBackoff) * time.Millisecond,
+		closed:       &sync.WaitGroup{},
 	}
 	// Event Producer
 	eventsTopic := os.Getenv("KAFKA_PRODUCER_TOPIC_EVENTS")
@@ -122,28 +175,159 @@ func main() {
 		err = errors.Wrap(err, "Error creating ResponseProducer")
 		log.Fatalln(err)
 	}
+	// Dead-Letter Producer
+	deadLetterTopic := os.Getenv("KAFKA_PRODUCER_TOPIC_DEADLETTER")
+	deadLetterChan, err := deadLetterProducer(prodConfig, deadLetterTopic)
+	if err != nil {
+		err = errors.Wrap(err, "Error creating DeadLetterProducer")
+		log.Fatalln(err)
+	}
+
+	// Exactly-once mode publishes Events and results in Kafka-transactions
+	exactlyOnce := os.Getenv("KAFKA_EXACTLY_ONCE") == "true"
+
+	shutdownTimeoutStr := os.Getenv("SHUTDOWN_TIMEOUT_SEC")
+	shutdownTimeout, err := strconv.Atoi(shutdownTimeoutStr)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting SHUTDOWN_TIMEOUT_SEC to integer")
+		log.Println(err)
+		log.Println("A default value of 30 will be used for SHUTDOWN_TIMEOUT_SEC")
+		shutdownTimeout = 30
+	}
+	shutdownConf := &shutdownConfig{
+		timeout:        time.Duration(shutdownTimeout) * time.Second,
+		eventProd:      eventChan,
+		respProd:       respChan,
+		deadLetterProd: deadLetterChan,
+		prodClosed:     prodConfig.closed,
+		storage:        storage,
+		mongoClient:    mc.Connection.Client,
+	}
+
+	clock := model.SystemClock{}
+
+	// Outbox Relay
+	var outboxRepo repository.OutboxRepository
+	if os.Getenv("OUTBOX_ENABLED") == "true" && exactlyOnce {
+		log.Println("Outbox is not used in exactly-once mode")
+	} else if os.Getenv("OUTBOX_ENABLED") == "true" {
+		outboxColl, err := connutil.LoadOutboxCollection(mc)
+		if err != nil {
+			err = errors.Wrap(err, "Error initializing Outbox-Collection")
+			log.Fatalln(err)
+		}
+		outboxRepo, err = repository.NewMongoOutboxRepository(outboxColl)
+		if err != nil {
+			err = errors.Wrap(err, "Error initializing Outbox-Repository")
+			log.Fatalln(err)
+		}
+
+		pollIntervalStr := os.Getenv("OUTBOX_POLL_INTERVAL_MS")
+		pollInterval, err := strconv.Atoi(pollIntervalStr)
+		if err != nil {
+			err = errors.Wrap(err, "Error converting OUTBOX_POLL_INTERVAL_MS to integer")
+			log.Println(err)
+			log.Println("A default value of 500 will be used for OUTBOX_POLL_INTERVAL_MS")
+			pollInterval = 500
+		}
+		retentionStr := os.Getenv("OUTBOX_RETENTION_SEC")
+		retention, err := strconv.Atoi(retentionStr)
+		if err != nil {
+			err = errors.Wrap(err, "Error converting OUTBOX_RETENTION_SEC to integer")
+			log.Println(err)
+			log.Println("A default value of 86400 will be used for OUTBOX_RETENTION_SEC")
+			retention = 86400
+		}
+
+		relay, err := newOutboxRelay(outboxRelayConfig{
+			coll:         outboxColl,
+			kafkaConfig:  kafkaProdConfig,
+			eventTopic:   eventsTopic,
+			pollInterval: time.Duration(pollInterval) * time.Millisecond,
+			retention:    time.Duration(retention) * time.Second,
+			clock:        clock,
+		})
+		if err != nil {
+			err = errors.Wrap(err, "Error initializing Outbox-Relay")
+			log.Fatalln(err)
+		}
+		relayCtx, stopRelay := context.WithCancel(prodConfig.ctx)
+		relayed := make(chan struct{})
+		prodConfig.g.Go(func() error {
+			defer close(relayed)
+			return relay.run(relayCtx)
+		})
+		shutdownConf.stopRelay = stopRelay
+		shutdownConf.relayed = relayed
+	}
+
+	idGen := model.RandomIDGenerator{}
 
 	// Command Handler
+	middlewares := []command.Middleware{
+		command.RecoveryMiddleware(),
+	}
+	cmdTimeoutStr := os.Getenv("CMD_TIMEOUT_MS")
+	cmdTimeout, err := strconv.Atoi(cmdTimeoutStr)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting CMD_TIMEOUT_MS to integer")
+		log.Println(err)
+		log.Println("A default value of 0 will be used for CMD_TIMEOUT_MS")
+		cmdTimeout = 0
+	}
+	if cmdTimeout > 0 {
+		middlewares = append(
+			middlewares,
+			command.TimeoutMiddleware(time.Duration(cmdTimeout)*time.Millisecond),
+		)
+	}
+
+	var auditRepo repository.AuditRepository
+	if os.Getenv("AUDIT_ENABLED") == "true" {
+		auditColl, err := connutil.LoadAuditCollection(mc)
+		if err != nil {
+			err = errors.Wrap(err, "Error initializing Audit-Collection")
+			log.Fatalln(err)
+		}
+		auditRepo, err = repository.NewMongoAuditRepository(auditColl)
+		if err != nil {
+			err = errors.Wrap(err, "Error initializing Audit-Repository")
+			log.Fatalln(err)
+		}
+	}
+
 	serviceName := os.Getenv("SERVICE_NAME")
 	cmdHandler, err := command.NewHandler(&command.HandlerConfig{
-		Coll:        mc.AggCollection,
+		Items:       storage.Items,
+		Shipments:   storage.Shipments,
+		Processed:   storage.Processed,
+		Outbox:      outboxRepo,
+		Audit:       auditRepo,
 		ServiceName: serviceName,
 		EventProd:   eventChan,
 		ResultProd:  respChan,
+		Middlewares: middlewares,
+		Clock:       clock,
+		IDGen:       idGen,
 	})
 	if err != nil {
 		err = errors.Wrap(err, "Error initializing command-handler")
 		log.Fatalln(err)
 	}
+	log.Printf("Registered Command-Actions: %v", command.RegisteredActions())
 
 	// Command Consumer
 	cmdConsGroup := os.Getenv("KAFKA_CONSUMER_GROUP_REQUEST")
 	cmdConsTopic := os.Getenv("KAFKA_CONSUMER_TOPIC_REQUEST")
-	cmdCons, err := kafka.NewConsumer(&kafka.ConsumerConfig{
+	kafkaConsConfig := &kafka.ConsumerConfig{
 		KafkaBrokers: kafkaBrokers,
 		GroupName:    cmdConsGroup,
 		Topics:       []string{cmdConsTopic},
-	})
+	}
+	if exactlyOnce {
+		kafkaConsConfig.SaramaConfig = txnConsumerSaramaConfig()
+	}
+	cmdCons, err := kafka.NewConsumer(kafkaConsConfig)
 	if err != nil {
 		err = errors.Wrap(err, "Error creating consumer")
 		log.Fatalln(err)
@@ -157,19 +341,206 @@ func main() {
 		log.Println("A defalt value of 5 will be used for AGG_BUILDER_TIMEOUT_SEC")
 		builderTimeoutSec = 5
 	}
-	handler, err := newCmdConsumer(cmdConsConfig{
-		collection:        mc.AggCollection,
-		builderFunc:       eventsIO.BuildState,
-		builderTimeoutSec: builderTimeoutSec,
-		handle:            cmdHandler.Handle,
-	})
+	workerCountStr := os.Getenv("CMD_WORKER_COUNT")
+	workerCount, err := strconv.Atoi(workerCountStr)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting CMD_WORKER_COUNT to integer")
+		log.Println(err)
+		log.Println("A default value of 16 will be used for CMD_WORKER_COUNT")
+		workerCount = 16
+	}
+	// Transactions commit offsets of each Command, so Commands must
+	// be processed in order they were received
+	if exactlyOnce && workerCount != 1 {
+		log.Println("A single worker will be used in exactly-once mode")
+		workerCount = 1
+	}
+	maxAttemptsStr := os.Getenv("CMD_MAX_ATTEMPTS")
+	maxAttempts, err := strconv.Atoi(maxAttemptsStr)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting CMD_MAX_ATTEMPTS to integer")
+		log.Println(err)
+		log.Println("A default value of 3 will be used for CMD_MAX_ATTEMPTS")
+		maxAttempts = 3
+	}
+	retryBackoffStr := os.Getenv("CMD_RETRY_BACKOFF_MS")
+	retryBackoff, err := strconv.Atoi(retryBackoffStr)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting CMD_RETRY_BACKOFF_MS to integer")
+		log.Println(err)
+		log.Println("A default value of 500 will be used for CMD_RETRY_BACKOFF_MS")
+		retryBackoff = 500
+	}
+	maxRetryBackoffStr := os.Getenv("CMD_MAX_RETRY_BACKOFF_MS")
+	maxRetryBackoff, err := strconv.Atoi(maxRetryBackoffStr)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting CMD_MAX_RETRY_BACKOFF_MS to integer")
+		log.Println(err)
+		log.Println("A default value of 2000 will be used for CMD_MAX_RETRY_BACKOFF_MS")
+		maxRetryBackoff = 2000
+	}
+	stateBuilderConfig := &domain.StateBuilderConfig{
+		Items:       storage.Items,
+		Shipments:   storage.Shipments,
+		BuilderFunc: eventsIO.BuildState,
+		TimeoutSec:  builderTimeoutSec,
+		Clock:       clock,
+		IDGen:       idGen,
+	}
+	if os.Getenv("AGG_BUILDER_INCREMENTAL") == "true" {
+		minIntervalStr := os.Getenv("AGG_BUILDER_MIN_INTERVAL_MS")
+		minInterval, err := strconv.Atoi(minIntervalStr)
+		if err != nil {
+			err = errors.Wrap(err, "Error converting AGG_BUILDER_MIN_INTERVAL_MS to integer")
+			log.Println(err)
+			log.Println("A default value of 0 will be used for AGG_BUILDER_MIN_INTERVAL_MS")
+			minInterval = 0
+		}
+		lateWindowStr := os.Getenv("AGG_BUILDER_LATE_WINDOW_MS")
+		lateWindow, err := strconv.Atoi(lateWindowStr)
+		if err != nil {
+			err = errors.Wrap(err, "Error converting AGG_BUILDER_LATE_WINDOW_MS to integer")
+			log.Println(err)
+			log.Println("A default value of 60000 will be used for AGG_BUILDER_LATE_WINDOW_MS")
+			lateWindow = 60000
+		}
+
+		stateBuilderConfig.Incremental = true
+		stateBuilderConfig.HWMs = storage.HWMs
+		stateBuilderConfig.MinInterval = time.Duration(minInterval) * time.Millisecond
+		stateBuilderConfig.LateEventWindow = time.Duration(lateWindow) * time.Millisecond
+	}
+	unknownEvents, err := domain.ParseUnknownEventPolicy(
+		os.Getenv("AGG_BUILDER_UNKNOWN_EVENTS"),
+	)
+	if err != nil {
+		err = errors.Wrap(err, "Error parsing AGG_BUILDER_UNKNOWN_EVENTS")
+		log.Println(err)
+		log.Println("A default value of skip will be used for AGG_BUILDER_UNKNOWN_EVENTS")
+	}
+	stateBuilderConfig.UnknownEvents = unknownEvents
+	if unknownEvents == domain.ParkUnknownEvents {
+		parkedColl, err := connutil.LoadParkedEventCollection(mc)
+		if err != nil {
+			err = errors.Wrap(err, "Error initializing ParkedEvent-Collection")
+			log.Fatalln(err)
+		}
+		stateBuilderConfig.ParkedColl = parkedColl
+	}
+	stateBuilder, err := domain.NewStateBuilder(stateBuilderConfig)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing StateBuilder")
+		log.Fatalln(err)
+	}
+
+	// Snapshots require HighWaterMark, which is only available in incremental mode
+	if stateBuilderConfig.Incremental {
+		snapshotter, err := newSnapshotter(mc, stateBuilder)
+		if err != nil {
+			err = errors.Wrap(err, "Error initializing Snapshotter")
+			log.Fatalln(err)
+		}
+
+		if *forceSnapshotFlag {
+			err = forceSnapshot(stateBuilder, snapshotter)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
+		if *verifySnapshotFlag {
+			err = verifySnapshot(mc, snapshotter, eventsIO.BuildState)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
+
+		_, err = snapshotter.Restore()
+		if err != nil {
+			err = errors.Wrap(err, "Error restoring Aggregate-state from Snapshot")
+			log.Fatalln(err)
+		}
+		go snapshotter.Run(eventsIO.Context())
+	} else if *forceSnapshotFlag || *verifySnapshotFlag {
+		log.Fatalln("Snapshots require AGG_BUILDER_INCREMENTAL to be true")
+	}
+
+	consConfig := cmdConsConfig{
+		stateBuilder:    stateBuilder,
+		handle:          cmdHandler.Handle,
+		workerCount:     workerCount,
+		serviceName:     serviceName,
+		respProd:        respChan,
+		deadLetterProd:  deadLetterChan,
+		maxAttempts:     maxAttempts,
+		retryBackoff:    time.Duration(retryBackoff) * time.Millisecond,
+		maxRetryBackoff: time.Duration(maxRetryBackoff) * time.Millisecond,
+		drainTimeout:    shutdownConf.consumeTimeout(),
+		clock:           clock,
+		idGen:           idGen,
+	}
+	if exactlyOnce {
+		transactionalID := os.Getenv("KAFKA_TRANSACTIONAL_ID")
+		if transactionalID == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				err = errors.Wrap(err, "Error getting hostname for KAFKA_TRANSACTIONAL_ID")
+				log.Fatalln(err)
+			}
+			transactionalID = serviceName + "-" + hostname
+			log.Printf("A default value of %s will be used for KAFKA_TRANSACTIONAL_ID", transactionalID)
+		}
+
+		txnProd, err := newTxnProducer(txnProducerConfig{
+			kafkaBrokers:    kafkaBrokers,
+			transactionalID: transactionalID,
+			groupID:         cmdConsGroup,
+			eventTopic:      eventsTopic,
+		})
+		if err != nil {
+			err = errors.Wrap(err, "Error initializing Transactional-Producer")
+			log.Fatalln(err)
+		}
+		consConfig.handleTxn = txnHandler(cmdHandler, txnProd)
+		consConfig.commitOffset = txnProd.commitOffset
+		shutdownConf.txnProd = txnProd
+	}
+
+	handler, err := newCmdConsumer(consConfig)
 	if err != nil {
 		err = errors.Wrap(err, "Error initializing Cmd-Handler")
 		log.Fatalln(err)
 	}
-	err = cmdCons.Consume(eventsIO.Context(), handler)
+	consCtx, stopConsuming := context.WithCancel(eventsIO.Context())
+	consumed := make(chan struct{})
+	var consErr error
+	go func() {
+		defer close(consumed)
+		consErr = cmdCons.Consume(consCtx, handler)
+	}()
+	shutdownConf.stopConsuming = stopConsuming
+	shutdownConf.consumed = consumed
+	shutdownConf.cmdCons = cmdCons
+	shutdownConf.cmdConsumer = handler
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case sig := <-sigChan:
+		log.Printf("Received %s, shutting down", sig)
+	case <-consumed:
+		if consErr != nil {
+			err = errors.Wrap(consErr, "Error while attempting to consume Commands")
+			log.Fatalln(err)
+		}
+		log.Println("Stopped consuming Commands, shutting down")
+	}
+
+	err = shutdown(shutdownConf)
 	if err != nil {
-		err = errors.Wrap(err, "Error while attempting to consume Commands")
+		err = errors.Wrap(err, "Error shutting down gracefully")
 		log.Fatalln(err)
 	}
+	log.Println("Shutdown complete")
 }
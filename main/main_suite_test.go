@@ -0,0 +1,1019 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/TerrexTech/agg-shipment-cmd/command"
+	"github.com/TerrexTech/agg-shipment-cmd/domain"
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	"github.com/TerrexTech/agg-shipment-cmd/test/harness"
+	"github.com/TerrexTech/agg-shipment-cmd/validation"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/TerrexTech/go-kafkautils/kafka"
+	"github.com/TerrexTech/uuuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+// TestMain runs the Command → Event → result flow using the in-process
+// Kafka and event-store from test/harness, so no services are required.
+func TestMain(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Main Suite")
+}
+
+const (
+	testReqTopic  = "agg-shipment-cmd.request"
+	testRespTopic = "agg-shipment-cmd.response"
+	resultTimeout = 5 * time.Second
+)
+
+func newTestCmd(action string, data interface{}) *cmodel.Command {
+	marshalData, err := json.Marshal(data)
+	Expect(err).ToNot(HaveOccurred())
+	cid, err := uuuid.NewV4()
+	Expect(err).ToNot(HaveOccurred())
+	uuid, err := uuuid.NewV4()
+	Expect(err).ToNot(HaveOccurred())
+
+	return &cmodel.Command{
+		Action:        action,
+		CorrelationID: cid,
+		Data:          marshalData,
+		ResponseTopic: testRespTopic,
+		Source:        "test-source",
+		SourceTopic:   testReqTopic,
+		Timestamp:     time.Now().UTC().Unix(),
+		TTLSec:        15,
+		UUID:          uuid,
+	}
+}
+
+func newTestItem() *model.Item {
+	itemID, err := uuuid.NewV4()
+	Expect(err).ToNot(HaveOccurred())
+
+	return &model.Item{
+		ItemID:       itemID.String(),
+		DateArrived:  time.Now().Unix(),
+		Lot:          "test-lot",
+		Name:         "test-name",
+		Origin:       "test-origin",
+		Price:        13.4,
+		RSCustomerID: "test-customer",
+		SKU:          "test-sku",
+		Timestamp:    time.Now().Unix(),
+		TotalWeight:  4.7,
+		UPC:          "00036000291452",
+	}
+}
+
+var _ = Describe("CmdConsumer", func() {
+	var (
+		store     *harness.EventStore
+		producers *harness.Producers
+		claim     *harness.Claim
+		session   *harness.Session
+		consumer  *cmdConsumer
+
+		cancelSession context.CancelFunc
+		consumeDone   chan struct{}
+	)
+
+	// send sends the Command to consumer and waits for its count-th result.
+	send := func(cmd *cmodel.Command, count int) *cmodel.Document {
+		_, err := claim.SendCommand(cmd)
+		Expect(err).ToNot(HaveOccurred())
+		doc, err := producers.Result(cmd.UUID, count, resultTimeout)
+		Expect(err).ToNot(HaveOccurred())
+		return doc
+	}
+
+	BeforeEach(func() {
+		items := repository.NewMemoryItemRepository()
+		shipments := repository.NewMemoryShipmentRepository()
+		store = harness.NewEventStore()
+		producers = harness.NewProducers(store)
+
+		handler, err := command.NewHandler(&command.HandlerConfig{
+			Items:       items,
+			Shipments:   shipments,
+			Processed:   repository.NewMemoryProcessedCommandRepository(),
+			ServiceName: "agg-shipment-cmd",
+			EventProd:   producers.EventProd(),
+			ResultProd:  producers.ResultProd(),
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		stateBuilder, err := domain.NewStateBuilder(&domain.StateBuilderConfig{
+			Items:       items,
+			Shipments:   shipments,
+			BuilderFunc: store.BuilderFunc,
+			TimeoutSec:  1,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		consumer, err = newCmdConsumer(cmdConsConfig{
+			stateBuilder:   stateBuilder,
+			handle:         handler.Handle,
+			workerCount:    2,
+			serviceName:    "agg-shipment-cmd",
+			respProd:       producers.ResultProd(),
+			deadLetterProd: producers.DeadLetterProd(),
+			maxAttempts:    1,
+			drainTimeout:   resultTimeout,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		claim = harness.NewClaim(testReqTopic)
+		var ctx context.Context
+		ctx, cancelSession = context.WithCancel(context.Background())
+		session = harness.NewSession(ctx)
+
+		consumeDone = make(chan struct{})
+		go func() {
+			defer close(consumeDone)
+			consumer.ConsumeClaim(session, claim)
+		}()
+	})
+
+	AfterEach(func() {
+		claim.Close()
+		Eventually(consumeDone, resultTimeout).Should(BeClosed())
+		Eventually(consumer.close(), resultTimeout).Should(BeClosed())
+		cancelSession()
+		producers.Close()
+	})
+
+	It("should produce ItemAdded Event and result for AddItem", func() {
+		item := newTestItem()
+		cmd := newTestCmd("AddItem", item)
+
+		doc := send(cmd, 1)
+		Expect(doc.Error).To(BeEmpty())
+		Expect(doc.Topic).To(Equal(testRespTopic))
+
+		events := producers.Events()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Action).To(Equal(model.EventItemAdded))
+		Expect(events[0].CorrelationID).To(Equal(cmd.UUID))
+
+		eventItem := &model.Item{}
+		err := json.Unmarshal(events[0].Data, eventItem)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(eventItem.ItemID).To(Equal(item.ItemID))
+		Expect(eventItem.Version).To(Equal(int64(1)))
+		Expect(store.Events()).To(HaveLen(1))
+	})
+
+	It("should handle Commands using state built from scripted and produced Events", func() {
+		shipmentID, err := uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+		shipment := &model.Shipment{
+			ShipmentID:      shipmentID.String(),
+			Carrier:         "test-carrier",
+			Destination:     "test-destination",
+			ExpectedArrival: time.Now().Unix(),
+			Origin:          "test-origin",
+			Status:          model.ShipmentPlanned,
+			Timestamp:       time.Now().Unix(),
+			TrackingNumber:  "test-tracking",
+			Version:         1,
+		}
+		marshalShipment, err := json.Marshal(shipment)
+		Expect(err).ToNot(HaveOccurred())
+		eventID, err := uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+		store.Append(&cmodel.Event{
+			AggregateID: model.AggregateID,
+			Action:      model.EventShipmentCreated,
+			Data:        marshalShipment,
+			NanoTime:    time.Now().UnixNano(),
+			Source:      "test-source",
+			UUID:        eventID,
+			Version:     1,
+		})
+
+		item := newTestItem()
+		doc := send(newTestCmd("AddItem", item), 1)
+		Expect(doc.Error).To(BeEmpty())
+
+		doc = send(newTestCmd("AddItemToShipment", map[string]interface{}{
+			"shipmentID": shipment.ShipmentID,
+			"itemID":     item.ItemID,
+		}), 1)
+		Expect(doc.Error).To(BeEmpty())
+
+		events := producers.Events()
+		Expect(events).To(HaveLen(2))
+		Expect(events[1].Action).To(Equal(model.EventItemAddedToShipment))
+
+		eventData := &model.ShipmentItemData{}
+		err = json.Unmarshal(events[1].Data, eventData)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(eventData.ShipmentID).To(Equal(shipment.ShipmentID))
+		Expect(eventData.ItemID).To(Equal(item.ItemID))
+		Expect(eventData.Version).To(Equal(int64(2)))
+	})
+
+	It("should respond with original result to redelivered Commands", func() {
+		cmd := newTestCmd("AddItem", newTestItem())
+
+		doc := send(cmd, 1)
+		Expect(doc.Error).To(BeEmpty())
+		redeliveredDoc := send(cmd, 2)
+		Expect(redeliveredDoc).To(Equal(doc))
+
+		Expect(producers.Events()).To(HaveLen(1))
+		Expect(session.Marked(testReqTopic, 0)).To(Equal(int64(2)))
+	})
+
+	It("should respond with all invalid fields to invalid AddItem", func() {
+		item := newTestItem()
+		item.Lot = ""
+		item.TotalWeight = -1
+		cmd := newTestCmd("AddItem", item)
+
+		doc := send(cmd, 1)
+		Expect(doc.ErrorCode).To(Equal(model.ValidationError))
+		fieldErrs := validation.Errors{}
+		err := json.Unmarshal([]byte(doc.Error), &fieldErrs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fieldErrs).To(HaveLen(2))
+		Expect(fieldErrs[0].Field).To(Equal("lot"))
+		Expect(fieldErrs[1].Field).To(Equal("totalWeight"))
+		Expect(producers.Events()).To(BeEmpty())
+	})
+
+	It("should add Item from GS1-128 Barcode", func() {
+		item := newTestItem()
+		item.UPC = ""
+		item.Lot = ""
+		item.DateArrived = 0
+		item.TotalWeight = 0
+		marshalItem, err := json.Marshal(item)
+		Expect(err).ToNot(HaveOccurred())
+		params := map[string]interface{}{}
+		err = json.Unmarshal(marshalItem, &params)
+		Expect(err).ToNot(HaveOccurred())
+		params["barcode"] = "]C1011003600029145910LOT-42\x1d131809153103001250"
+
+		doc := send(newTestCmd("AddItemFromBarcode", params), 1)
+		Expect(doc.Error).To(BeEmpty())
+
+		events := producers.Events()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Action).To(Equal(model.EventItemAdded))
+		eventItem := &model.Item{}
+		err = json.Unmarshal(events[0].Data, eventItem)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(eventItem.UPC).To(Equal("10036000291459"))
+		Expect(eventItem.Lot).To(Equal("LOT-42"))
+		Expect(eventItem.DateArrived).To(
+			Equal(time.Date(2018, 9, 15, 0, 0, 0, 0, time.UTC).Unix()),
+		)
+		Expect(eventItem.TotalWeight).To(Equal(1.25))
+	})
+
+	It("should respond with error to Commands with unregistered Action", func() {
+		cmd := newTestCmd("UnknownAction", newTestItem())
+
+		doc := send(cmd, 1)
+		Expect(doc.ErrorCode).To(Equal(model.UnknownActionError))
+		Expect(producers.Events()).To(BeEmpty())
+	})
+
+	It("should dead-letter messages which are not Commands", func() {
+		_, err := claim.Send([]byte("invalid-command"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(producers.DeadLetters, resultTimeout).Should(HaveLen(1))
+		deadLetter := producers.DeadLetters()[0]
+		Expect(deadLetter.Offset).To(Equal(int64(0)))
+		Expect(deadLetter.Payload).To(Equal([]byte("invalid-command")))
+		Eventually(func() int64 {
+			return session.Marked(testReqTopic, 0)
+		}, resultTimeout).Should(Equal(int64(1)))
+	})
+})
+
+var _ = Describe("Producer", func() {
+	var logs *bytes.Buffer
+
+	BeforeEach(func() {
+		logs = &bytes.Buffer{}
+		log.SetOutput(logs)
+	})
+
+	AfterEach(func() {
+		log.SetOutput(os.Stderr)
+	})
+
+	It("should configure retries and delivery-reports", func() {
+		saramaConfig := producerSaramaConfig(&producerConfig{
+			kafkaConfig:  &kafka.ProducerConfig{},
+			retryMax:     7,
+			retryBackoff: 100 * time.Millisecond,
+		})
+		Expect(saramaConfig.Producer.Retry.Max).To(Equal(7))
+		Expect(saramaConfig.Producer.Retry.Backoff).To(Equal(100 * time.Millisecond))
+		Expect(saramaConfig.Producer.Return.Successes).To(BeTrue())
+		Expect(saramaConfig.Producer.Return.Errors).To(BeTrue())
+		Expect(saramaConfig.Producer.RequiredAcks).To(Equal(sarama.WaitForAll))
+		Expect(saramaConfig.Version).To(Equal(sarama.V2_0_0_0))
+	})
+
+	It("should keep the provided sarama-config", func() {
+		providedConfig := sarama.NewConfig()
+		providedConfig.Producer.RequiredAcks = sarama.WaitForLocal
+		saramaConfig := producerSaramaConfig(&producerConfig{
+			kafkaConfig: &kafka.ProducerConfig{
+				SaramaConfig: providedConfig,
+			},
+		})
+		Expect(saramaConfig.Producer.RequiredAcks).To(Equal(sarama.WaitForLocal))
+		Expect(saramaConfig.Producer.Return.Successes).To(BeTrue())
+		Expect(providedConfig.Producer.Return.Successes).To(BeFalse())
+	})
+
+	It("should wait for all in-sync replicas when relaying OutboxEntries", func() {
+		providedConfig := sarama.NewConfig()
+		providedConfig.Producer.RequiredAcks = sarama.WaitForLocal
+		for _, kafkaConfig := range []*kafka.ProducerConfig{
+			{},
+			{SaramaConfig: providedConfig},
+		} {
+			saramaConfig := outboxSaramaConfig(kafkaConfig)
+			Expect(saramaConfig.Producer.RequiredAcks).To(Equal(sarama.WaitForAll))
+			Expect(saramaConfig.Producer.Return.Successes).To(BeTrue())
+			Expect(saramaConfig.Version).ToNot(BeZero())
+		}
+	})
+
+	It("should report deliveries and lost messages with their Command", func() {
+		saramaConfig := sarama.NewConfig()
+		saramaConfig.Producer.Return.Successes = true
+		prod := mocks.NewAsyncProducer(GinkgoT(), saramaConfig)
+		prod.ExpectInputAndSucceed()
+		prod.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+		g, ctx := errgroup.WithContext(context.Background())
+		inputChan := make(chan *producerInput, 2)
+		runProducer(&producerConfig{
+			ctx:    ctx,
+			g:      g,
+			closed: &sync.WaitGroup{},
+		}, prod, inputChan)
+
+		inputChan <- &producerInput{
+			data:    "test-event",
+			topic:   "test-topic",
+			cmdUUID: "test-cmd-1",
+			kind:    "Event",
+		}
+		inputChan <- &producerInput{
+			data:    "test-result",
+			topic:   "test-topic",
+			cmdUUID: "test-cmd-2",
+			kind:    "Result",
+		}
+		// Delivery-reports are read until producer is closed
+		close(inputChan)
+		Expect(g.Wait()).To(Succeed())
+
+		Expect(logs.String()).To(ContainSubstring(
+			"Delivered Event for Command with ID: test-cmd-1 to topic test-topic",
+		))
+		Expect(logs.String()).To(ContainSubstring(
+			"Lost Result for Command with ID: test-cmd-2 to topic test-topic (1 lost so far)",
+		))
+	})
+})
+
+// newTestConsumer creates a cmdConsumer with Aggregate-state built from store.
+// Unset fields in config are set to test-defaults.
+func newTestConsumer(
+	config cmdConsConfig,
+	store *harness.EventStore,
+	producers *harness.Producers,
+) *cmdConsumer {
+	stateBuilder, err := domain.NewStateBuilder(&domain.StateBuilderConfig{
+		Items:       repository.NewMemoryItemRepository(),
+		Shipments:   repository.NewMemoryShipmentRepository(),
+		BuilderFunc: store.BuilderFunc,
+		TimeoutSec:  1,
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	config.stateBuilder = stateBuilder
+	config.serviceName = "agg-shipment-cmd"
+	if config.workerCount == 0 {
+		config.workerCount = 2
+	}
+	if config.maxAttempts == 0 {
+		config.maxAttempts = 1
+	}
+	if config.drainTimeout == 0 {
+		config.drainTimeout = resultTimeout
+	}
+	if config.respProd == nil {
+		config.respProd = producers.ResultProd()
+	}
+	if config.deadLetterProd == nil {
+		config.deadLetterProd = producers.DeadLetterProd()
+	}
+
+	consumer, err := newCmdConsumer(config)
+	Expect(err).ToNot(HaveOccurred())
+	return consumer
+}
+
+// consume runs the consumer on claim, and the returned channel
+// is closed once the claim has ended.
+func consume(
+	consumer *cmdConsumer,
+	session *harness.Session,
+	claim *harness.Claim,
+) <-chan struct{} {
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		consumer.ConsumeClaim(session, claim)
+	}()
+	return consumed
+}
+
+// txnRecorder is a transactional producer which records the
+// consumer-offsets committed in transactions.
+type txnRecorder struct {
+	*mocks.AsyncProducer
+
+	lock      sync.Mutex
+	pending   []int64
+	committed []int64
+	aborted   int
+	// commitErr, if set, is returned when committing transactions.
+	commitErr error
+}
+
+func (r *txnRecorder) AddMessageToTxn(
+	msg *sarama.ConsumerMessage,
+	groupID string,
+	metadata *string,
+) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.pending = append(r.pending, msg.Offset)
+	return r.AsyncProducer.AddMessageToTxn(msg, groupID, metadata)
+}
+
+func (r *txnRecorder) CommitTxn() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.commitErr != nil {
+		return r.commitErr
+	}
+	r.committed = append(r.committed, r.pending...)
+	r.pending = nil
+	return r.AsyncProducer.CommitTxn()
+}
+
+func (r *txnRecorder) AbortTxn() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.aborted++
+	r.pending = nil
+	return r.AsyncProducer.AbortTxn()
+}
+
+func (r *txnRecorder) Committed() []int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]int64{}, r.committed...)
+}
+
+var _ = Describe("CmdWorkerPool", func() {
+	It("should process Commands with same shard-key in order they were dispatched", func() {
+		lock := sync.Mutex{}
+		processed := map[string][]int64{}
+		pool := newCmdWorkerPool(4, 8, func(job *cmdJob) {
+			lock.Lock()
+			defer lock.Unlock()
+			key := job.keys[0]
+			processed[key] = append(processed[key], job.msg.Offset)
+		})
+
+		items := []*model.Item{newTestItem(), newTestItem(), newTestItem()}
+		for offset := int64(0); offset < 30; offset++ {
+			item := items[offset%int64(len(items))]
+			cmd := newTestCmd("UpdateItem", item)
+			pool.dispatch(shardKeys(cmd), &cmdJob{
+				cmd:  cmd,
+				msg:  &sarama.ConsumerMessage{Offset: offset},
+				done: func() {},
+			})
+		}
+		Eventually(pool.stop(), resultTimeout).Should(BeClosed())
+
+		Expect(processed).To(HaveLen(len(items)))
+		for _, offsets := range processed {
+			Expect(offsets).To(HaveLen(10))
+			for i := 1; i < len(offsets); i++ {
+				Expect(offsets[i]).To(BeNumerically(">", offsets[i-1]))
+			}
+		}
+	})
+
+	It("should only start jobs once earlier jobs with any of same keys are processed", func() {
+		lock := sync.Mutex{}
+		running := map[string]bool{}
+		overlapped := false
+		processed := []int64{}
+		pool := newCmdWorkerPool(4, 8, func(job *cmdJob) {
+			lock.Lock()
+			for _, key := range job.keys {
+				if running[key] {
+					overlapped = true
+				}
+				running[key] = true
+			}
+			lock.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			lock.Lock()
+			for _, key := range job.keys {
+				running[key] = false
+			}
+			processed = append(processed, job.msg.Offset)
+			lock.Unlock()
+		})
+
+		shipmentKey := shipmentShardKeyPrefix + "shipment-1"
+		keys := [][]string{
+			{itemShardKeyPrefix + "item-1"},
+			{shipmentKey, itemShardKeyPrefix + "item-2"},
+			{shipmentKey, itemShardKeyPrefix + "item-3"},
+			{itemFilterShardKey},
+			{itemShardKeyPrefix + "item-3"},
+		}
+		for offset, jobKeys := range keys {
+			pool.dispatch(jobKeys, &cmdJob{
+				msg:  &sarama.ConsumerMessage{Offset: int64(offset)},
+				done: func() {},
+			})
+		}
+		Eventually(pool.stop(), resultTimeout).Should(BeClosed())
+
+		Expect(overlapped).To(BeFalse())
+		Expect(processed).To(HaveLen(len(keys)))
+		// Shipment-jobs are in order, the filter-job waits for all
+		// Item-jobs before it, and later Item-jobs wait for it
+		Expect(processed[3:]).To(Equal([]int64{3, 4}))
+		Expect(indexOf(processed, 1)).To(BeNumerically("<", indexOf(processed, 2)))
+	})
+})
+
+// indexOf returns the index of value in values, or -1 if not found.
+func indexOf(values []int64, value int64) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+var _ = Describe("ShardKeys", func() {
+	It("should key Commands with an ItemID on the Item", func() {
+		item := newTestItem()
+		itemKey := itemShardKeyPrefix + item.ItemID
+
+		Expect(shardKeys(newTestCmd("AddItem", item))).To(Equal([]string{itemKey}))
+		Expect(shardKeys(newTestCmd("DeleteItem", map[string]interface{}{
+			"itemID": item.ItemID,
+		}))).To(Equal([]string{itemKey}))
+		Expect(shardKeys(newTestCmd("UpdateItem", map[string]interface{}{
+			"filter": map[string]interface{}{"itemID": item.ItemID},
+		}))).To(Equal([]string{itemKey}))
+	})
+
+	It("should key Shipment-item Commands on both Shipment and Item", func() {
+		item := newTestItem()
+		shipmentID, err := uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+
+		for _, action := range []string{"AddItemToShipment", "RemoveItemFromShipment"} {
+			Expect(shardKeys(newTestCmd(action, map[string]interface{}{
+				"shipmentID": shipmentID.String(),
+				"itemID":     item.ItemID,
+			}))).To(Equal([]string{
+				shipmentShardKeyPrefix + shipmentID.String(),
+				itemShardKeyPrefix + item.ItemID,
+			}))
+		}
+	})
+
+	It("should key Item-filters without ItemID on all Items", func() {
+		Expect(shardKeys(newTestCmd("UpdateItem", map[string]interface{}{
+			"filter": map[string]interface{}{"lot": "test-lot"},
+		}))).To(Equal([]string{itemFilterShardKey}))
+		Expect(shardKeys(newTestCmd("DeleteItem", map[string]interface{}{
+			"lot": "test-lot",
+		}))).To(Equal([]string{itemFilterShardKey}))
+	})
+
+	It("should key other Shipment-Commands on the Shipment", func() {
+		shipmentID, err := uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(shardKeys(newTestCmd("DispatchShipment", map[string]interface{}{
+			"shipmentID": shipmentID.String(),
+		}))).To(Equal([]string{shipmentShardKeyPrefix + shipmentID.String()}))
+	})
+})
+
+var _ = Describe("OffsetTracker", func() {
+	It("should only mark an offset once all earlier messages have completed", func() {
+		session := harness.NewSession(context.Background())
+		tracker := newOffsetTracker(session)
+
+		tracked := []*trackedMsg{}
+		for offset := int64(0); offset < 3; offset++ {
+			tracked = append(tracked, tracker.track(&sarama.ConsumerMessage{
+				Topic:  testReqTopic,
+				Offset: offset,
+			}))
+		}
+
+		tracker.complete(tracked[2])
+		Expect(session.Marked(testReqTopic, 0)).To(Equal(int64(0)))
+		tracker.complete(tracked[0])
+		Expect(session.Marked(testReqTopic, 0)).To(Equal(int64(1)))
+		tracker.complete(tracked[1])
+		Expect(session.Marked(testReqTopic, 0)).To(Equal(int64(3)))
+	})
+})
+
+var _ = Describe("CmdConsumer Retries", func() {
+	var (
+		store     *harness.EventStore
+		producers *harness.Producers
+		claim     *harness.Claim
+		session   *harness.Session
+		attempts  int32
+	)
+
+	BeforeEach(func() {
+		store = harness.NewEventStore()
+		producers = harness.NewProducers(store)
+		claim = harness.NewClaim(testReqTopic)
+		session = harness.NewSession(context.Background())
+		atomic.StoreInt32(&attempts, 0)
+	})
+
+	AfterEach(func() {
+		producers.Close()
+	})
+
+	It("should dead-letter Commands which fail all attempts", func() {
+		consumer := newTestConsumer(cmdConsConfig{
+			handle: func(*cmodel.Command) error {
+				atomic.AddInt32(&attempts, 1)
+				return errors.New("test-error")
+			},
+			maxAttempts: 2,
+		}, store, producers)
+		consumed := consume(consumer, session, claim)
+
+		cmd := newTestCmd("AddItem", newTestItem())
+		_, err := claim.SendCommand(cmd)
+		Expect(err).ToNot(HaveOccurred())
+		doc, err := producers.Result(cmd.UUID, 1, resultTimeout)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(doc.ErrorCode).To(Equal(int16(cmodel.InternalError)))
+
+		Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(2)))
+		deadLetters := producers.DeadLetters()
+		Expect(deadLetters).To(HaveLen(1))
+		Expect(deadLetters[0].Attempts).To(Equal(2))
+		Expect(deadLetters[0].CommandUUID).To(Equal(cmd.UUID.String()))
+
+		claim.Close()
+		Eventually(consumed, resultTimeout).Should(BeClosed())
+		Eventually(consumer.close(), resultTimeout).Should(BeClosed())
+		Expect(session.Marked(testReqTopic, 0)).To(Equal(int64(1)))
+	})
+
+	It("should not dead-letter Commands which succeed on retry", func() {
+		consumer := newTestConsumer(cmdConsConfig{
+			handle: func(*cmodel.Command) error {
+				if atomic.AddInt32(&attempts, 1) == 1 {
+					return errors.New("test-error")
+				}
+				return nil
+			},
+			maxAttempts: 2,
+		}, store, producers)
+		consumed := consume(consumer, session, claim)
+
+		_, err := claim.SendCommand(newTestCmd("AddItem", newTestItem()))
+		Expect(err).ToNot(HaveOccurred())
+		claim.Close()
+		Eventually(consumed, resultTimeout).Should(BeClosed())
+		Eventually(consumer.close(), resultTimeout).Should(BeClosed())
+
+		Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(2)))
+		Expect(producers.DeadLetters()).To(BeEmpty())
+		Expect(session.Marked(testReqTopic, 0)).To(Equal(int64(1)))
+	})
+
+	It("should limit the retry-delay to maxRetryBackoff", func() {
+		consumer := newTestConsumer(cmdConsConfig{
+			handle: func(*cmodel.Command) error {
+				return nil
+			},
+			retryBackoff:    100 * time.Millisecond,
+			maxRetryBackoff: 250 * time.Millisecond,
+		}, store, producers)
+
+		Expect(consumer.retryDelay(1)).To(Equal(100 * time.Millisecond))
+		Expect(consumer.retryDelay(2)).To(Equal(200 * time.Millisecond))
+		Expect(consumer.retryDelay(3)).To(Equal(250 * time.Millisecond))
+		Eventually(consumer.close(), resultTimeout).Should(BeClosed())
+	})
+
+	It("should not allow maxRetryBackoff less than retryBackoff", func() {
+		stateBuilder, err := domain.NewStateBuilder(&domain.StateBuilderConfig{
+			Items:       repository.NewMemoryItemRepository(),
+			Shipments:   repository.NewMemoryShipmentRepository(),
+			BuilderFunc: store.BuilderFunc,
+			TimeoutSec:  1,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = newCmdConsumer(cmdConsConfig{
+			stateBuilder: stateBuilder,
+			handle: func(*cmodel.Command) error {
+				return nil
+			},
+			workerCount:     1,
+			serviceName:     "agg-shipment-cmd",
+			respProd:        producers.ResultProd(),
+			deadLetterProd:  producers.DeadLetterProd(),
+			maxAttempts:     1,
+			retryBackoff:    time.Second,
+			maxRetryBackoff: time.Millisecond,
+			drainTimeout:    resultTimeout,
+		})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Exactly-once", func() {
+	var (
+		recorder *txnRecorder
+		txnProd  *txnProducer
+	)
+
+	BeforeEach(func() {
+		recorder = &txnRecorder{
+			AsyncProducer: mocks.NewAsyncProducer(GinkgoT(), nil),
+		}
+		txnProd = &txnProducer{
+			txnProducerConfig: txnProducerConfig{
+				groupID:    "test-group",
+				eventTopic: "test-events",
+			},
+			prod: recorder,
+		}
+	})
+
+	AfterEach(func() {
+		Expect(recorder.Close()).To(Succeed())
+	})
+
+	It("should consume committed Commands from oldest offset for new consumer-groups", func() {
+		saramaConfig := txnConsumerSaramaConfig()
+		Expect(saramaConfig.Consumer.IsolationLevel).To(Equal(sarama.ReadCommitted))
+		Expect(saramaConfig.Consumer.Offsets.Initial).To(Equal(sarama.OffsetOldest))
+		Expect(saramaConfig.Consumer.MaxProcessingTime).To(Equal(10 * time.Second))
+		Expect(saramaConfig.Version).To(Equal(sarama.V2_0_0_0))
+	})
+
+	It("should publish Event and result, and commit offset, in a transaction", func() {
+		recorder.ExpectInputAndSucceed()
+		recorder.ExpectInputAndSucceed()
+
+		cmd := newTestCmd("AddItem", newTestItem())
+		err := txnProd.publish(&sarama.ConsumerMessage{Offset: 4}, &command.Result{
+			Event: &cmodel.Event{CorrelationID: cmd.UUID},
+			Document: &cmodel.Document{
+				CorrelationID: cmd.UUID,
+				Topic:         testRespTopic,
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorder.Committed()).To(Equal([]int64{4}))
+		Expect(recorder.aborted).To(Equal(0))
+	})
+
+	It("should abort transaction if it cannot be committed", func() {
+		recorder.ExpectInputAndSucceed()
+		recorder.commitErr = errors.New("test-error")
+
+		err := txnProd.publish(&sarama.ConsumerMessage{Offset: 4}, &command.Result{
+			Document: &cmodel.Document{Topic: testRespTopic},
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(recorder.Committed()).To(BeEmpty())
+		Expect(recorder.aborted).To(Equal(1))
+	})
+
+	It("should commit offsets of messages not handled in a transaction", func() {
+		store := harness.NewEventStore()
+		producers := harness.NewProducers(store)
+		defer producers.Close()
+
+		var handled int32
+		consumer := newTestConsumer(cmdConsConfig{
+			handleTxn: func(*cmodel.Command, *sarama.ConsumerMessage) error {
+				atomic.AddInt32(&handled, 1)
+				return nil
+			},
+			commitOffset: txnProd.commitOffset,
+		}, store, producers)
+		claim := harness.NewClaim(testReqTopic)
+		session := harness.NewSession(context.Background())
+		consumed := consume(consumer, session, claim)
+
+		_, err := claim.Send([]byte("invalid-command"))
+		Expect(err).ToNot(HaveOccurred())
+		expiredCmd := newTestCmd("AddItem", newTestItem())
+		expiredCmd.Timestamp = time.Now().Add(-time.Minute).Unix()
+		_, err = claim.SendCommand(expiredCmd)
+		Expect(err).ToNot(HaveOccurred())
+		missingActionCmd := newTestCmd("", newTestItem())
+		_, err = claim.SendCommand(missingActionCmd)
+		Expect(err).ToNot(HaveOccurred())
+
+		doc, err := producers.Result(expiredCmd.UUID, 1, resultTimeout)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(doc.ErrorCode).To(Equal(model.ExpiredError))
+		doc, err = producers.Result(missingActionCmd.UUID, 1, resultTimeout)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(doc.ErrorCode).To(Equal(model.MissingActionError))
+
+		claim.Close()
+		Eventually(consumed, resultTimeout).Should(BeClosed())
+		Eventually(consumer.close(), resultTimeout).Should(BeClosed())
+		Expect(recorder.Committed()).To(ConsistOf(int64(0), int64(1), int64(2)))
+		Expect(atomic.LoadInt32(&handled)).To(Equal(int32(0)))
+		// Offsets are only committed in transactions
+		Expect(session.Marked(testReqTopic, 0)).To(Equal(int64(0)))
+	})
+})
+
+var _ = Describe("Shutdown", func() {
+	var (
+		lock  sync.Mutex
+		steps []string
+
+		store     *harness.EventStore
+		producers *harness.Producers
+		claim     *harness.Claim
+		consumer  *cmdConsumer
+		consumed  <-chan struct{}
+		// handling is closed once the Command is being handled, which
+		// then waits for release to be closed.
+		handling chan struct{}
+		release  chan struct{}
+	)
+
+	step := func(name string) {
+		lock.Lock()
+		defer lock.Unlock()
+		steps = append(steps, name)
+	}
+
+	// newShutdownConfig creates a shutdownConfig whose producers record
+	// when they are flushed.
+	newShutdownConfig := func(timeout time.Duration) *shutdownConfig {
+		eventProd := make(chan *cmodel.Event)
+		respProd := make(chan *cmodel.Document)
+		deadLetterProd := make(chan *model.DeadLetter)
+		prodClosed := &sync.WaitGroup{}
+		prodClosed.Add(1)
+		go func() {
+			defer prodClosed.Done()
+			for range eventProd {
+			}
+			for range respProd {
+			}
+			for range deadLetterProd {
+			}
+			step("producers-flushed")
+		}()
+
+		return &shutdownConfig{
+			timeout: timeout,
+			stopConsuming: func() {
+				step("consumer-stopping")
+				claim.Close()
+			},
+			consumed: consumed,
+			cmdCons: closerFunc(func() error {
+				step("consumer-closed")
+				return nil
+			}),
+			cmdConsumer:    consumer,
+			eventProd:      eventProd,
+			respProd:       respProd,
+			deadLetterProd: deadLetterProd,
+			prodClosed:     prodClosed,
+		}
+	}
+
+	BeforeEach(func() {
+		steps = []string{}
+		handling = make(chan struct{})
+		release = make(chan struct{})
+
+		store = harness.NewEventStore()
+		producers = harness.NewProducers(store)
+		claim = harness.NewClaim(testReqTopic)
+		consumer = newTestConsumer(cmdConsConfig{
+			handle: func(*cmodel.Command) error {
+				close(handling)
+				<-release
+				step("command-handled")
+				return nil
+			},
+		}, store, producers)
+		consumed = consume(consumer, harness.NewSession(context.Background()), claim)
+
+		_, err := claim.SendCommand(newTestCmd("AddItem", newTestItem()))
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(handling, resultTimeout).Should(BeClosed())
+	})
+
+	AfterEach(func() {
+		producers.Close()
+	})
+
+	It("should flush producers only after in-flight Commands are handled", func() {
+		shutdownErr := make(chan error, 1)
+		go func() {
+			shutdownErr <- shutdown(newShutdownConfig(resultTimeout))
+		}()
+
+		Consistently(shutdownErr, 100*time.Millisecond).ShouldNot(Receive())
+		close(release)
+		Eventually(shutdownErr, resultTimeout).Should(Receive(BeNil()))
+
+		lock.Lock()
+		defer lock.Unlock()
+		Expect(steps).To(Equal([]string{
+			"consumer-stopping",
+			"command-handled",
+			"consumer-closed",
+			"producers-flushed",
+		}))
+	})
+
+	It("should limit each stage to its share of shutdown-timeout", func() {
+		defer close(release)
+
+		timeout := 400 * time.Millisecond
+		start := time.Now()
+		err := shutdown(newShutdownConfig(timeout))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("in-flight Commands"))
+
+		// Consumer and in-flight Commands only use their shares, so
+		// producers still have time to flush
+		elapsed := time.Since(start)
+		Expect(elapsed).To(BeNumerically(">=", time.Duration(float64(timeout)*(consumeShare+processShare))))
+		Expect(elapsed).To(BeNumerically("<", timeout))
+	})
+})
+
+// closerFunc is an io.Closer which calls the function.
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
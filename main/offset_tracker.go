@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// trackedMsg is a message whose processing is tracked by offsetTracker.
+type trackedMsg struct {
+	msg  *sarama.ConsumerMessage
+	done bool
+}
+
+// offsetTracker marks messages from a partition-claim only after they
+// have been processed. Since messages can complete out-of-order, a message
+// is only marked once all messages received before it have completed, so
+// the committed offset never skips over an unprocessed message.
+type offsetTracker struct {
+	lock    sync.Mutex
+	session sarama.ConsumerGroupSession
+	pending []*trackedMsg
+}
+
+func newOffsetTracker(session sarama.ConsumerGroupSession) *offsetTracker {
+	return &offsetTracker{
+		session: session,
+		pending: []*trackedMsg{},
+	}
+}
+
+// track adds the message to list of messages pending completion.
+func (t *offsetTracker) track(msg *sarama.ConsumerMessage) *trackedMsg {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	tm := &trackedMsg{
+		msg: msg,
+	}
+	t.pending = append(t.pending, tm)
+	return tm
+}
+
+// complete marks the message as processed, and marks the offsets
+// of all consecutive processed messages.
+func (t *offsetTracker) complete(tm *trackedMsg) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	tm.done = true
+	for len(t.pending) > 0 && t.pending[0].done {
+		t.session.MarkMessage(t.pending[0].msg, "")
+		t.pending = t.pending[1:]
+	}
+}
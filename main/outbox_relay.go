@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/go-kafkautils/kafka"
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/pkg/errors"
+)
+
+const (
+	// outboxBatchSize is the maximum number of entries published at once.
+	// This keeps the messages in-flight below the producer's channel-buffers.
+	outboxBatchSize = 100
+	// outboxAckTimeout is the duration to wait for a batch to be acknowledged.
+	outboxAckTimeout = 30 * time.Second
+	// outboxMinBackoff and outboxMaxBackoff bound the delay before retrying
+	// failed entries. The delay doubles with every failed attempt.
+	outboxMinBackoff = 1 * time.Second
+	outboxMaxBackoff = 1 * time.Minute
+)
+
+type outboxRelayConfig struct {
+	coll        *mongo.Collection
+	kafkaConfig *kafka.ProducerConfig
+	eventTopic  string
+	// pollInterval is the delay between checking outbox for unsent entries.
+	pollInterval time.Duration
+	// retention is the duration for which sent entries are kept.
+	retention time.Duration
+	// clock provides the time for scheduling and pruning entries,
+	// and defaults to model.SystemClock.
+	clock model.Clock
+}
+
+// outboxRelay publishes OutboxEntries to Kafka, and marks them as sent once
+// Kafka acknowledges them. Entries are retried with backoff until published,
+// so each Event and result is delivered at-least once.
+type outboxRelay struct {
+	outboxRelayConfig
+	prod *kafka.Producer
+}
+
+// outboxMsg identifies the OutboxEntry part a message was produced from.
+type outboxMsg struct {
+	commandUUID string
+	isEvent     bool
+}
+
+func newOutboxRelay(config outboxRelayConfig) (*outboxRelay, error) {
+	if config.coll == nil {
+		return nil, errors.New("coll cannot be nil")
+	}
+	if config.kafkaConfig == nil {
+		return nil, errors.New("kafkaConfig cannot be nil")
+	}
+	if config.eventTopic == "" {
+		return nil, errors.New("eventTopic cannot be blank")
+	}
+	if config.pollInterval <= 0 {
+		return nil, errors.New("pollInterval must be greater than 0")
+	}
+	if config.clock == nil {
+		config.clock = model.SystemClock{}
+	}
+
+	prod, err := kafka.NewProducer(&kafka.ProducerConfig{
+		KafkaBrokers: config.kafkaConfig.KafkaBrokers,
+		SaramaConfig: outboxSaramaConfig(config.kafkaConfig),
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error creating Outbox-Producer")
+		return nil, err
+	}
+
+	return &outboxRelay{
+		outboxRelayConfig: config,
+		prod:              prod,
+	}, nil
+}
+
+// outboxSaramaConfig is the sarama-config for the Outbox-Producer.
+// Acknowledgements are required to mark entries as sent, and entries are
+// only acknowledged once all in-sync replicas have them, so these are not
+// lost if the partition-leader fails.
+func outboxSaramaConfig(kafkaConfig *kafka.ProducerConfig) *sarama.Config {
+	saramaConfig := newProducerSaramaConfig(kafkaConfig.SaramaConfig)
+	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	saramaConfig.Producer.Return.Successes = true
+	saramaConfig.Producer.Return.Errors = true
+	return saramaConfig
+}
+
+// run publishes the unsent entries every pollInterval until ctx is done.
+// The entries still unsent are then published once more before the
+// producer is closed, so entries saved before shutdown are not delayed
+// until restart.
+func (r *outboxRelay) run(ctx context.Context) error {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			err := r.relay()
+			if err != nil {
+				err = errors.Wrap(err, "Error relaying OutboxEntries on close")
+				log.Println(err)
+			}
+			err = r.prod.Close()
+			if err != nil {
+				err = errors.Wrap(err, "Error closing Outbox-Producer")
+				log.Println(err)
+			}
+			return nil
+
+		case <-ticker.C:
+			err := r.relay()
+			if err != nil {
+				err = errors.Wrap(err, "Error relaying OutboxEntries")
+				log.Println(err)
+			}
+			err = r.prune()
+			if err != nil {
+				err = errors.Wrap(err, "Error pruning sent OutboxEntries")
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// relay publishes a batch of unsent entries which are due for an attempt.
+func (r *outboxRelay) relay() error {
+	entries, err := r.pending()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	entryMap := map[string]*model.OutboxEntry{}
+	failures := map[string]error{}
+	inFlight := 0
+	for _, entry := range entries {
+		entryMap[entry.CommandUUID] = entry
+		if !entry.EventSent {
+			msg := kafka.CreateMessage(r.eventTopic, entry.Event)
+			msg.Metadata = outboxMsg{entry.CommandUUID, true}
+			r.prod.Input() <- msg
+			inFlight++
+		}
+		if !entry.ResultSent {
+			msg := kafka.CreateMessage(entry.ResultTopic, entry.Result)
+			msg.Metadata = outboxMsg{entry.CommandUUID, false}
+			r.prod.Input() <- msg
+			inFlight++
+		}
+	}
+
+	timeout := time.After(outboxAckTimeout)
+ackLoop:
+	for inFlight > 0 {
+		select {
+		case msg := <-r.prod.Successes():
+			meta, isOutboxMsg := msg.Metadata.(outboxMsg)
+			if !isOutboxMsg {
+				continue
+			}
+			// Late acknowledgements from timed-out batches are not in-flight
+			entry, exists := entryMap[meta.commandUUID]
+			if !exists {
+				continue
+			}
+			inFlight--
+			if meta.isEvent {
+				entry.EventSent = true
+			} else {
+				entry.ResultSent = true
+			}
+
+		case prodErr := <-r.prod.Errors():
+			if prodErr == nil || prodErr.Msg == nil {
+				continue
+			}
+			meta, isOutboxMsg := prodErr.Msg.Metadata.(outboxMsg)
+			if !isOutboxMsg {
+				continue
+			}
+			if _, exists := entryMap[meta.commandUUID]; !exists {
+				continue
+			}
+			inFlight--
+			failures[meta.commandUUID] = prodErr.Err
+
+		case <-timeout:
+			log.Printf("Timed out waiting for %d OutboxEntry acknowledgements", inFlight)
+			break ackLoop
+		}
+	}
+
+	for _, entry := range entries {
+		err = r.update(entry, failures[entry.CommandUUID])
+		if err != nil {
+			err = errors.Wrapf(err, "Error updating OutboxEntry for Command with ID: %s", entry.CommandUUID)
+			log.Println(err)
+		}
+	}
+	return nil
+}
+
+// pending returns the unsent entries due for an attempt, oldest first.
+func (r *outboxRelay) pending() ([]*model.OutboxEntry, error) {
+	results, err := r.coll.Find(map[string]interface{}{
+		"sent": false,
+		"nextAttemptAt": map[string]interface{}{
+			"$lte": r.clock.Now().UTC().Unix(),
+		},
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error finding unsent OutboxEntries")
+		return nil, err
+	}
+
+	entries := []*model.OutboxEntry{}
+	for _, result := range results {
+		entry, assertOK := result.(*model.OutboxEntry)
+		if !assertOK {
+			return nil, errors.New("error asserting find-result to OutboxEntry")
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt < entries[j].CreatedAt
+	})
+	if len(entries) > outboxBatchSize {
+		entries = entries[:outboxBatchSize]
+	}
+	return entries, nil
+}
+
+// update records the result of publishing the entry. Entries with unsent
+// parts are scheduled for retry after backoff.
+func (r *outboxRelay) update(entry *model.OutboxEntry, failure error) error {
+	now := r.clock.Now().UTC()
+	update := map[string]interface{}{
+		"eventSent":  entry.EventSent,
+		"resultSent": entry.ResultSent,
+	}
+
+	if entry.EventSent && entry.ResultSent {
+		update["sent"] = true
+		update["sentAt"] = now.Unix()
+	} else {
+		if failure == nil {
+			failure = errors.New("publishing was not acknowledged")
+		}
+		attempts := entry.Attempts + 1
+		backoff := outboxMinBackoff << uint(attempts-1)
+		if backoff > outboxMaxBackoff || backoff <= 0 {
+			backoff = outboxMaxBackoff
+		}
+		update["attempts"] = attempts
+		update["nextAttemptAt"] = now.Add(backoff).Unix()
+		update["lastError"] = failure.Error()
+		log.Printf(
+			"Error publishing OutboxEntry for Command with ID: %s, attempt %d, retrying in %s: %s",
+			entry.CommandUUID, attempts, backoff, failure,
+		)
+	}
+
+	_, err := r.coll.UpdateMany(
+		map[string]interface{}{
+			"commandUUID": entry.CommandUUID,
+		},
+		update,
+	)
+	return err
+}
+
+// prune deletes the entries sent before retention.
+func (r *outboxRelay) prune() error {
+	if r.retention <= 0 {
+		return nil
+	}
+	_, err := r.coll.DeleteMany(map[string]interface{}{
+		"sent": true,
+		"sentAt": map[string]interface{}{
+			"$lt": r.clock.Now().UTC().Add(-r.retention).Unix(),
+		},
+	})
+	return err
+}
@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
-	"github.com/TerrexTech/go-common-models/model"
+	"github.com/Shopify/sarama"
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	cmodel "github.com/TerrexTech/go-common-models/model"
 	"github.com/TerrexTech/go-kafkautils/kafka"
 	"github.com/pkg/errors"
 )
@@ -16,15 +20,30 @@ import (
 type producerInput struct {
 	data  interface{}
 	topic string
+
+	// cmdUUID is the UUID of Command the message belongs to,
+	// and kind describes the message, for delivery-reports.
+	cmdUUID string
+	kind    string
 }
 
 type producerConfig struct {
 	ctx         context.Context
 	kafkaConfig *kafka.ProducerConfig
 	g           *errgroup.Group
+
+	// retryMax is the number of times delivering a message is retried on
+	// transient broker errors, with retryBackoff between retries.
+	retryMax     int
+	retryBackoff time.Duration
+
+	// closed tracks the producers which are not yet closed. Producers are
+	// closed, flushing their buffered messages, when their input-channel
+	// is closed.
+	closed *sync.WaitGroup
 }
 
-func eventProducer(config *producerConfig, topic string) (chan<- *model.Event, error) {
+func eventProducer(config *producerConfig, topic string) (chan<- *cmodel.Event, error) {
 	if config == nil {
 		return nil, errors.New("config cannot be nil")
 	}
@@ -32,7 +51,7 @@ func eventProducer(config *producerConfig, topic string) (chan<- *model.Event, e
 		return nil, errors.New("topic cannot be empty")
 	}
 
-	eventChan := make(chan *model.Event, 256)
+	eventChan := make(chan *cmodel.Event, 256)
 	prodChan := make(chan *producerInput, 256)
 
 	err := producer(config, (<-chan *producerInput)(prodChan))
@@ -43,22 +62,24 @@ func eventProducer(config *producerConfig, topic string) (chan<- *model.Event, e
 	go func() {
 		for event := range eventChan {
 			prodChan <- &producerInput{
-				data:  event,
-				topic: topic,
+				data:    event,
+				topic:   topic,
+				cmdUUID: event.CorrelationID.String(),
+				kind:    "Event",
 			}
 		}
 		close(prodChan)
 	}()
 
-	return (chan<- *model.Event)(eventChan), nil
+	return (chan<- *cmodel.Event)(eventChan), nil
 }
 
-func respProducer(config *producerConfig) (chan<- *model.Document, error) {
+func respProducer(config *producerConfig) (chan<- *cmodel.Document, error) {
 	if config == nil {
 		return nil, errors.New("config cannot be nil")
 	}
 
-	respChan := make(chan *model.Document, 256)
+	respChan := make(chan *cmodel.Document, 256)
 	prodChan := make(chan *producerInput, 256)
 
 	err := producer(config, (<-chan *producerInput)(prodChan))
@@ -73,25 +94,123 @@ func respProducer(config *producerConfig) (chan<- *model.Document, error) {
 				log.Println(err)
 			}
 			prodChan <- &producerInput{
-				data:  resp,
-				topic: resp.Topic,
+				data:    resp,
+				topic:   resp.Topic,
+				cmdUUID: resp.CorrelationID.String(),
+				kind:    "Result",
+			}
+		}
+		close(prodChan)
+	}()
+
+	return (chan<- *cmodel.Document)(respChan), nil
+}
+
+func deadLetterProducer(
+	config *producerConfig,
+	topic string,
+) (chan<- *model.DeadLetter, error) {
+	if config == nil {
+		return nil, errors.New("config cannot be nil")
+	}
+	if topic == "" {
+		return nil, errors.New("topic cannot be empty")
+	}
+
+	deadLetterChan := make(chan *model.DeadLetter, 256)
+	prodChan := make(chan *producerInput, 256)
+
+	err := producer(config, (<-chan *producerInput)(prodChan))
+	if err != nil {
+		err = errors.Wrap(err, "Error creating DeadLetterProducer")
+		return nil, err
+	}
+	go func() {
+		for deadLetter := range deadLetterChan {
+			prodChan <- &producerInput{
+				data:    deadLetter,
+				topic:   topic,
+				cmdUUID: deadLetter.CommandUUID,
+				kind:    "DeadLetter",
 			}
 		}
 		close(prodChan)
 	}()
 
-	return (chan<- *model.Document)(respChan), nil
+	return (chan<- *model.DeadLetter)(deadLetterChan), nil
 }
 
 func producer(config *producerConfig, inputChan <-chan *producerInput) error {
-	prod, err := kafka.NewProducer(config.kafkaConfig)
+	prod, err := kafka.NewProducer(&kafka.ProducerConfig{
+		KafkaBrokers: config.kafkaConfig.KafkaBrokers,
+		SaramaConfig: producerSaramaConfig(config),
+	})
 	if err != nil {
 		err = errors.Wrap(err, "Error creating Event-Producer")
 		log.Println(err)
 		return err
 	}
 
+	runProducer(config, prod, inputChan)
+	return nil
+}
+
+// newProducerSaramaConfig returns a copy of saramaConfig, or if it is nil,
+// the default sarama-config used by kafka.NewProducer. The defaults are set
+// here, since kafka.NewProducer only applies them if no config is provided.
+func newProducerSaramaConfig(saramaConfig *sarama.Config) *sarama.Config {
+	config := sarama.NewConfig()
+	if saramaConfig != nil {
+		*config = *saramaConfig
+		return config
+	}
+	config.Producer.Return.Errors = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Compression = sarama.CompressionNone
+	config.Version = sarama.V2_0_0_0
+	return config
+}
+
+// producerSaramaConfig is the sarama-config for producers, with
+// delivery-reports enabled and the configured retries.
+func producerSaramaConfig(config *producerConfig) *sarama.Config {
+	// Delivery-reports require successes to be returned
+	saramaConfig := newProducerSaramaConfig(config.kafkaConfig.SaramaConfig)
+	saramaConfig.Producer.Return.Successes = true
+	saramaConfig.Producer.Return.Errors = true
+	if config.retryMax > 0 {
+		saramaConfig.Producer.Retry.Max = config.retryMax
+	}
+	if config.retryBackoff > 0 {
+		saramaConfig.Producer.Retry.Backoff = config.retryBackoff
+	}
+	return saramaConfig
+}
+
+// runProducer produces the input to prod until inputChan is closed or ctx
+// is done, after which prod is closed once its buffered messages are
+// delivered.
+func runProducer(
+	config *producerConfig,
+	prod sarama.AsyncProducer,
+	inputChan <-chan *producerInput,
+) {
+	// Deliveries are reported separately, so sending input does not
+	// block on unread delivery-reports. Reports are read until the
+	// producer is closed, so none are lost on shutdown.
+	successes := prod.Successes()
+	prodErrors := prod.Errors()
+	reported := make(chan struct{})
+	config.g.Go(func() error {
+		defer close(reported)
+		reportDeliveries(successes, prodErrors)
+		return nil
+	})
+
+	config.closed.Add(1)
 	config.g.Go(func() error {
+		defer config.closed.Done()
+
 		var prodErr error
 	prodLoop:
 		for {
@@ -100,14 +219,10 @@ func producer(config *producerConfig, inputChan <-chan *producerInput) error {
 				prodErr = errors.New("Event-Producer: session closed")
 				break prodLoop
 
-			case err := <-prod.Errors():
-				if err != nil && err.Err != nil {
-					parsedErr := errors.Wrap(err.Err, "Error in ESQueryRequest-Producer")
-					log.Println(parsedErr)
-					log.Println(err)
+			case input, ok := <-inputChan:
+				if !ok {
+					break prodLoop
 				}
-
-			case input := <-inputChan:
 				marshalInput, err := json.Marshal(input.data)
 				if err != nil {
 					err = errors.Wrap(err, "Error Marshalling Input")
@@ -115,11 +230,74 @@ func producer(config *producerConfig, inputChan <-chan *producerInput) error {
 					continue
 				}
 				msg := kafka.CreateMessage(input.topic, marshalInput)
+				msg.Metadata = input
 				prod.Input() <- msg
 			}
 		}
+
+		// Buffered messages are delivered before the delivery-report
+		// channels are closed, so this waits for buffered messages
+		prod.AsyncClose()
+		<-reported
 		return prodErr
 	})
+}
 
-	return nil
+// reportDeliveries logs the delivery-reports of messages, along with the
+// Command they belong to. Messages which failed delivery after all retries
+// are permanently lost, and are logged with the count of lost messages.
+// This returns once both channels are closed, which is when the
+// producer is closed.
+func reportDeliveries(
+	successes <-chan *sarama.ProducerMessage,
+	prodErrors <-chan *sarama.ProducerError,
+) {
+	var lostCount int64
+	for successes != nil || prodErrors != nil {
+		select {
+		case msg, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			if msg == nil {
+				continue
+			}
+			input, isInput := msg.Metadata.(*producerInput)
+			if !isInput {
+				continue
+			}
+			log.Printf(
+				"Delivered %s for Command with ID: %s to topic %s, partition %d, offset %d",
+				input.kind, input.cmdUUID, msg.Topic, msg.Partition, msg.Offset,
+			)
+
+		case err, ok := <-prodErrors:
+			if !ok {
+				prodErrors = nil
+				continue
+			}
+			if err == nil || err.Err == nil {
+				continue
+			}
+			lostCount++
+			parsedErr := errors.Wrap(err.Err, "Error delivering message")
+			if err.Msg == nil {
+				log.Printf("Lost message (%d lost so far): %s", lostCount, parsedErr)
+				continue
+			}
+			input, isInput := err.Msg.Metadata.(*producerInput)
+			if !isInput {
+				log.Printf(
+					"Lost message to topic %s (%d lost so far): %s",
+					err.Msg.Topic, lostCount, parsedErr,
+				)
+				continue
+			}
+			log.Printf(
+				"Lost %s for Command with ID: %s to topic %s (%d lost so far): %s",
+				input.kind, input.cmdUUID, input.topic, lostCount, parsedErr,
+			)
+		}
+	}
 }
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/pkg/errors"
+)
+
+// consumeShare is the share of shutdown-timeout for stopping the consumer,
+// including the Commands in-flight in its claims. processShare is for the
+// remaining queued Commands and the Outbox-Relay. Producers are flushed in
+// the rest. Stages finishing early leave their time to later stages, but a
+// slow stage cannot use the time of stages after it.
+const (
+	consumeShare = 0.5
+	processShare = 0.25
+)
+
+// shutdownConfig holds the components stopped on shutdown.
+// Optional components are nil if they are not used.
+type shutdownConfig struct {
+	// timeout is the maximum duration for the whole shutdown.
+	timeout time.Duration
+
+	// stopConsuming cancels the context Commands are consumed with,
+	// and consumed is closed once consuming has stopped.
+	stopConsuming context.CancelFunc
+	consumed      <-chan struct{}
+	cmdCons       io.Closer
+	cmdConsumer   *cmdConsumer
+
+	// stopRelay stops the Outbox-Relay, and relayed is closed once
+	// it has stopped. Optional.
+	stopRelay context.CancelFunc
+	relayed   <-chan struct{}
+	// txnProd is the producer used in exactly-once mode. Optional.
+	txnProd *txnProducer
+
+	eventProd      chan<- *cmodel.Event
+	respProd       chan<- *cmodel.Document
+	deadLetterProd chan<- *model.DeadLetter
+	// prodClosed tracks the producers which are not yet closed.
+	prodClosed *sync.WaitGroup
+
+	// storage is the Aggregate-state storage, such as Bolt-database,
+	// closed once Commands are no longer processed. Optional.
+	storage     io.Closer
+	mongoClient *mongo.Client
+}
+
+// shutdown stops consuming new Commands, waits for in-flight Commands to be
+// processed, flushes the producers and closes the storage and Mongo-connection.
+// An error is returned if these steps did not complete within the timeout,
+// in which case the unfinished Commands are redelivered after restart.
+func shutdown(config *shutdownConfig) error {
+	err := drain(config, time.Now())
+
+	if config.storage != nil {
+		log.Println("Closing Aggregate-state storage")
+		storageErr := config.storage.Close()
+		if storageErr != nil {
+			storageErr = errors.Wrap(storageErr, "Error closing Aggregate-state storage")
+			log.Println(storageErr)
+		}
+	}
+	if config.mongoClient != nil {
+		log.Println("Closing Mongo-connection")
+		mongoErr := config.mongoClient.Disconnect()
+		if mongoErr != nil {
+			mongoErr = errors.Wrap(mongoErr, "Error closing Mongo-connection")
+			log.Println(mongoErr)
+		}
+	}
+	return err
+}
+
+// consumeTimeout is the time for stopping the consumer on shutdown.
+func (config *shutdownConfig) consumeTimeout() time.Duration {
+	return time.Duration(float64(config.timeout) * consumeShare)
+}
+
+// drain stops the components in order, so each one finishes using the
+// components after it before those are stopped. Each stage must finish
+// by its share of the timeout from start.
+func drain(config *shutdownConfig, start time.Time) error {
+	consumeDeadline := start.Add(config.consumeTimeout())
+	processDeadline := consumeDeadline.Add(
+		time.Duration(float64(config.timeout) * processShare),
+	)
+	deadline := start.Add(config.timeout)
+
+	log.Println("Stopping Command-Consumer")
+	// Claims stop waiting for their in-flight Commands by consumeDeadline,
+	// and the rest are then waited for along with the queued Commands
+	config.cmdConsumer.drainBy(consumeDeadline)
+	config.stopConsuming()
+	if !waitUntil(config.consumed, processDeadline) {
+		return errors.New("Timed out waiting for Command-Consumer to stop")
+	}
+	err := config.cmdCons.Close()
+	if err != nil {
+		err = errors.Wrap(err, "Error closing Command-Consumer")
+		log.Println(err)
+	}
+
+	log.Println("Waiting for in-flight Commands to be processed")
+	if !waitUntil(config.cmdConsumer.close(), processDeadline) {
+		return errors.New("Timed out waiting for in-flight Commands to be processed")
+	}
+
+	if config.stopRelay != nil {
+		log.Println("Stopping Outbox-Relay")
+		config.stopRelay()
+		if !waitUntil(config.relayed, processDeadline) {
+			return errors.New("Timed out waiting for Outbox-Relay to stop")
+		}
+	}
+	if config.txnProd != nil {
+		log.Println("Closing Transactional-Producer")
+		err := config.txnProd.close()
+		if err != nil {
+			err = errors.Wrap(err, "Error closing Transactional-Producer")
+			log.Println(err)
+		}
+	}
+
+	// No more messages are produced once Commands are processed
+	log.Println("Flushing Producers")
+	close(config.eventProd)
+	close(config.respProd)
+	close(config.deadLetterProd)
+	if !waitTimeout(config.prodClosed, time.Until(deadline)) {
+		return errors.New("Timed out waiting for Producers to flush")
+	}
+	return nil
+}
+
+// waitUntil waits for done to be closed, and returns false
+// if it was not closed before deadline.
+func waitUntil(done <-chan struct{}, deadline time.Time) bool {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// waitTimeout waits for wg, and returns false if it
+// was not done within timeout.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return waitUntil(done, time.Now().Add(timeout))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/TerrexTech/agg-shipment-cmd/connutil"
+	"github.com/TerrexTech/agg-shipment-cmd/domain"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	"github.com/TerrexTech/go-agg-builder/builder"
+	"github.com/pkg/errors"
+)
+
+// newSnapshotter creates a Snapshotter for the StateBuilder,
+// using params set in env.
+func newSnapshotter(
+	mc *builder.MongoConfig,
+	stateBuilder *domain.StateBuilder,
+) (*domain.Snapshotter, error) {
+	snapshotColl, err := connutil.LoadSnapshotCollection(mc)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing Snapshot-Collection")
+		return nil, err
+	}
+	chunkColl, err := connutil.LoadSnapshotChunkCollection(mc)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing SnapshotChunk-Collection")
+		return nil, err
+	}
+
+	intervalStr := os.Getenv("SNAPSHOT_INTERVAL_SEC")
+	interval, err := strconv.Atoi(intervalStr)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting SNAPSHOT_INTERVAL_SEC to integer")
+		log.Println(err)
+		log.Println("A default value of 0 will be used for SNAPSHOT_INTERVAL_SEC")
+		interval = 0
+	}
+
+	return domain.NewSnapshotter(&domain.SnapshotterConfig{
+		StateBuilder: stateBuilder,
+		SnapshotColl: snapshotColl,
+		ChunkColl:    chunkColl,
+		Interval:     time.Duration(interval) * time.Second,
+	})
+}
+
+// forceSnapshot builds the latest Aggregate-state and takes its Snapshot.
+func forceSnapshot(
+	stateBuilder *domain.StateBuilder,
+	snapshotter *domain.Snapshotter,
+) error {
+	_, err := stateBuilder.Build()
+	if err != nil {
+		err = errors.Wrap(err, "Error building Aggregate-state")
+		return err
+	}
+	snapshot, err := snapshotter.Take()
+	if err != nil {
+		err = errors.Wrap(err, "Error taking Snapshot")
+		return err
+	}
+	log.Printf(
+		"Took Snapshot with ID: %s, Checksum: %s",
+		snapshot.SnapshotID, snapshot.Checksum,
+	)
+	return nil
+}
+
+// verifySnapshot verifies the latest Snapshot against a replay of Events.
+func verifySnapshot(
+	mc *builder.MongoConfig,
+	snapshotter *domain.Snapshotter,
+	builderFunc domain.BuilderFunc,
+) error {
+	snapshot, err := snapshotter.Latest()
+	if err != nil {
+		err = errors.Wrap(err, "Error loading latest Snapshot")
+		return err
+	}
+	if snapshot == nil {
+		return errors.New("no Snapshot found")
+	}
+
+	verifyColl, verifyShipmentColl, err := connutil.LoadVerifyCollections(mc)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing verify-Collections")
+		return err
+	}
+	verifyItems, err := repository.NewMongoItemRepository(verifyColl)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing verify-Item-Repository")
+		return err
+	}
+	verifyShipments, err := repository.NewMongoShipmentRepository(verifyShipmentColl)
+	if err != nil {
+		err = errors.Wrap(err, "Error initializing verify-Shipment-Repository")
+		return err
+	}
+	isValid, err := snapshotter.Verify(snapshot, verifyItems, verifyShipments, builderFunc)
+	if err != nil {
+		err = errors.Wrap(err, "Error verifying Snapshot")
+		return err
+	}
+	if !isValid {
+		return errors.Errorf("Snapshot with ID: %s does not match replay", snapshot.SnapshotID)
+	}
+	log.Printf("Snapshot with ID: %s matches replay", snapshot.SnapshotID)
+	return nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/TerrexTech/agg-shipment-cmd/command"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/TerrexTech/go-kafkautils/kafka"
+	"github.com/pkg/errors"
+)
+
+type txnProducerConfig struct {
+	kafkaBrokers []string
+	// transactionalID must be unique for each service-instance, and
+	// stable across its restarts, so Kafka can fence off zombie instances.
+	transactionalID string
+	// groupID is the consumer-group whose offsets are committed in transactions.
+	groupID    string
+	eventTopic string
+}
+
+// txnProducer publishes a Command's Event and result, and commits the
+// Command's consumer-offset, in a single Kafka-transaction. Consumers must
+// use the read_committed isolation-level to only see committed messages.
+// Transactions are serialized, since a producer can only have a single
+// open transaction.
+type txnProducer struct {
+	txnProducerConfig
+
+	lock sync.Mutex
+	prod sarama.AsyncProducer
+}
+
+// txnConsumerSaramaConfig is the sarama-config for consuming Commands in
+// exactly-once mode, which only reads Commands from committed transactions.
+// The other settings are the defaults used by kafka.NewConsumer, which are
+// only applied if no config is provided.
+func txnConsumerSaramaConfig() *sarama.Config {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+	saramaConfig.Consumer.MaxProcessingTime = 10 * time.Second
+	saramaConfig.Consumer.Return.Errors = true
+	saramaConfig.Consumer.IsolationLevel = sarama.ReadCommitted
+	saramaConfig.Version = sarama.V2_0_0_0
+	return saramaConfig
+}
+
+func newTxnProducer(config txnProducerConfig) (*txnProducer, error) {
+	if len(config.kafkaBrokers) == 0 {
+		return nil, errors.New("kafkaBrokers cannot be empty")
+	}
+	if config.transactionalID == "" {
+		return nil, errors.New("transactionalID cannot be blank")
+	}
+	if config.groupID == "" {
+		return nil, errors.New("groupID cannot be blank")
+	}
+	if config.eventTopic == "" {
+		return nil, errors.New("eventTopic cannot be blank")
+	}
+
+	saramaConfig := sarama.NewConfig()
+	// Transactions require Kafka 0.11+
+	saramaConfig.Version = sarama.V2_0_0_0
+	saramaConfig.Net.MaxOpenRequests = 1
+	saramaConfig.Producer.Idempotent = true
+	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	saramaConfig.Producer.Transaction.ID = config.transactionalID
+	saramaConfig.Producer.Return.Errors = true
+
+	prod, err := sarama.NewAsyncProducer(config.kafkaBrokers, saramaConfig)
+	if err != nil {
+		err = errors.Wrap(err, "Error creating Transactional-Producer")
+		return nil, err
+	}
+	// Errors are returned by CommitTxn, so these are only logged
+	go func() {
+		for prodErr := range prod.Errors() {
+			if prodErr != nil && prodErr.Err != nil {
+				err := errors.Wrap(prodErr.Err, "Error in Transactional-Producer")
+				log.Println(err)
+			}
+		}
+	}()
+
+	return &txnProducer{
+		txnProducerConfig: config,
+		prod:              prod,
+	}, nil
+}
+
+// publish produces the Event and result-Document, and commits the offset of
+// msg, in a single transaction. The transaction is aborted on error, so
+// none of these take effect.
+func (p *txnProducer) publish(
+	msg *sarama.ConsumerMessage,
+	result *command.Result,
+) error {
+	var marshalEvent []byte
+	if result.Event != nil {
+		var err error
+		marshalEvent, err = json.Marshal(result.Event)
+		if err != nil {
+			err = errors.Wrap(err, "Error marshalling Event")
+			return err
+		}
+	}
+	marshalDoc, err := json.Marshal(result.Document)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling result-Document")
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	err = p.prod.BeginTxn()
+	if err != nil {
+		err = errors.Wrap(err, "Error beginning transaction")
+		return err
+	}
+
+	if marshalEvent != nil {
+		p.prod.Input() <- kafka.CreateMessage(p.eventTopic, marshalEvent)
+	}
+	p.prod.Input() <- kafka.CreateMessage(result.Document.Topic, marshalDoc)
+
+	err = p.prod.AddMessageToTxn(msg, p.groupID, nil)
+	if err != nil {
+		err = errors.Wrap(err, "Error adding consumer-offset to transaction")
+		return p.abort(err)
+	}
+	err = p.prod.CommitTxn()
+	if err != nil {
+		err = errors.Wrap(err, "Error committing transaction")
+		return p.abort(err)
+	}
+	return nil
+}
+
+// commitOffset commits the offset of msg in a transaction without any
+// messages, for messages which produce no Event or result in a transaction.
+func (p *txnProducer) commitOffset(msg *sarama.ConsumerMessage) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	err := p.prod.BeginTxn()
+	if err != nil {
+		err = errors.Wrap(err, "Error beginning transaction")
+		return err
+	}
+	err = p.prod.AddMessageToTxn(msg, p.groupID, nil)
+	if err != nil {
+		err = errors.Wrap(err, "Error adding consumer-offset to transaction")
+		return p.abort(err)
+	}
+	err = p.prod.CommitTxn()
+	if err != nil {
+		err = errors.Wrap(err, "Error committing transaction")
+		return p.abort(err)
+	}
+	return nil
+}
+
+// abort aborts the current transaction, and returns the error that caused it.
+func (p *txnProducer) abort(err error) error {
+	if p.prod.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0 {
+		// Producer cannot recover, so the service must be restarted
+		log.Fatalln(errors.Wrap(err, "Fatal error in Transactional-Producer"))
+	}
+
+	abortErr := p.prod.AbortTxn()
+	if abortErr != nil {
+		abortErr = errors.Wrap(abortErr, "Error aborting transaction")
+		log.Println(abortErr)
+	}
+	return err
+}
+
+// close waits for the current transaction to complete, and closes the producer.
+func (p *txnProducer) close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.prod.Close()
+}
+
+// txnHandler handles Commands, publishing their results using txnProducer.
+func txnHandler(
+	cmdHandler *command.Handler,
+	txnProd *txnProducer,
+) func(*cmodel.Command, *sarama.ConsumerMessage) error {
+	return func(cmd *cmodel.Command, msg *sarama.ConsumerMessage) error {
+		result, err := cmdHandler.Process(cmd)
+		if err != nil {
+			return err
+		}
+		if result.Redelivered {
+			// Only the result is sent again, along with the offset-commit
+			result.Event = nil
+		}
+
+		err = txnProd.publish(msg, result)
+		if err != nil {
+			return err
+		}
+		if !result.Redelivered {
+			cmdHandler.MarkProcessed(cmd, result)
+		}
+		return nil
+	}
+}
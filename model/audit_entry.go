@@ -0,0 +1,33 @@
+package model
+
+// AuditEntry records a change made to an Item or Shipment by a Command,
+// along with the user who issued the Command. Entries are append-only,
+// and are never updated or deleted.
+type AuditEntry struct {
+	AuditID string `bson:"auditID,omitempty" json:"auditID,omitempty"`
+	// Action is the action of Event which made the change.
+	Action string `bson:"action,omitempty" json:"action,omitempty"`
+	// CommandAction is the action of Command which produced the Event.
+	CommandAction string `bson:"commandAction,omitempty" json:"commandAction,omitempty"`
+	// CorrelationID is the UUID of Command which produced the Event.
+	CorrelationID string `bson:"correlationID,omitempty" json:"correlationID,omitempty"`
+	EventUUID     string `bson:"eventUUID,omitempty" json:"eventUUID,omitempty"`
+	// ItemID is set if an Item was changed, and ShipmentID is set if the
+	// change was made to a Shipment, or to an Item in that Shipment.
+	ItemID     string `bson:"itemID,omitempty" json:"itemID,omitempty"`
+	ShipmentID string `bson:"shipmentID,omitempty" json:"shipmentID,omitempty"`
+	// UserUUID is the user who issued the Command,
+	// and is empty if the Command had no user.
+	UserUUID string        `bson:"userUUID,omitempty" json:"userUUID,omitempty"`
+	Changes  []AuditChange `bson:"changes,omitempty" json:"changes,omitempty"`
+	// Timestamp is the Unix-time in nanoseconds when the change was made.
+	Timestamp int64 `bson:"timestamp,omitempty" json:"timestamp,omitempty"`
+}
+
+// AuditChange is a field changed in an Item or Shipment. Before is nil if
+// the field was added, and After is nil if the field was removed.
+type AuditChange struct {
+	Field  string      `bson:"field,omitempty" json:"field,omitempty"`
+	Before interface{} `bson:"before,omitempty" json:"before,omitempty"`
+	After  interface{} `bson:"after,omitempty" json:"after,omitempty"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"github.com/TerrexTech/uuuid"
+)
+
+// Clock provides the current time. This allows tests to control time,
+// such as for Command-expiry, instead of waiting for it to pass.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock which returns the system-time.
+type SystemClock struct{}
+
+// Now returns the current system-time.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// IDGenerator generates the UUIDs for Events, Documents and other records.
+// This allows tests to expect specific UUIDs.
+type IDGenerator interface {
+	NewID() (uuuid.UUID, error)
+}
+
+// RandomIDGenerator is the IDGenerator which generates random (version 4) UUIDs.
+type RandomIDGenerator struct{}
+
+// NewID generates a new random UUID.
+func (RandomIDGenerator) NewID() (uuuid.UUID, error) {
+	return uuuid.NewV4()
+}
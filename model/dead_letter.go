@@ -0,0 +1,19 @@
+package model
+
+// DeadLetter is a Command-message which could not be processed, and is
+// published to the dead-letter topic for inspection. It contains the
+// original message, the error, and the Kafka-metadata of the message.
+type DeadLetter struct {
+	// CommandUUID is blank if the message could not be decoded into Command.
+	CommandUUID string `bson:"commandUUID,omitempty" json:"commandUUID,omitempty"`
+	Attempts    int    `bson:"attempts,omitempty" json:"attempts,omitempty"`
+	Error       string `bson:"error,omitempty" json:"error,omitempty"`
+	FailedAt    int64  `bson:"failedAt,omitempty" json:"failedAt,omitempty"`
+
+	Key       []byte `bson:"key,omitempty" json:"key,omitempty"`
+	Offset    int64  `bson:"offset" json:"offset"`
+	Partition int32  `bson:"partition" json:"partition"`
+	Payload   []byte `bson:"payload,omitempty" json:"payload,omitempty"`
+	Timestamp int64  `bson:"timestamp,omitempty" json:"timestamp,omitempty"`
+	Topic     string `bson:"topic,omitempty" json:"topic,omitempty"`
+}
@@ -0,0 +1,31 @@
+package model
+
+// Error-codes used in command-responses, in addition to the ones
+// provided by go-common-models.
+const (
+	// ConflictError indicates that the version expected by a command did
+	// not match the current version of the entity it targets.
+	ConflictError int16 = 10
+	// UnknownActionError indicates that no handler is registered for
+	// the command's Action.
+	UnknownActionError int16 = 11
+	// UnauthorizedError indicates that the command was rejected
+	// by authorization.
+	UnauthorizedError int16 = 12
+	// TimeoutError indicates that the command could not be processed
+	// within the allowed duration.
+	TimeoutError int16 = 13
+	// ExpiredError indicates that the command's TTL expired before
+	// it could be processed.
+	ExpiredError int16 = 14
+	// MissingActionError indicates that the command did not specify
+	// an Action.
+	MissingActionError int16 = 15
+	// StateUnavailableError indicates that the Aggregate-state could not be
+	// built, so the command could not be processed.
+	StateUnavailableError int16 = 16
+	// ValidationError indicates that the command contained invalid fields.
+	// The error-message is the JSON-encoded list of validation.FieldErrors,
+	// so all invalid fields are reported at once.
+	ValidationError int16 = 17
+)
@@ -0,0 +1,90 @@
+package model
+
+import (
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+// Event-actions for Events produced by Shipment aggregate.
+const (
+	EventItemAdded               = "ItemAdded"
+	EventItemUpdated             = "ItemUpdated"
+	EventItemDeleted             = "ItemDeleted"
+	EventShipmentCreated         = "ShipmentCreated"
+	EventItemAddedToShipment     = "ItemAddedToShipment"
+	EventItemRemovedFromShipment = "ItemRemovedFromShipment"
+	EventShipmentDispatched      = "ShipmentDispatched"
+	EventShipmentArrived         = "ShipmentArrived"
+	EventShipmentInspected       = "ShipmentInspected"
+	EventShipmentReceived        = "ShipmentReceived"
+	EventShipmentClosed          = "ShipmentClosed"
+	EventShipmentRejected        = "ShipmentRejected"
+	EventShipmentCancelled       = "ShipmentCancelled"
+)
+
+// Event-data for the Events. The ItemAdded and ItemDeleted Events use Item,
+// and the ShipmentCreated Event uses Shipment as their data.
+
+// ItemUpdatedData is the data for ItemUpdated Event.
+type ItemUpdatedData struct {
+	Filter map[string]interface{} `json:"filter"`
+	Update map[string]interface{} `json:"update"`
+}
+
+// ShipmentItemData is the data for ItemAddedToShipment
+// and ItemRemovedFromShipment Events.
+type ShipmentItemData struct {
+	ShipmentID string `json:"shipmentID"`
+	ItemID     string `json:"itemID"`
+	// Version is the version of Shipment after the Event.
+	Version int64 `json:"version,omitempty"`
+	// ItemVersion is the version of Item after the Event. This is 0 for
+	// Events produced before Item-versions were changed by these Events.
+	ItemVersion int64 `json:"itemVersion,omitempty"`
+}
+
+// ShipmentStatusData is the data for Shipment-status Events.
+type ShipmentStatusData struct {
+	ShipmentID    string `json:"shipmentID"`
+	ActualArrival int64  `json:"actualArrival,omitempty"`
+	Status        string `json:"status"`
+	// Version is the version of Shipment after the Event.
+	Version int64 `json:"version,omitempty"`
+}
+
+// EventUpcaster converts a historical Event into its current form.
+type EventUpcaster struct {
+	// Action is the current Event-action for the historical Event.
+	Action string
+	// Upcast converts the historical Event-data into current Event-data.
+	// The data is used as-is if this is nil.
+	Upcast func(data []byte) ([]byte, error)
+}
+
+// eventUpcasters maps historical Event-actions to their upcasters.
+var eventUpcasters = map[string]EventUpcaster{
+	// Events produced by AddItem before it used ItemAdded action
+	"ItemRegistered": EventUpcaster{
+		Action: EventItemAdded,
+	},
+}
+
+// UpcastEvent converts the Event into its current form
+// if it is a historical Event.
+func UpcastEvent(event *cmodel.Event) error {
+	upcaster, isHistorical := eventUpcasters[event.Action]
+	if !isHistorical {
+		return nil
+	}
+
+	if upcaster.Upcast != nil {
+		data, err := upcaster.Upcast(event.Data)
+		if err != nil {
+			err = errors.Wrapf(err, "Error upcasting %s Event", event.Action)
+			return err
+		}
+		event.Data = data
+	}
+	event.Action = upcaster.Action
+	return nil
+}
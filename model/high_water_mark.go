@@ -0,0 +1,18 @@
+package model
+
+// HighWaterMark is the latest Event applied on Aggregate-state, along with
+// the Events applied within the late-window before it. Events which are in
+// RecentEvents, or older than the late-window, have already been applied and
+// are skipped when building Aggregate-state incrementally.
+type HighWaterMark struct {
+	AggregateID  int8           `bson:"aggregateID,omitempty" json:"aggregateID,omitempty"`
+	EventUUID    string         `bson:"eventUUID,omitempty" json:"eventUUID,omitempty"`
+	NanoTime     int64          `bson:"nanoTime,omitempty" json:"nanoTime,omitempty"`
+	RecentEvents []AppliedEvent `bson:"recentEvents,omitempty" json:"recentEvents,omitempty"`
+}
+
+// AppliedEvent identifies an Event applied on Aggregate-state.
+type AppliedEvent struct {
+	EventUUID string `bson:"eventUUID,omitempty" json:"eventUUID,omitempty"`
+	NanoTime  int64  `bson:"nanoTime,omitempty" json:"nanoTime,omitempty"`
+}
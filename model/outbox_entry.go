@@ -0,0 +1,26 @@
+package model
+
+// OutboxEntry is the Event and result-Document produced by a Command, stored
+// together so they are written atomically. The entries are published to
+// Kafka by outbox-relay, which marks each part as sent once published.
+type OutboxEntry struct {
+	CommandUUID string `bson:"commandUUID,omitempty" json:"commandUUID,omitempty"`
+	// CreatedAt is the time in nanoseconds when entry was created,
+	// used to publish entries in order.
+	CreatedAt int64 `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+	// Event is the marshalled Event, and is empty if Command produced no Event.
+	Event       []byte `bson:"event,omitempty" json:"event,omitempty"`
+	Result      []byte `bson:"result,omitempty" json:"result,omitempty"`
+	ResultTopic string `bson:"resultTopic,omitempty" json:"resultTopic,omitempty"`
+
+	EventSent  bool `bson:"eventSent" json:"eventSent"`
+	ResultSent bool `bson:"resultSent" json:"resultSent"`
+	Sent       bool `bson:"sent" json:"sent"`
+	// SentAt is the unix-time when both parts of entry were sent.
+	SentAt int64 `bson:"sentAt,omitempty" json:"sentAt,omitempty"`
+
+	Attempts int `bson:"attempts" json:"attempts"`
+	// NextAttemptAt is the unix-time before which publishing is not retried.
+	NextAttemptAt int64  `bson:"nextAttemptAt" json:"nextAttemptAt"`
+	LastError     string `bson:"lastError,omitempty" json:"lastError,omitempty"`
+}
@@ -0,0 +1,17 @@
+package model
+
+// ParkedEvent is an Event which could not be applied on Aggregate-state
+// because no EventApplier is registered for it. Parked Events are kept for
+// inspection, and can be replayed once an EventApplier is available.
+type ParkedEvent struct {
+	EventUUID     string `bson:"eventUUID,omitempty" json:"eventUUID,omitempty"`
+	Action        string `bson:"action,omitempty" json:"action,omitempty"`
+	AggregateID   int8   `bson:"aggregateID,omitempty" json:"aggregateID,omitempty"`
+	CorrelationID string `bson:"correlationID,omitempty" json:"correlationID,omitempty"`
+	Data          []byte `bson:"data,omitempty" json:"data,omitempty"`
+	NanoTime      int64  `bson:"nanoTime,omitempty" json:"nanoTime,omitempty"`
+	Reason        string `bson:"reason,omitempty" json:"reason,omitempty"`
+	Source        string `bson:"source,omitempty" json:"source,omitempty"`
+	Timestamp     int64  `bson:"timestamp,omitempty" json:"timestamp,omitempty"`
+	Version       int64  `bson:"version,omitempty" json:"version,omitempty"`
+}
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// ProcessedCommand is the result produced by a Command. This is stored
+// so that a redelivered Command is responded with its original result.
+type ProcessedCommand struct {
+	CommandUUID string `bson:"commandUUID,omitempty" json:"commandUUID,omitempty"`
+	// Document is the marshalled result-Document sent as the Command's response.
+	Document  []byte    `bson:"document,omitempty" json:"document,omitempty"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
@@ -3,6 +3,21 @@ package model
 // AggregateID for Shipment aggregate.
 const AggregateID = 2
 
+// Shipment defines a delivery, which owns the Items received as a part of it.
+type Shipment struct {
+	ShipmentID      string   `bson:"shipmentID,omitempty" json:"shipmentID,omitempty"`
+	ActualArrival   int64    `bson:"actualArrival,omitempty" json:"actualArrival,omitempty"`
+	Carrier         string   `bson:"carrier,omitempty" json:"carrier,omitempty"`
+	Destination     string   `bson:"destination,omitempty" json:"destination,omitempty"`
+	ExpectedArrival int64    `bson:"expectedArrival,omitempty" json:"expectedArrival,omitempty"`
+	ItemIDs         []string `bson:"itemIDs,omitempty" json:"itemIDs,omitempty"`
+	Origin          string   `bson:"origin,omitempty" json:"origin,omitempty"`
+	Status          string   `bson:"status,omitempty" json:"status,omitempty"`
+	Timestamp       int64    `bson:"timestamp,omitempty" json:"timestamp,omitempty"`
+	TrackingNumber  string   `bson:"trackingNumber,omitempty" json:"trackingNumber,omitempty"`
+	Version         int64    `bson:"version,omitempty" json:"version,omitempty"`
+}
+
 // Item defines the an item in Shipment.
 type Item struct {
 	ItemID       string  `bson:"itemID,omitempty" json:"itemID,omitempty"`
@@ -12,8 +27,10 @@ type Item struct {
 	Origin       string  `bson:"origin,omitempty" json:"origin,omitempty"`
 	Price        float64 `bson:"price,omitempty" json:"price,omitempty"`
 	RSCustomerID string  `bson:"rsCustomerID,omitempty" json:"rsCustomerID,omitempty"`
+	ShipmentID   string  `bson:"shipmentID,omitempty" json:"shipmentID,omitempty"`
 	SKU          string  `bson:"sku,omitempty" json:"sku,omitempty"`
 	Timestamp    int64   `bson:"timestamp,omitempty" json:"timestamp,omitempty"`
 	TotalWeight  float64 `bson:"totalWeight,omitempty" json:"totalWeight,omitempty"`
 	UPC          string  `bson:"upc,omitempty" json:"upc,omitempty"`
+	Version      int64   `bson:"version,omitempty" json:"version,omitempty"`
 }
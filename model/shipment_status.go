@@ -0,0 +1,49 @@
+package model
+
+// Statuses for Shipment lifecycle.
+const (
+	ShipmentPlanned   = "Planned"
+	ShipmentInTransit = "InTransit"
+	ShipmentArrived   = "Arrived"
+	ShipmentInspected = "Inspected"
+	ShipmentReceived  = "Received"
+	ShipmentClosed    = "Closed"
+	ShipmentRejected  = "Rejected"
+	ShipmentCancelled = "Cancelled"
+)
+
+// shipmentTransitions maps a Shipment-status to the statuses it can transition to.
+var shipmentTransitions = map[string][]string{
+	ShipmentPlanned:   []string{ShipmentInTransit, ShipmentCancelled},
+	ShipmentInTransit: []string{ShipmentArrived, ShipmentCancelled},
+	ShipmentArrived:   []string{ShipmentInspected, ShipmentRejected},
+	ShipmentInspected: []string{ShipmentReceived, ShipmentRejected},
+	ShipmentReceived:  []string{ShipmentClosed},
+	ShipmentRejected:  []string{ShipmentClosed},
+	ShipmentClosed:    []string{},
+	ShipmentCancelled: []string{},
+}
+
+// IsShipmentStatus checks if the provided status is a known Shipment-status.
+func IsShipmentStatus(status string) bool {
+	_, exists := shipmentTransitions[status]
+	return exists
+}
+
+// CanTransitionShipment checks if a Shipment can transition from
+// current status to the next status.
+func CanTransitionShipment(current string, next string) bool {
+	for _, status := range shipmentTransitions[current] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsShipmentFinal checks if the provided status is a terminal Shipment-status,
+// after which the Shipment can no longer be modified.
+func IsShipmentFinal(status string) bool {
+	transitions, exists := shipmentTransitions[status]
+	return exists && len(transitions) == 0
+}
@@ -0,0 +1,33 @@
+package model
+
+// Snapshot is a point-in-time copy of Aggregate-state, along with the last
+// Event applied on it. Aggregate-state can be restored from a Snapshot by
+// replaying only the Events after it.
+type Snapshot struct {
+	SnapshotID  string `bson:"snapshotID,omitempty" json:"snapshotID,omitempty"`
+	AggregateID int8   `bson:"aggregateID,omitempty" json:"aggregateID,omitempty"`
+	// Checksum is the SHA256 checksum of Items and Shipments.
+	Checksum string `bson:"checksum,omitempty" json:"checksum,omitempty"`
+	// ChunkCount is the number of SnapshotChunks storing Items and Shipments.
+	// Snapshots without chunks store Items and Shipments in the Snapshot.
+	ChunkCount int    `bson:"chunkCount,omitempty" json:"chunkCount,omitempty"`
+	EventUUID  string `bson:"eventUUID,omitempty" json:"eventUUID,omitempty"`
+	Items      []Item `bson:"items,omitempty" json:"items,omitempty"`
+	NanoTime   int64  `bson:"nanoTime,omitempty" json:"nanoTime,omitempty"`
+	// RecentEvents are the Events applied within the late-window
+	// before NanoTime, as in HighWaterMark.
+	RecentEvents []AppliedEvent `bson:"recentEvents,omitempty" json:"recentEvents,omitempty"`
+	Shipments    []Shipment     `bson:"shipments,omitempty" json:"shipments,omitempty"`
+	Timestamp    int64          `bson:"timestamp,omitempty" json:"timestamp,omitempty"`
+}
+
+// SnapshotChunk is a part of the Items and Shipments of a Snapshot.
+// Snapshots are stored in chunks, since the whole Aggregate-state
+// might not fit in a single Mongo-document.
+type SnapshotChunk struct {
+	SnapshotID string `bson:"snapshotID,omitempty" json:"snapshotID,omitempty"`
+	// Chunk is the position of chunk in Snapshot, starting from 1.
+	Chunk     int        `bson:"chunk,omitempty" json:"chunk,omitempty"`
+	Items     []Item     `bson:"items,omitempty" json:"items,omitempty"`
+	Shipments []Shipment `bson:"shipments,omitempty" json:"shipments,omitempty"`
+}
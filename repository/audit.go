@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/pkg/errors"
+)
+
+// AuditRepository stores the audit-trail of changes made by Commands.
+// Entries are only ever inserted, so the audit-trail cannot be altered.
+type AuditRepository interface {
+	// Find returns the AuditEntries matching filter, which uses
+	// the JSON field-names.
+	Find(filter map[string]interface{}) ([]*model.AuditEntry, error)
+	Insert(entry *model.AuditEntry) error
+}
+
+// MongoAuditRepository is the AuditRepository stored in a Mongo-collection.
+type MongoAuditRepository struct {
+	coll *mongo.Collection
+}
+
+// NewMongoAuditRepository creates an AuditRepository using the collection,
+// which must use model.AuditEntry as its SchemaStruct.
+func NewMongoAuditRepository(coll *mongo.Collection) (*MongoAuditRepository, error) {
+	if coll == nil {
+		return nil, errors.New("coll cannot be nil")
+	}
+	return &MongoAuditRepository{
+		coll: coll,
+	}, nil
+}
+
+// Find returns the AuditEntries matching filter.
+func (r *MongoAuditRepository) Find(
+	filter map[string]interface{},
+) ([]*model.AuditEntry, error) {
+	results, err := r.coll.Find(filter)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*model.AuditEntry, len(results))
+	for i, result := range results {
+		entry, assertOK := result.(*model.AuditEntry)
+		if !assertOK {
+			return nil, errors.New("error asserting find-result to AuditEntry")
+		}
+		entries[i] = entry
+	}
+	return entries, nil
+}
+
+// Insert inserts the AuditEntry.
+func (r *MongoAuditRepository) Insert(entry *model.AuditEntry) error {
+	_, err := r.coll.InsertOne(entry)
+	return err
+}
+
+// MemoryAuditRepository is the AuditRepository stored in memory.
+type MemoryAuditRepository struct {
+	lock    sync.RWMutex
+	entries []map[string]interface{}
+}
+
+// NewMemoryAuditRepository creates an empty in-memory AuditRepository.
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+// Find returns the AuditEntries matching filter, in order they were inserted.
+func (r *MemoryAuditRepository) Find(
+	filter map[string]interface{},
+) ([]*model.AuditEntry, error) {
+	filterMap, err := toMap(filter)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting filter to map")
+		return nil, err
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	entries := []*model.AuditEntry{}
+	for _, record := range r.entries {
+		if !matchesFilter(record, filterMap) {
+			continue
+		}
+		entry := &model.AuditEntry{}
+		err = fromMap(record, entry)
+		if err != nil {
+			err = errors.Wrap(err, "Error converting record to AuditEntry")
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Insert inserts the AuditEntry.
+func (r *MemoryAuditRepository) Insert(entry *model.AuditEntry) error {
+	record, err := toMap(entry)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting AuditEntry to map")
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.entries = append(r.entries, record)
+	return nil
+}
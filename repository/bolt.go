@@ -0,0 +1,304 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// Bolt-buckets for the stored records.
+var (
+	itemBucket      = []byte("items")
+	shipmentBucket  = []byte("shipments")
+	processedBucket = []byte("processedCommands")
+	hwmBucket       = []byte("highWaterMarks")
+)
+
+// createBucket creates the bucket in Bolt-database if it does not exist.
+func createBucket(db *bolt.DB, bucket []byte) error {
+	if db == nil {
+		return errors.New("db cannot be nil")
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "Error creating bucket: %s", bucket)
+		return err
+	}
+	return nil
+}
+
+// boltStore is the recordStore in a Bolt-bucket. Records are stored as
+// JSON, keyed by their idField, so lookups by idField read a single record,
+// while lookups by other fields scan the bucket.
+type boltStore struct {
+	db     *bolt.DB
+	bucket []byte
+	// idField is the unique field of records, and is required.
+	idField string
+	// newRecord returns an empty record of the stored type.
+	newRecord func() interface{}
+}
+
+func newBoltStore(
+	db *bolt.DB,
+	bucket []byte,
+	idField string,
+	newRecord func() interface{},
+) (*boltStore, error) {
+	err := createBucket(db, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltStore{
+		db:        db,
+		bucket:    bucket,
+		idField:   idField,
+		newRecord: newRecord,
+	}, nil
+}
+
+func (s *boltStore) find(filter interface{}) ([]map[string]interface{}, error) {
+	filterMap, err := toMap(filter)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting filter to map")
+		return nil, err
+	}
+
+	matches := []map[string]interface{}{}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		records, err := s.matching(tx.Bucket(s.bucket), filterMap)
+		if err != nil {
+			return err
+		}
+		for _, match := range records {
+			matches = append(matches, match.record)
+		}
+		return nil
+	})
+	if err != nil {
+		err = errors.Wrap(err, "Error finding records")
+		return nil, err
+	}
+	return matches, nil
+}
+
+func (s *boltStore) insert(record interface{}) error {
+	recordMap, err := s.normalize(record)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting record to map")
+		return err
+	}
+	key, err := s.key(recordMap)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(s.bucket)
+		if bucket.Get(key) != nil {
+			return fmt.Errorf("record with %s %s already exists", s.idField, key)
+		}
+		return put(bucket, key, recordMap)
+	})
+}
+
+func (s *boltStore) update(
+	filter map[string]interface{},
+	update map[string]interface{},
+) error {
+	filterMap, err := toMap(filter)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting filter to map")
+		return err
+	}
+	updateMap, err := toMap(update)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting update to map")
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(s.bucket)
+		records, err := s.matching(bucket, filterMap)
+		if err != nil {
+			return err
+		}
+
+		for _, match := range records {
+			for k, v := range updateMap {
+				match.record[k] = v
+			}
+			updated, err := s.normalize(match.record)
+			if err != nil {
+				err = errors.Wrap(err, "Error converting updated record to map")
+				return err
+			}
+			updatedKey, err := s.key(updated)
+			if err != nil {
+				return err
+			}
+
+			// The update changed the record's idField
+			if string(updatedKey) != match.key {
+				if bucket.Get(updatedKey) != nil {
+					return fmt.Errorf("record with %s %s already exists", s.idField, updatedKey)
+				}
+				err = bucket.Delete([]byte(match.key))
+				if err != nil {
+					return err
+				}
+			}
+			err = put(bucket, updatedKey, updated)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) delete(filter interface{}) error {
+	filterMap, err := toMap(filter)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting filter to map")
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(s.bucket)
+		records, err := s.matching(bucket, filterMap)
+		if err != nil {
+			return err
+		}
+		for _, match := range records {
+			err = bucket.Delete([]byte(match.key))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// boltRecord is a stored record with its Bolt-key.
+type boltRecord struct {
+	key    string
+	record map[string]interface{}
+}
+
+// matching returns the records in bucket matching filter, in order of their
+// Bolt-keys. The bucket is only scanned if filter does not have idField.
+func (s *boltStore) matching(
+	bucket *bolt.Bucket,
+	filter map[string]interface{},
+) ([]boltRecord, error) {
+	matches := []boltRecord{}
+
+	if id, isString := filter[s.idField].(string); isString {
+		value := bucket.Get([]byte(id))
+		if value == nil {
+			return matches, nil
+		}
+		record := map[string]interface{}{}
+		err := json.Unmarshal(value, &record)
+		if err != nil {
+			err = errors.Wrapf(err, "Error unmarshalling record with %s %s", s.idField, id)
+			return nil, err
+		}
+		if matchesFilter(record, filter) {
+			matches = append(matches, boltRecord{id, record})
+		}
+		return matches, nil
+	}
+
+	err := bucket.ForEach(func(key []byte, value []byte) error {
+		record := map[string]interface{}{}
+		err := json.Unmarshal(value, &record)
+		if err != nil {
+			err = errors.Wrapf(err, "Error unmarshalling record with %s %s", s.idField, key)
+			return err
+		}
+		if matchesFilter(record, filter) {
+			matches = append(matches, boltRecord{string(key), record})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// key returns the Bolt-key for record.
+func (s *boltStore) key(record map[string]interface{}) ([]byte, error) {
+	id, isString := record[s.idField].(string)
+	if !isString || id == "" {
+		return nil, fmt.Errorf("record is missing %s", s.idField)
+	}
+	return []byte(id), nil
+}
+
+// normalize converts the record to map using the stored record-type.
+func (s *boltStore) normalize(record interface{}) (map[string]interface{}, error) {
+	return normalizeRecord(s.newRecord, record)
+}
+
+func put(bucket *bolt.Bucket, key []byte, record map[string]interface{}) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		err = errors.Wrapf(err, "Error marshalling record with key %s", key)
+		return err
+	}
+	return bucket.Put(key, value)
+}
+
+// BoltItemRepository is the ItemRepository stored in a Bolt-database.
+type BoltItemRepository struct {
+	*storeItemRepository
+}
+
+// NewBoltItemRepository creates an ItemRepository using the Bolt-database.
+// Items are stored in "items" bucket, which is created if it does not exist.
+// Items must have an ItemID.
+func NewBoltItemRepository(db *bolt.DB) (*BoltItemRepository, error) {
+	store, err := newBoltStore(db, itemBucket, itemIDField, func() interface{} {
+		return &model.Item{}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltItemRepository{
+		&storeItemRepository{
+			store: store,
+		},
+	}, nil
+}
+
+// BoltShipmentRepository is the ShipmentRepository stored in a Bolt-database.
+type BoltShipmentRepository struct {
+	*storeShipmentRepository
+}
+
+// NewBoltShipmentRepository creates a ShipmentRepository using the
+// Bolt-database. Shipments are stored in "shipments" bucket, which is
+// created if it does not exist. Shipments must have a ShipmentID.
+func NewBoltShipmentRepository(db *bolt.DB) (*BoltShipmentRepository, error) {
+	store, err := newBoltStore(db, shipmentBucket, shipmentIDField, func() interface{} {
+		return &model.Shipment{}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltShipmentRepository{
+		&storeShipmentRepository{
+			store: store,
+		},
+	}, nil
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/boltdb/bolt"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/pkg/errors"
+)
+
+// HWMRepository stores the HighWaterMark of Aggregate-state.
+type HWMRepository interface {
+	// FindOne returns the HighWaterMark for Aggregate with the ID.
+	// ErrNotFound is returned if no HighWaterMark is stored yet.
+	FindOne(aggregateID int8) (*model.HighWaterMark, error)
+	// Save stores the HighWaterMark, replacing the existing
+	// HighWaterMark for its Aggregate.
+	Save(hwm *model.HighWaterMark) error
+}
+
+// MongoHWMRepository is the HWMRepository stored in a Mongo-collection.
+type MongoHWMRepository struct {
+	coll *mongo.Collection
+}
+
+// NewMongoHWMRepository creates an HWMRepository using the collection,
+// which must use model.HighWaterMark as its SchemaStruct.
+func NewMongoHWMRepository(coll *mongo.Collection) (*MongoHWMRepository, error) {
+	if coll == nil {
+		return nil, errors.New("coll cannot be nil")
+	}
+	return &MongoHWMRepository{
+		coll: coll,
+	}, nil
+}
+
+// FindOne returns the HighWaterMark for Aggregate with the ID.
+func (r *MongoHWMRepository) FindOne(aggregateID int8) (*model.HighWaterMark, error) {
+	result, err := r.coll.FindOne(map[string]interface{}{
+		"aggregateID": aggregateID,
+	})
+	if errors.Cause(err) == mgo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	hwm, assertOK := result.(*model.HighWaterMark)
+	if !assertOK {
+		return nil, errors.New("error asserting find-result to HighWaterMark")
+	}
+	return hwm, nil
+}
+
+// Save stores the HighWaterMark, inserting it if its Aggregate
+// has no HighWaterMark yet.
+func (r *MongoHWMRepository) Save(hwm *model.HighWaterMark) error {
+	result, err := r.coll.UpdateMany(
+		map[string]interface{}{
+			"aggregateID": hwm.AggregateID,
+		},
+		map[string]interface{}{
+			"eventUUID":    hwm.EventUUID,
+			"nanoTime":     hwm.NanoTime,
+			"recentEvents": hwm.RecentEvents,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	_, err = r.coll.InsertOne(hwm)
+	return err
+}
+
+// MemoryHWMRepository is the HWMRepository stored in memory.
+type MemoryHWMRepository struct {
+	lock sync.RWMutex
+	hwms map[int8]model.HighWaterMark
+}
+
+// NewMemoryHWMRepository creates an empty in-memory HWMRepository.
+func NewMemoryHWMRepository() *MemoryHWMRepository {
+	return &MemoryHWMRepository{
+		hwms: map[int8]model.HighWaterMark{},
+	}
+}
+
+// FindOne returns the HighWaterMark for Aggregate with the ID.
+func (r *MemoryHWMRepository) FindOne(aggregateID int8) (*model.HighWaterMark, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	hwm, exists := r.hwms[aggregateID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	hwm.RecentEvents = append([]model.AppliedEvent{}, hwm.RecentEvents...)
+	return &hwm, nil
+}
+
+// Save stores the HighWaterMark.
+func (r *MemoryHWMRepository) Save(hwm *model.HighWaterMark) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	saved := *hwm
+	saved.RecentEvents = append([]model.AppliedEvent{}, hwm.RecentEvents...)
+	r.hwms[hwm.AggregateID] = saved
+	return nil
+}
+
+// BoltHWMRepository is the HWMRepository stored in a Bolt-database.
+type BoltHWMRepository struct {
+	db *bolt.DB
+}
+
+// NewBoltHWMRepository creates an HWMRepository using the Bolt-database.
+// HighWaterMarks are stored in "highWaterMarks" bucket, which is created
+// if it does not exist.
+func NewBoltHWMRepository(db *bolt.DB) (*BoltHWMRepository, error) {
+	err := createBucket(db, hwmBucket)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltHWMRepository{
+		db: db,
+	}, nil
+}
+
+// FindOne returns the HighWaterMark for Aggregate with the ID.
+func (r *BoltHWMRepository) FindOne(aggregateID int8) (*model.HighWaterMark, error) {
+	var hwm *model.HighWaterMark
+	err := r.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(hwmBucket).Get(hwmKey(aggregateID))
+		if value == nil {
+			return ErrNotFound
+		}
+		hwm = &model.HighWaterMark{}
+		return json.Unmarshal(value, hwm)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hwm, nil
+}
+
+// Save stores the HighWaterMark.
+func (r *BoltHWMRepository) Save(hwm *model.HighWaterMark) error {
+	value, err := json.Marshal(hwm)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling HighWaterMark")
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(hwmBucket).Put(hwmKey(hwm.AggregateID), value)
+	})
+}
+
+func hwmKey(aggregateID int8) []byte {
+	return []byte(strconv.Itoa(int(aggregateID)))
+}
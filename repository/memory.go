@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/pkg/errors"
+)
+
+// memoryStore is the recordStore in memory. Records are copied in and
+// out of the store, so callers cannot modify stored records.
+type memoryStore struct {
+	lock sync.RWMutex
+	// idField is the unique field of records.
+	idField string
+	// newRecord returns an empty record of the stored type.
+	newRecord func() interface{}
+	records   []map[string]interface{}
+}
+
+func (s *memoryStore) find(filter interface{}) ([]map[string]interface{}, error) {
+	filterMap, err := toMap(filter)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting filter to map")
+		return nil, err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	matches := []map[string]interface{}{}
+	for _, record := range s.records {
+		if matchesFilter(record, filterMap) {
+			matches = append(matches, record)
+		}
+	}
+	return matches, nil
+}
+
+func (s *memoryStore) insert(record interface{}) error {
+	recordMap, err := s.normalize(record)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting record to map")
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if id, exists := recordMap[s.idField]; exists {
+		for _, stored := range s.records {
+			if reflect.DeepEqual(stored[s.idField], id) {
+				return fmt.Errorf("record with %s %v already exists", s.idField, id)
+			}
+		}
+	}
+	s.records = append(s.records, recordMap)
+	return nil
+}
+
+func (s *memoryStore) update(
+	filter map[string]interface{},
+	update map[string]interface{},
+) error {
+	filterMap, err := toMap(filter)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting filter to map")
+		return err
+	}
+	updateMap, err := toMap(update)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting update to map")
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, record := range s.records {
+		if !matchesFilter(record, filterMap) {
+			continue
+		}
+		updated := map[string]interface{}{}
+		for k, v := range record {
+			updated[k] = v
+		}
+		for k, v := range updateMap {
+			updated[k] = v
+		}
+		// Normalizing drops the fields set to zero-values,
+		// same as when the records are read from Mongo
+		updated, err = s.normalize(updated)
+		if err != nil {
+			err = errors.Wrap(err, "Error converting updated record to map")
+			return err
+		}
+		s.records[i] = updated
+	}
+	return nil
+}
+
+func (s *memoryStore) delete(filter interface{}) error {
+	filterMap, err := toMap(filter)
+	if err != nil {
+		err = errors.Wrap(err, "Error converting filter to map")
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	retained := []map[string]interface{}{}
+	for _, record := range s.records {
+		if !matchesFilter(record, filterMap) {
+			retained = append(retained, record)
+		}
+	}
+	s.records = retained
+	return nil
+}
+
+// normalize converts the record to map using the stored record-type.
+func (s *memoryStore) normalize(record interface{}) (map[string]interface{}, error) {
+	return normalizeRecord(s.newRecord, record)
+}
+
+// MemoryItemRepository is the ItemRepository stored in memory.
+type MemoryItemRepository struct {
+	*storeItemRepository
+}
+
+// NewMemoryItemRepository creates an empty in-memory ItemRepository.
+func NewMemoryItemRepository() *MemoryItemRepository {
+	return &MemoryItemRepository{
+		&storeItemRepository{
+			store: &memoryStore{
+				idField: itemIDField,
+				newRecord: func() interface{} {
+					return &model.Item{}
+				},
+			},
+		},
+	}
+}
+
+// MemoryShipmentRepository is the ShipmentRepository stored in memory.
+type MemoryShipmentRepository struct {
+	*storeShipmentRepository
+}
+
+// NewMemoryShipmentRepository creates an empty in-memory ShipmentRepository.
+func NewMemoryShipmentRepository() *MemoryShipmentRepository {
+	return &MemoryShipmentRepository{
+		&storeShipmentRepository{
+			store: &memoryStore{
+				idField: shipmentIDField,
+				newRecord: func() interface{} {
+					return &model.Shipment{}
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/pkg/errors"
+)
+
+// MongoItemRepository is the ItemRepository stored in a Mongo-collection.
+type MongoItemRepository struct {
+	coll *mongo.Collection
+}
+
+// NewMongoItemRepository creates an ItemRepository using the collection,
+// which must use model.Item as its SchemaStruct.
+func NewMongoItemRepository(coll *mongo.Collection) (*MongoItemRepository, error) {
+	if coll == nil {
+		return nil, errors.New("coll cannot be nil")
+	}
+	return &MongoItemRepository{
+		coll: coll,
+	}, nil
+}
+
+// FindOne returns the first Item matching filter.
+func (r *MongoItemRepository) FindOne(filter *model.Item) (*model.Item, error) {
+	result, err := r.coll.FindOne(filter)
+	if errors.Cause(err) == mgo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	item, assertOK := result.(*model.Item)
+	if !assertOK {
+		return nil, errors.New("error asserting find-result to Item")
+	}
+	return item, nil
+}
+
+// Find returns all Items matching filter.
+func (r *MongoItemRepository) Find(filter *model.Item) ([]*model.Item, error) {
+	results, err := r.coll.Find(filter)
+	if err != nil {
+		return nil, err
+	}
+	items := []*model.Item{}
+	for _, result := range results {
+		item, assertOK := result.(*model.Item)
+		if !assertOK {
+			return nil, errors.New("error asserting find-result to Item")
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Insert inserts the Item.
+func (r *MongoItemRepository) Insert(item *model.Item) error {
+	_, err := r.coll.InsertOne(item)
+	return err
+}
+
+// Update sets the fields in update on all Items matching filter.
+func (r *MongoItemRepository) Update(
+	filter map[string]interface{},
+	update map[string]interface{},
+) error {
+	_, err := r.coll.UpdateMany(filter, update)
+	return err
+}
+
+// Delete deletes all Items matching filter.
+func (r *MongoItemRepository) Delete(filter *model.Item) error {
+	_, err := r.coll.DeleteMany(filter)
+	return err
+}
+
+// MongoShipmentRepository is the ShipmentRepository stored in a Mongo-collection.
+type MongoShipmentRepository struct {
+	coll *mongo.Collection
+}
+
+// NewMongoShipmentRepository creates a ShipmentRepository using the
+// collection, which must use model.Shipment as its SchemaStruct.
+func NewMongoShipmentRepository(coll *mongo.Collection) (*MongoShipmentRepository, error) {
+	if coll == nil {
+		return nil, errors.New("coll cannot be nil")
+	}
+	return &MongoShipmentRepository{
+		coll: coll,
+	}, nil
+}
+
+// FindOne returns the first Shipment matching filter.
+func (r *MongoShipmentRepository) FindOne(filter *model.Shipment) (*model.Shipment, error) {
+	result, err := r.coll.FindOne(filter)
+	if errors.Cause(err) == mgo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	shipment, assertOK := result.(*model.Shipment)
+	if !assertOK {
+		return nil, errors.New("error asserting find-result to Shipment")
+	}
+	return shipment, nil
+}
+
+// Find returns all Shipments matching filter.
+func (r *MongoShipmentRepository) Find(filter *model.Shipment) ([]*model.Shipment, error) {
+	results, err := r.coll.Find(filter)
+	if err != nil {
+		return nil, err
+	}
+	shipments := []*model.Shipment{}
+	for _, result := range results {
+		shipment, assertOK := result.(*model.Shipment)
+		if !assertOK {
+			return nil, errors.New("error asserting find-result to Shipment")
+		}
+		shipments = append(shipments, shipment)
+	}
+	return shipments, nil
+}
+
+// Insert inserts the Shipment.
+func (r *MongoShipmentRepository) Insert(shipment *model.Shipment) error {
+	_, err := r.coll.InsertOne(shipment)
+	return err
+}
+
+// Update sets the fields in update on all Shipments matching filter.
+func (r *MongoShipmentRepository) Update(
+	filter map[string]interface{},
+	update map[string]interface{},
+) error {
+	_, err := r.coll.UpdateMany(filter, update)
+	return err
+}
+
+// Delete deletes all Shipments matching filter.
+func (r *MongoShipmentRepository) Delete(filter *model.Shipment) error {
+	_, err := r.coll.DeleteMany(filter)
+	return err
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/pkg/errors"
+)
+
+// OutboxRepository stores the OutboxEntries written by Command-handlers.
+// The entries are published and marked as sent by outbox-relay.
+type OutboxRepository interface {
+	// FindOne returns the OutboxEntry for Command with the UUID.
+	// ErrNotFound is returned if the Command has no OutboxEntry.
+	FindOne(commandUUID string) (*model.OutboxEntry, error)
+	Insert(entry *model.OutboxEntry) error
+}
+
+// MongoOutboxRepository is the OutboxRepository stored in a Mongo-collection.
+type MongoOutboxRepository struct {
+	coll *mongo.Collection
+}
+
+// NewMongoOutboxRepository creates an OutboxRepository using the collection,
+// which must use model.OutboxEntry as its SchemaStruct.
+func NewMongoOutboxRepository(coll *mongo.Collection) (*MongoOutboxRepository, error) {
+	if coll == nil {
+		return nil, errors.New("coll cannot be nil")
+	}
+	return &MongoOutboxRepository{
+		coll: coll,
+	}, nil
+}
+
+// FindOne returns the OutboxEntry for Command with the UUID.
+func (r *MongoOutboxRepository) FindOne(commandUUID string) (*model.OutboxEntry, error) {
+	result, err := r.coll.FindOne(map[string]interface{}{
+		"commandUUID": commandUUID,
+	})
+	if errors.Cause(err) == mgo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry, assertOK := result.(*model.OutboxEntry)
+	if !assertOK {
+		return nil, errors.New("error asserting find-result to OutboxEntry")
+	}
+	return entry, nil
+}
+
+// Insert inserts the OutboxEntry.
+func (r *MongoOutboxRepository) Insert(entry *model.OutboxEntry) error {
+	_, err := r.coll.InsertOne(entry)
+	return err
+}
+
+// MemoryOutboxRepository is the OutboxRepository stored in memory.
+type MemoryOutboxRepository struct {
+	lock    sync.RWMutex
+	entries map[string]model.OutboxEntry
+}
+
+// NewMemoryOutboxRepository creates an empty in-memory OutboxRepository.
+func NewMemoryOutboxRepository() *MemoryOutboxRepository {
+	return &MemoryOutboxRepository{
+		entries: map[string]model.OutboxEntry{},
+	}
+}
+
+// FindOne returns the OutboxEntry for Command with the UUID.
+func (r *MemoryOutboxRepository) FindOne(commandUUID string) (*model.OutboxEntry, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	entry, exists := r.entries[commandUUID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return &entry, nil
+}
+
+// Insert inserts the OutboxEntry. An error is returned if
+// an OutboxEntry with same CommandUUID already exists.
+func (r *MemoryOutboxRepository) Insert(entry *model.OutboxEntry) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, exists := r.entries[entry.CommandUUID]; exists {
+		return fmt.Errorf("record with commandUUID %s already exists", entry.CommandUUID)
+	}
+	r.entries[entry.CommandUUID] = *entry
+	return nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/go-mongoutils/mongo"
+	"github.com/boltdb/bolt"
+	mgo "github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/pkg/errors"
+)
+
+// ProcessedCommandRepository stores the results of processed Commands.
+type ProcessedCommandRepository interface {
+	// FindOne returns the ProcessedCommand for Command with the UUID.
+	// ErrNotFound is returned if the Command was not processed.
+	FindOne(commandUUID string) (*model.ProcessedCommand, error)
+	Insert(processed *model.ProcessedCommand) error
+}
+
+// MongoProcessedCommandRepository is the ProcessedCommandRepository
+// stored in a Mongo-collection.
+type MongoProcessedCommandRepository struct {
+	coll *mongo.Collection
+}
+
+// NewMongoProcessedCommandRepository creates a ProcessedCommandRepository
+// using the collection, which must use model.ProcessedCommand as its
+// SchemaStruct.
+func NewMongoProcessedCommandRepository(
+	coll *mongo.Collection,
+) (*MongoProcessedCommandRepository, error) {
+	if coll == nil {
+		return nil, errors.New("coll cannot be nil")
+	}
+	return &MongoProcessedCommandRepository{
+		coll: coll,
+	}, nil
+}
+
+// FindOne returns the ProcessedCommand for Command with the UUID.
+func (r *MongoProcessedCommandRepository) FindOne(
+	commandUUID string,
+) (*model.ProcessedCommand, error) {
+	result, err := r.coll.FindOne(map[string]interface{}{
+		"commandUUID": commandUUID,
+	})
+	if errors.Cause(err) == mgo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	processed, assertOK := result.(*model.ProcessedCommand)
+	if !assertOK {
+		return nil, errors.New("error asserting find-result to ProcessedCommand")
+	}
+	return processed, nil
+}
+
+// Insert inserts the ProcessedCommand.
+func (r *MongoProcessedCommandRepository) Insert(processed *model.ProcessedCommand) error {
+	_, err := r.coll.InsertOne(processed)
+	return err
+}
+
+// MemoryProcessedCommandRepository is the ProcessedCommandRepository
+// stored in memory. ProcessedCommands are not expired.
+type MemoryProcessedCommandRepository struct {
+	lock      sync.RWMutex
+	processed map[string]model.ProcessedCommand
+}
+
+// NewMemoryProcessedCommandRepository creates an empty
+// in-memory ProcessedCommandRepository.
+func NewMemoryProcessedCommandRepository() *MemoryProcessedCommandRepository {
+	return &MemoryProcessedCommandRepository{
+		processed: map[string]model.ProcessedCommand{},
+	}
+}
+
+// FindOne returns the ProcessedCommand for Command with the UUID.
+func (r *MemoryProcessedCommandRepository) FindOne(
+	commandUUID string,
+) (*model.ProcessedCommand, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	processed, exists := r.processed[commandUUID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return &processed, nil
+}
+
+// Insert inserts the ProcessedCommand. An error is returned if
+// a ProcessedCommand with same CommandUUID already exists.
+func (r *MemoryProcessedCommandRepository) Insert(processed *model.ProcessedCommand) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, exists := r.processed[processed.CommandUUID]; exists {
+		return fmt.Errorf("record with commandUUID %s already exists", processed.CommandUUID)
+	}
+	r.processed[processed.CommandUUID] = *processed
+	return nil
+}
+
+// BoltProcessedCommandRepository is the ProcessedCommandRepository stored
+// in a Bolt-database. ProcessedCommands are not expired.
+type BoltProcessedCommandRepository struct {
+	db *bolt.DB
+}
+
+// NewBoltProcessedCommandRepository creates a ProcessedCommandRepository
+// using the Bolt-database. ProcessedCommands are stored in
+// "processedCommands" bucket, which is created if it does not exist.
+func NewBoltProcessedCommandRepository(
+	db *bolt.DB,
+) (*BoltProcessedCommandRepository, error) {
+	err := createBucket(db, processedBucket)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltProcessedCommandRepository{
+		db: db,
+	}, nil
+}
+
+// FindOne returns the ProcessedCommand for Command with the UUID.
+func (r *BoltProcessedCommandRepository) FindOne(
+	commandUUID string,
+) (*model.ProcessedCommand, error) {
+	var processed *model.ProcessedCommand
+	err := r.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(processedBucket).Get([]byte(commandUUID))
+		if value == nil {
+			return ErrNotFound
+		}
+		processed = &model.ProcessedCommand{}
+		return json.Unmarshal(value, processed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return processed, nil
+}
+
+// Insert inserts the ProcessedCommand. An error is returned if
+// a ProcessedCommand with same CommandUUID already exists.
+func (r *BoltProcessedCommandRepository) Insert(processed *model.ProcessedCommand) error {
+	if processed.CommandUUID == "" {
+		return errors.New("processed-command is missing commandUUID")
+	}
+	value, err := json.Marshal(processed)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling ProcessedCommand")
+		return err
+	}
+
+	key := []byte(processed.CommandUUID)
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(processedBucket)
+		if bucket.Get(key) != nil {
+			return fmt.Errorf("record with commandUUID %s already exists", processed.CommandUUID)
+		}
+		return bucket.Put(key, value)
+	})
+}
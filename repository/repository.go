@@ -0,0 +1,45 @@
+// Package repository provides the storage for Items and Shipments in
+// Aggregate-state. Command-handlers and EventAppliers use the repositories
+// instead of the storage directly, so they can be used with the in-memory
+// repositories, such as in tests.
+package repository
+
+import (
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when no record matches the filter.
+var ErrNotFound = errors.New("record not found")
+
+// ItemRepository stores the Items in Aggregate-state.
+// Struct-filters match records on the non-zero fields of filter, so an
+// empty filter matches all records. Map-filters and updates use the
+// JSON field-names.
+type ItemRepository interface {
+	// FindOne returns the first Item matching filter.
+	// An error is returned if no Item matches.
+	FindOne(filter *model.Item) (*model.Item, error)
+	// Find returns all Items matching filter.
+	Find(filter *model.Item) ([]*model.Item, error)
+	Insert(item *model.Item) error
+	// Update sets the fields in update on all Items matching filter.
+	Update(filter map[string]interface{}, update map[string]interface{}) error
+	// Delete deletes all Items matching filter.
+	Delete(filter *model.Item) error
+}
+
+// ShipmentRepository stores the Shipments in Aggregate-state.
+// The filters are same as for ItemRepository.
+type ShipmentRepository interface {
+	// FindOne returns the first Shipment matching filter.
+	// An error is returned if no Shipment matches.
+	FindOne(filter *model.Shipment) (*model.Shipment, error)
+	// Find returns all Shipments matching filter.
+	Find(filter *model.Shipment) ([]*model.Shipment, error)
+	Insert(shipment *model.Shipment) error
+	// Update sets the fields in update on all Shipments matching filter.
+	Update(filter map[string]interface{}, update map[string]interface{}) error
+	// Delete deletes all Shipments matching filter.
+	Delete(filter *model.Shipment) error
+}
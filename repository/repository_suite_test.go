@@ -0,0 +1,419 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/boltdb/bolt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// TestRepository tests the in-memory and Bolt repositories.
+func TestRepository(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Repository Suite")
+}
+
+var _ = Describe("MemoryItemRepository", func() {
+	var items *MemoryItemRepository
+
+	BeforeEach(func() {
+		items = NewMemoryItemRepository()
+		err := items.Insert(&model.Item{
+			ItemID: "item-1",
+			Lot:    "lot-1",
+			Name:   "apple",
+			Price:  2.5,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		err = items.Insert(&model.Item{
+			ItemID:     "item-2",
+			Lot:        "lot-1",
+			Name:       "banana",
+			ShipmentID: "shipment-1",
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should find Items matching non-zero filter-fields", func() {
+		matches, err := items.Find(&model.Item{
+			Lot: "lot-1",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(HaveLen(2))
+
+		item, err := items.FindOne(&model.Item{
+			Lot:  "lot-1",
+			Name: "banana",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(item.ItemID).To(Equal("item-2"))
+	})
+
+	It("should match all Items with empty filter", func() {
+		matches, err := items.Find(&model.Item{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(HaveLen(2))
+	})
+
+	It("should return ErrNotFound if no Item matches", func() {
+		_, err := items.FindOne(&model.Item{
+			ItemID: "item-3",
+		})
+		Expect(err).To(Equal(ErrNotFound))
+	})
+
+	It("should return error when inserting existing ItemID", func() {
+		err := items.Insert(&model.Item{
+			ItemID: "item-1",
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should not allow modifying stored Items", func() {
+		item, err := items.FindOne(&model.Item{
+			ItemID: "item-1",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		item.Name = "pear"
+
+		item, err = items.FindOne(&model.Item{
+			ItemID: "item-1",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(item.Name).To(Equal("apple"))
+	})
+
+	It("should update Items matching filter", func() {
+		err := items.Update(
+			map[string]interface{}{
+				"itemID": "item-2",
+			},
+			map[string]interface{}{
+				"price":      3,
+				"shipmentID": "",
+				"version":    int64(2),
+			},
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		item, err := items.FindOne(&model.Item{
+			ItemID: "item-2",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(item.Name).To(Equal("banana"))
+		Expect(item.Price).To(Equal(3.0))
+		Expect(item.ShipmentID).To(BeEmpty())
+		Expect(item.Version).To(Equal(int64(2)))
+
+		item, err = items.FindOne(&model.Item{
+			ItemID: "item-1",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(item.Price).To(Equal(2.5))
+	})
+
+	It("should delete Items matching filter", func() {
+		err := items.Delete(&model.Item{
+			Name: "apple",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		matches, err := items.Find(&model.Item{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(HaveLen(1))
+		Expect(matches[0].ItemID).To(Equal("item-2"))
+	})
+})
+
+var _ = Describe("MemoryShipmentRepository", func() {
+	var shipments *MemoryShipmentRepository
+
+	BeforeEach(func() {
+		shipments = NewMemoryShipmentRepository()
+		err := shipments.Insert(&model.Shipment{
+			ShipmentID: "shipment-1",
+			Carrier:    "test-carrier",
+			ItemIDs:    []string{"item-1"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should update Shipment ItemIDs", func() {
+		err := shipments.Update(
+			map[string]interface{}{
+				"shipmentID": "shipment-1",
+			},
+			map[string]interface{}{
+				"itemIDs": []string{"item-1", "item-2"},
+			},
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		shipment, err := shipments.FindOne(&model.Shipment{
+			ShipmentID: "shipment-1",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(shipment.Carrier).To(Equal("test-carrier"))
+		Expect(shipment.ItemIDs).To(Equal([]string{"item-1", "item-2"}))
+	})
+
+	It("should return error when inserting existing ShipmentID", func() {
+		err := shipments.Insert(&model.Shipment{
+			ShipmentID: "shipment-1",
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should delete all Shipments with empty filter", func() {
+		err := shipments.Delete(&model.Shipment{})
+		Expect(err).ToNot(HaveOccurred())
+
+		matches, err := shipments.Find(&model.Shipment{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Memory metadata repositories", func() {
+	It("should return error when inserting existing OutboxEntry", func() {
+		outbox := NewMemoryOutboxRepository()
+		_, err := outbox.FindOne("cmd-1")
+		Expect(err).To(Equal(ErrNotFound))
+
+		err = outbox.Insert(&model.OutboxEntry{
+			CommandUUID: "cmd-1",
+			ResultTopic: "test-topic",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		entry, err := outbox.FindOne("cmd-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entry.ResultTopic).To(Equal("test-topic"))
+
+		err = outbox.Insert(&model.OutboxEntry{
+			CommandUUID: "cmd-1",
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should find AuditEntries matching filter", func() {
+		audit := NewMemoryAuditRepository()
+		for _, entry := range []*model.AuditEntry{
+			{AuditID: "audit-1", ItemID: "item-1", UserUUID: "user-1"},
+			{AuditID: "audit-2", ItemID: "item-2", UserUUID: "user-1"},
+			{AuditID: "audit-3", ItemID: "item-1", UserUUID: "user-2"},
+		} {
+			err := audit.Insert(entry)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		entries, err := audit.Find(map[string]interface{}{
+			"itemID": "item-1",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].AuditID).To(Equal("audit-1"))
+		Expect(entries[1].AuditID).To(Equal("audit-3"))
+
+		entries, err = audit.Find(map[string]interface{}{
+			"userUUID": "user-1",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+	})
+})
+
+var _ = Describe("BoltItemRepository", func() {
+	var (
+		dbDir string
+		db    *bolt.DB
+		items *BoltItemRepository
+	)
+
+	BeforeEach(func() {
+		var err error
+		dbDir, err = ioutil.TempDir("", "agg-shipment-bolt")
+		Expect(err).ToNot(HaveOccurred())
+		db, err = bolt.Open(filepath.Join(dbDir, "test.db"), 0600, nil)
+		Expect(err).ToNot(HaveOccurred())
+		items, err = NewBoltItemRepository(db)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = items.Insert(&model.Item{
+			ItemID: "item-1",
+			Lot:    "lot-1",
+			Name:   "apple",
+			Price:  2.5,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		err = items.Insert(&model.Item{
+			ItemID:     "item-2",
+			Lot:        "lot-1",
+			Name:       "banana",
+			ShipmentID: "shipment-1",
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(db.Close()).To(Succeed())
+		Expect(os.RemoveAll(dbDir)).To(Succeed())
+	})
+
+	It("should find Item by ItemID", func() {
+		item, err := items.FindOne(&model.Item{
+			ItemID: "item-2",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(item.Name).To(Equal("banana"))
+
+		_, err = items.FindOne(&model.Item{
+			ItemID: "item-2",
+			Name:   "apple",
+		})
+		Expect(err).To(Equal(ErrNotFound))
+	})
+
+	It("should find Items by other fields", func() {
+		matches, err := items.Find(&model.Item{
+			Lot: "lot-1",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(HaveLen(2))
+		Expect(matches[0].ItemID).To(Equal("item-1"))
+		Expect(matches[1].ItemID).To(Equal("item-2"))
+	})
+
+	It("should return error when inserting existing or missing ItemID", func() {
+		err := items.Insert(&model.Item{
+			ItemID: "item-1",
+		})
+		Expect(err).To(HaveOccurred())
+
+		err = items.Insert(&model.Item{
+			Name: "pear",
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should update Items matching filter", func() {
+		err := items.Update(
+			map[string]interface{}{
+				"shipmentID": "shipment-1",
+			},
+			map[string]interface{}{
+				"shipmentID": "",
+				"version":    int64(2),
+			},
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		item, err := items.FindOne(&model.Item{
+			ItemID: "item-2",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(item.Name).To(Equal("banana"))
+		Expect(item.ShipmentID).To(BeEmpty())
+		Expect(item.Version).To(Equal(int64(2)))
+	})
+
+	It("should delete Items matching filter", func() {
+		err := items.Delete(&model.Item{
+			Name: "apple",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		matches, err := items.Find(&model.Item{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(HaveLen(1))
+		Expect(matches[0].ItemID).To(Equal("item-2"))
+	})
+
+	It("should keep Items when database is reopened", func() {
+		Expect(db.Close()).To(Succeed())
+		var err error
+		db, err = bolt.Open(filepath.Join(dbDir, "test.db"), 0600, nil)
+		Expect(err).ToNot(HaveOccurred())
+		items, err = NewBoltItemRepository(db)
+		Expect(err).ToNot(HaveOccurred())
+
+		matches, err := items.Find(&model.Item{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(matches).To(HaveLen(2))
+	})
+})
+
+var _ = Describe("Bolt metadata repositories", func() {
+	var (
+		dbDir string
+		db    *bolt.DB
+	)
+
+	BeforeEach(func() {
+		var err error
+		dbDir, err = ioutil.TempDir("", "agg-shipment-bolt")
+		Expect(err).ToNot(HaveOccurred())
+		db, err = bolt.Open(filepath.Join(dbDir, "test.db"), 0600, nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(db.Close()).To(Succeed())
+		Expect(os.RemoveAll(dbDir)).To(Succeed())
+	})
+
+	It("should find inserted ProcessedCommands", func() {
+		processed, err := NewBoltProcessedCommandRepository(db)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = processed.FindOne("cmd-1")
+		Expect(err).To(Equal(ErrNotFound))
+
+		err = processed.Insert(&model.ProcessedCommand{
+			CommandUUID: "cmd-1",
+			Document:    []byte("test-doc"),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		err = processed.Insert(&model.ProcessedCommand{
+			CommandUUID: "cmd-1",
+		})
+		Expect(err).To(HaveOccurred())
+
+		found, err := processed.FindOne("cmd-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found.Document).To(Equal([]byte("test-doc")))
+	})
+
+	It("should replace saved HighWaterMark", func() {
+		hwms, err := NewBoltHWMRepository(db)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = hwms.FindOne(model.AggregateID)
+		Expect(err).To(Equal(ErrNotFound))
+
+		err = hwms.Save(&model.HighWaterMark{
+			AggregateID: model.AggregateID,
+			EventUUID:   "event-1",
+			NanoTime:    1,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		err = hwms.Save(&model.HighWaterMark{
+			AggregateID: model.AggregateID,
+			EventUUID:   "event-2",
+			NanoTime:    2,
+			RecentEvents: []model.AppliedEvent{
+				{EventUUID: "event-2", NanoTime: 2},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		hwm, err := hwms.FindOne(model.AggregateID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(hwm.EventUUID).To(Equal("event-2"))
+		Expect(hwm.RecentEvents).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/pkg/errors"
+)
+
+// Unique fields of the stored records.
+const (
+	itemIDField     = "itemID"
+	shipmentIDField = "shipmentID"
+)
+
+// recordStore stores records in their JSON map-form, so records are matched
+// and updated using the same field-names as the Mongo-collections.
+type recordStore interface {
+	find(filter interface{}) ([]map[string]interface{}, error)
+	insert(record interface{}) error
+	update(filter map[string]interface{}, update map[string]interface{}) error
+	delete(filter interface{}) error
+}
+
+// normalizeRecord converts the record to map using the record-type
+// returned by newRecord. This drops the fields set to zero-values,
+// same as when the records are read from Mongo.
+func normalizeRecord(
+	newRecord func() interface{},
+	record interface{},
+) (map[string]interface{}, error) {
+	typed := newRecord()
+	err := fromMap(record, typed)
+	if err != nil {
+		return nil, err
+	}
+	return toMap(typed)
+}
+
+// matchesFilter checks if the record has all fields in filter.
+func matchesFilter(record map[string]interface{}, filter map[string]interface{}) bool {
+	for k, v := range filter {
+		if !reflect.DeepEqual(record[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// toMap converts the value to map using its JSON-form.
+func toMap(value interface{}) (map[string]interface{}, error) {
+	valueMap := map[string]interface{}{}
+	marshalValue, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(marshalValue, &valueMap)
+	if err != nil {
+		return nil, err
+	}
+	return valueMap, nil
+}
+
+// fromMap converts the value into out using its JSON-form.
+func fromMap(value interface{}, out interface{}) error {
+	marshalValue, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(marshalValue, out)
+}
+
+// storeItemRepository is the ItemRepository using a recordStore.
+type storeItemRepository struct {
+	store recordStore
+}
+
+// FindOne returns the first Item matching filter.
+func (r *storeItemRepository) FindOne(filter *model.Item) (*model.Item, error) {
+	items, err := r.Find(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+	return items[0], nil
+}
+
+// Find returns all Items matching filter.
+func (r *storeItemRepository) Find(filter *model.Item) ([]*model.Item, error) {
+	matches, err := r.store.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*model.Item, len(matches))
+	for i, match := range matches {
+		items[i] = &model.Item{}
+		err = fromMap(match, items[i])
+		if err != nil {
+			err = errors.Wrap(err, "Error converting map to Item")
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// Insert inserts the Item. An error is returned if
+// an Item with same ItemID already exists.
+func (r *storeItemRepository) Insert(item *model.Item) error {
+	return r.store.insert(item)
+}
+
+// Update sets the fields in update on all Items matching filter.
+func (r *storeItemRepository) Update(
+	filter map[string]interface{},
+	update map[string]interface{},
+) error {
+	return r.store.update(filter, update)
+}
+
+// Delete deletes all Items matching filter.
+func (r *storeItemRepository) Delete(filter *model.Item) error {
+	return r.store.delete(filter)
+}
+
+// storeShipmentRepository is the ShipmentRepository using a recordStore.
+type storeShipmentRepository struct {
+	store recordStore
+}
+
+// FindOne returns the first Shipment matching filter.
+func (r *storeShipmentRepository) FindOne(filter *model.Shipment) (*model.Shipment, error) {
+	shipments, err := r.Find(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(shipments) == 0 {
+		return nil, ErrNotFound
+	}
+	return shipments[0], nil
+}
+
+// Find returns all Shipments matching filter.
+func (r *storeShipmentRepository) Find(filter *model.Shipment) ([]*model.Shipment, error) {
+	matches, err := r.store.find(filter)
+	if err != nil {
+		return nil, err
+	}
+	shipments := make([]*model.Shipment, len(matches))
+	for i, match := range matches {
+		shipments[i] = &model.Shipment{}
+		err = fromMap(match, shipments[i])
+		if err != nil {
+			err = errors.Wrap(err, "Error converting map to Shipment")
+			return nil, err
+		}
+	}
+	return shipments, nil
+}
+
+// Insert inserts the Shipment. An error is returned if
+// a Shipment with same ShipmentID already exists.
+func (r *storeShipmentRepository) Insert(shipment *model.Shipment) error {
+	return r.store.insert(shipment)
+}
+
+// Update sets the fields in update on all Shipments matching filter.
+func (r *storeShipmentRepository) Update(
+	filter map[string]interface{},
+	update map[string]interface{},
+) error {
+	return r.store.update(filter, update)
+}
+
+// Delete deletes all Shipments matching filter.
+func (r *storeShipmentRepository) Delete(filter *model.Shipment) error {
+	return r.store.delete(filter)
+}
@@ -70,7 +70,7 @@ var _ = Describe("EventTest", func() {
 				SKU:          "test-sku",
 				Timestamp:    time.Now().UTC().Unix(),
 				TotalWeight:       4.7,
-				UPC:          "test-upc",
+				UPC:          "00036000291452",
 			}
 			marshalItem, err := json.Marshal(mockItem)
 			Expect(err).ToNot(HaveOccurred())
@@ -92,6 +92,8 @@ var _ = Describe("EventTest", func() {
 					Expect(err).ToNot(HaveOccurred())
 
 					if itemModel.ItemID == mockItem.ItemID {
+						// New items always start at version 1
+						mockItem.Version = 1
 						Expect(*itemModel).To(Equal(mockItem))
 						return true
 					}
@@ -126,7 +128,7 @@ var _ = Describe("EventTest", func() {
 				SKU:          "test-sku",
 				Timestamp:    time.Now().UTC().Unix(),
 				TotalWeight:       4.7,
-				UPC:          "test-upc",
+				UPC:          "00036000291452",
 			}
 			_, err = coll.InsertOne(mockItem)
 			Expect(err).ToNot(HaveOccurred())
@@ -183,7 +185,7 @@ var _ = Describe("EventTest", func() {
 				SKU:          "test-sku",
 				Timestamp:    time.Now().UTC().Unix(),
 				TotalWeight:       4.7,
-				UPC:          "test-upc",
+				UPC:          "00036000291452",
 			}
 			_, err = coll.InsertOne(mockItem)
 			Expect(err).ToNot(HaveOccurred())
@@ -0,0 +1,69 @@
+package harness
+
+import (
+	"sync"
+
+	"github.com/TerrexTech/go-agg-builder/builder"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/TerrexTech/uuuid"
+)
+
+// EventStore is an in-process event-store. It holds the scripted Events,
+// followed by the Events appended to it, such as those published by
+// Producers.
+type EventStore struct {
+	lock   sync.Mutex
+	events []cmodel.Event
+	// delivered is the number of Events already returned by BuilderFunc.
+	delivered int
+}
+
+// NewEventStore creates an EventStore containing the scripted Events.
+func NewEventStore(events ...*cmodel.Event) *EventStore {
+	s := &EventStore{}
+	s.Append(events...)
+	return s
+}
+
+// Append adds the Events to the end of Event-stream.
+func (s *EventStore) Append(events ...*cmodel.Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, event := range events {
+		s.events = append(s.events, *event)
+	}
+}
+
+// Events returns all Events in the store.
+func (s *EventStore) Events() []cmodel.Event {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	events := make([]cmodel.Event, len(s.events))
+	copy(events, s.events)
+	return events
+}
+
+// BuilderFunc returns the Events not returned by previous calls, same as
+// go-agg-builder, which only returns the Events newer than the version of
+// Aggregate-state. It can be used as domain.BuilderFunc.
+func (s *EventStore) BuilderFunc(
+	correlationID uuuid.UUID,
+	timeoutSec int,
+) (<-chan *builder.EventResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pending := s.events[s.delivered:]
+	s.delivered = len(s.events)
+
+	eventRespChan := make(chan *builder.EventResponse, len(pending))
+	for _, event := range pending {
+		eventRespChan <- &builder.EventResponse{
+			Event: event,
+		}
+	}
+	close(eventRespChan)
+	return eventRespChan, nil
+}
@@ -0,0 +1,183 @@
+// Package harness provides in-process fakes for Kafka and the event-store,
+// so the Command → Event → result flow can be tested without running
+// Kafka, Mongo, Cassandra and the event-store services.
+package harness
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/pkg/errors"
+)
+
+// Claim is an in-process sarama.ConsumerGroupClaim for a single partition.
+// Messages sent to the Claim are delivered to the consumer in order.
+type Claim struct {
+	topic     string
+	partition int32
+
+	lock       sync.Mutex
+	nextOffset int64
+	closed     bool
+	messages   chan *sarama.ConsumerMessage
+}
+
+// NewClaim creates a Claim for partition 0 of topic.
+func NewClaim(topic string) *Claim {
+	return &Claim{
+		topic:    topic,
+		messages: make(chan *sarama.ConsumerMessage, 256),
+	}
+}
+
+// Topic returns the claimed topic.
+func (c *Claim) Topic() string {
+	return c.topic
+}
+
+// Partition returns the claimed partition.
+func (c *Claim) Partition() int32 {
+	return c.partition
+}
+
+// InitialOffset returns the offset of first message.
+func (c *Claim) InitialOffset() int64 {
+	return 0
+}
+
+// HighWaterMarkOffset returns the offset of next message sent to the Claim.
+func (c *Claim) HighWaterMarkOffset() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.nextOffset
+}
+
+// Messages returns the channel the consumer reads messages from.
+func (c *Claim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+// SendCommand sends the Command as the next message in partition.
+func (c *Claim) SendCommand(cmd *cmodel.Command) (*sarama.ConsumerMessage, error) {
+	marshalCmd, err := json.Marshal(cmd)
+	if err != nil {
+		err = errors.Wrap(err, "Error marshalling Command")
+		return nil, err
+	}
+	return c.Send(marshalCmd)
+}
+
+// Send sends the value as the next message in partition.
+func (c *Claim) Send(value []byte) (*sarama.ConsumerMessage, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return nil, errors.New("claim is closed")
+	}
+	msg := &sarama.ConsumerMessage{
+		Topic:     c.topic,
+		Partition: c.partition,
+		Offset:    c.nextOffset,
+		Value:     value,
+		Timestamp: time.Now(),
+	}
+	c.nextOffset++
+	c.messages <- msg
+	return msg, nil
+}
+
+// Close ends the Claim, as on rebalance or shutdown. The consumer
+// still receives the messages sent before the Claim was closed.
+func (c *Claim) Close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.messages)
+	}
+}
+
+// Session is an in-process sarama.ConsumerGroupSession,
+// which records the offsets marked by the consumer.
+type Session struct {
+	ctx context.Context
+
+	lock sync.Mutex
+	// marked is the next offset to consume, by topic and partition.
+	marked map[string]map[int32]int64
+}
+
+// NewSession creates a Session which ends when ctx is closed.
+func NewSession(ctx context.Context) *Session {
+	return &Session{
+		ctx:    ctx,
+		marked: map[string]map[int32]int64{},
+	}
+}
+
+// Claims returns no claims, since Claims are passed to the consumer directly.
+func (s *Session) Claims() map[string][]int32 {
+	return map[string][]int32{}
+}
+
+// MemberID returns the ID of consumer-group member.
+func (s *Session) MemberID() string {
+	return "harness-member"
+}
+
+// GenerationID returns the generation of consumer-group.
+func (s *Session) GenerationID() int32 {
+	return 1
+}
+
+// MarkOffset marks the offset as the next offset to consume.
+func (s *Session) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.marked[topic] == nil {
+		s.marked[topic] = map[int32]int64{}
+	}
+	// Same as Kafka, offsets are only marked forward
+	if offset > s.marked[topic][partition] {
+		s.marked[topic][partition] = offset
+	}
+}
+
+// Commit is a no-op, since marked offsets are available immediately.
+func (s *Session) Commit() {}
+
+// ResetOffset sets the next offset to consume.
+func (s *Session) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.marked[topic] == nil {
+		s.marked[topic] = map[int32]int64{}
+	}
+	s.marked[topic][partition] = offset
+}
+
+// MarkMessage marks the message as consumed.
+func (s *Session) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+// Context returns the context of Session.
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// Marked returns the next offset to consume from the partition,
+// which is 0 if no offset was marked.
+func (s *Session) Marked(topic string, partition int32) int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.marked[topic][partition]
+}
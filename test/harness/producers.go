@@ -0,0 +1,179 @@
+package harness
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	cmodel "github.com/TerrexTech/go-common-models/model"
+	"github.com/TerrexTech/uuuid"
+)
+
+// Producers capture the Events, results and dead-letters sent to the
+// producer-channels. Captured Events are appended to the EventStore, same
+// as go-eventpersistence does for Events published to Kafka.
+type Producers struct {
+	store *EventStore
+
+	eventChan      chan *cmodel.Event
+	resultChan     chan *cmodel.Document
+	deadLetterChan chan *model.DeadLetter
+	closed         chan struct{}
+
+	lock        sync.Mutex
+	events      []*cmodel.Event
+	results     []*cmodel.Document
+	deadLetters []*model.DeadLetter
+	// captured is closed, and replaced, whenever a record is captured.
+	captured chan struct{}
+}
+
+// NewProducers creates Producers which append captured Events to store.
+func NewProducers(store *EventStore) *Producers {
+	p := &Producers{
+		store: store,
+
+		// The channels are unbuffered and read by a single routine, so
+		// Events are in EventStore before any result sent after them
+		// is captured, same as when Events are published synchronously.
+		eventChan:      make(chan *cmodel.Event),
+		resultChan:     make(chan *cmodel.Document),
+		deadLetterChan: make(chan *model.DeadLetter),
+		closed:         make(chan struct{}),
+
+		captured: make(chan struct{}),
+	}
+	go p.capture()
+	return p
+}
+
+// EventProd is the channel Events are produced on.
+func (p *Producers) EventProd() chan<- *cmodel.Event {
+	return p.eventChan
+}
+
+// ResultProd is the channel result-Documents are produced on.
+func (p *Producers) ResultProd() chan<- *cmodel.Document {
+	return p.resultChan
+}
+
+// DeadLetterProd is the channel dead-letters are produced on.
+func (p *Producers) DeadLetterProd() chan<- *model.DeadLetter {
+	return p.deadLetterChan
+}
+
+func (p *Producers) capture() {
+	defer close(p.closed)
+
+	eventChan := p.eventChan
+	resultChan := p.resultChan
+	deadLetterChan := p.deadLetterChan
+	for eventChan != nil || resultChan != nil || deadLetterChan != nil {
+		select {
+		case event, isOpen := <-eventChan:
+			if !isOpen {
+				eventChan = nil
+				continue
+			}
+			p.store.Append(event)
+			p.record(func() {
+				p.events = append(p.events, event)
+			})
+
+		case doc, isOpen := <-resultChan:
+			if !isOpen {
+				resultChan = nil
+				continue
+			}
+			p.record(func() {
+				p.results = append(p.results, doc)
+			})
+
+		case deadLetter, isOpen := <-deadLetterChan:
+			if !isOpen {
+				deadLetterChan = nil
+				continue
+			}
+			p.record(func() {
+				p.deadLetters = append(p.deadLetters, deadLetter)
+			})
+		}
+	}
+}
+
+// record runs the capture-function and notifies the routines
+// waiting for captured records.
+func (p *Producers) record(captureFunc func()) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	captureFunc()
+	close(p.captured)
+	p.captured = make(chan struct{})
+}
+
+// Events returns the captured Events.
+func (p *Producers) Events() []*cmodel.Event {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*cmodel.Event{}, p.events...)
+}
+
+// Results returns the captured result-Documents.
+func (p *Producers) Results() []*cmodel.Document {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*cmodel.Document{}, p.results...)
+}
+
+// DeadLetters returns the captured dead-letters.
+func (p *Producers) DeadLetters() []*model.DeadLetter {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*model.DeadLetter{}, p.deadLetters...)
+}
+
+// Result waits for the count-th result-Document for Command with the UUID,
+// where count starts at 1. Commands are responded more than once if they
+// are redelivered.
+func (p *Producers) Result(
+	cmdUUID uuuid.UUID,
+	count int,
+	timeout time.Duration,
+) (*cmodel.Document, error) {
+	deadline := time.After(timeout)
+	for {
+		p.lock.Lock()
+		matched := 0
+		for _, doc := range p.results {
+			if doc.CorrelationID != cmdUUID {
+				continue
+			}
+			matched++
+			if matched == count {
+				p.lock.Unlock()
+				return doc, nil
+			}
+		}
+		captured := p.captured
+		p.lock.Unlock()
+
+		select {
+		case <-captured:
+		case <-deadline:
+			return nil, fmt.Errorf(
+				"timed out waiting for result %d of Command with ID: %s", count, cmdUUID,
+			)
+		}
+	}
+}
+
+// Close closes the producer-channels once all sent records are captured.
+// Nothing must be sent on the channels after this is called.
+func (p *Producers) Close() {
+	close(p.eventChan)
+	close(p.resultChan)
+	close(p.deadLetterChan)
+	<-p.closed
+}
@@ -0,0 +1,134 @@
+package test
+
+import (
+	"time"
+
+	"github.com/TerrexTech/agg-shipment-cmd/connutil"
+	"github.com/TerrexTech/agg-shipment-cmd/model"
+	"github.com/TerrexTech/agg-shipment-cmd/repository"
+	"github.com/TerrexTech/uuuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// These test the Mongo-repositories, since the Command-handler tests
+// use the in-memory repositories.
+var _ = Describe("MongoRepository", func() {
+	var (
+		items     *repository.MongoItemRepository
+		shipments *repository.MongoShipmentRepository
+		processed *repository.MongoProcessedCommandRepository
+		outbox    *repository.MongoOutboxRepository
+		audit     *repository.MongoAuditRepository
+	)
+
+	BeforeEach(func() {
+		mc, err := connutil.LoadMongoConfig()
+		Expect(err).ToNot(HaveOccurred())
+
+		items, err = repository.NewMongoItemRepository(mc.AggCollection)
+		Expect(err).ToNot(HaveOccurred())
+
+		shipmentColl, err := connutil.LoadShipmentCollection(mc)
+		Expect(err).ToNot(HaveOccurred())
+		shipments, err = repository.NewMongoShipmentRepository(shipmentColl)
+		Expect(err).ToNot(HaveOccurred())
+
+		processedColl, err := connutil.LoadProcessedCmdCollection(mc)
+		Expect(err).ToNot(HaveOccurred())
+		processed, err = repository.NewMongoProcessedCommandRepository(processedColl)
+		Expect(err).ToNot(HaveOccurred())
+
+		outboxColl, err := connutil.LoadOutboxCollection(mc)
+		Expect(err).ToNot(HaveOccurred())
+		outbox, err = repository.NewMongoOutboxRepository(outboxColl)
+		Expect(err).ToNot(HaveOccurred())
+
+		auditColl, err := connutil.LoadAuditCollection(mc)
+		Expect(err).ToNot(HaveOccurred())
+		audit, err = repository.NewMongoAuditRepository(auditColl)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should return ErrNotFound for missing Item", func() {
+		itemID, err := uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = items.FindOne(&model.Item{
+			ItemID: itemID.String(),
+		})
+		Expect(err).To(Equal(repository.ErrNotFound))
+	})
+
+	It("should return ErrNotFound for missing Shipment", func() {
+		shipmentID, err := uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = shipments.FindOne(&model.Shipment{
+			ShipmentID: shipmentID.String(),
+		})
+		Expect(err).To(Equal(repository.ErrNotFound))
+	})
+
+	It("should find inserted ProcessedCommand", func() {
+		cmdUUID, err := uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = processed.FindOne(cmdUUID.String())
+		Expect(err).To(Equal(repository.ErrNotFound))
+
+		err = processed.Insert(&model.ProcessedCommand{
+			CommandUUID: cmdUUID.String(),
+			Document:    []byte(`{"topic":"test-topic"}`),
+			CreatedAt:   time.Now(),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		result, err := processed.FindOne(cmdUUID.String())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Document).To(Equal([]byte(`{"topic":"test-topic"}`)))
+	})
+
+	It("should find inserted OutboxEntry", func() {
+		cmdUUID, err := uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = outbox.FindOne(cmdUUID.String())
+		Expect(err).To(Equal(repository.ErrNotFound))
+
+		err = outbox.Insert(&model.OutboxEntry{
+			CommandUUID: cmdUUID.String(),
+			CreatedAt:   time.Now().UnixNano(),
+			ResultTopic: "test-topic",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		entry, err := outbox.FindOne(cmdUUID.String())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entry.ResultTopic).To(Equal("test-topic"))
+	})
+
+	It("should find AuditEntries matching filter", func() {
+		itemID, err := uuuid.NewV4()
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 1; i <= 2; i++ {
+			auditID, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			err = audit.Insert(&model.AuditEntry{
+				AuditID:   auditID.String(),
+				Action:    model.EventItemUpdated,
+				ItemID:    itemID.String(),
+				Timestamp: int64(i),
+			})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		entries, err := audit.Find(map[string]interface{}{
+			"itemID": itemID.String(),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		for _, entry := range entries {
+			Expect(entry.ItemID).To(Equal(itemID.String()))
+		}
+	})
+})
@@ -71,7 +71,7 @@ var _ = Describe("ResultTest", func() {
 				SKU:          "test-sku",
 				Timestamp:    time.Now().UTC().Unix(),
 				TotalWeight:       4.7,
-				UPC:          "test-upc",
+				UPC:          "00036000291452",
 			}
 			marshalItem, err := json.Marshal(mockItem)
 			Expect(err).ToNot(HaveOccurred())
@@ -96,6 +96,8 @@ var _ = Describe("ResultTest", func() {
 					Expect(err).ToNot(HaveOccurred())
 
 					if itemModel.ItemID == mockItem.ItemID {
+						// New items always start at version 1
+						mockItem.Version = 1
 						Expect(*itemModel).To(Equal(mockItem))
 						return true
 					}
@@ -130,7 +132,7 @@ var _ = Describe("ResultTest", func() {
 				SKU:          "test-sku",
 				Timestamp:    time.Now().UTC().Unix(),
 				TotalWeight:       4.7,
-				UPC:          "test-upc",
+				UPC:          "00036000291452",
 			}
 			_, err = coll.InsertOne(mockItem)
 			Expect(err).ToNot(HaveOccurred())
@@ -190,7 +192,7 @@ var _ = Describe("ResultTest", func() {
 				SKU:          "test-sku",
 				Timestamp:    time.Now().UTC().Unix(),
 				TotalWeight:       4.7,
-				UPC:          "test-upc",
+				UPC:          "00036000291452",
 			}
 			_, err = coll.InsertOne(mockItem)
 			Expect(err).ToNot(HaveOccurred())
@@ -263,4 +265,76 @@ var _ = Describe("ResultTest", func() {
 			close(done)
 		}, 15)
 	})
+
+	Describe("RejectedCommand", func() {
+		// testRejected produces the Command and checks that it
+		// receives error response with specified code.
+		testRejected := func(mockCmd *cmodel.Command, errCode int16) {
+			marshalCmd, err := json.Marshal(mockCmd)
+			Expect(err).ToNot(HaveOccurred())
+			producer.Input() <- kafka.CreateMessage(reqTopic, marshalCmd)
+
+			consumer, err := kafka.NewConsumer(consConfig)
+			Expect(err).ToNot(HaveOccurred())
+
+			msgCallback := func(msg *sarama.ConsumerMessage) bool {
+				defer GinkgoRecover()
+				doc := &cmodel.Document{}
+				err := json.Unmarshal(msg.Value, doc)
+				Expect(err).ToNot(HaveOccurred())
+
+				if doc.CorrelationID == mockCmd.UUID {
+					Expect(doc.Error).ToNot(BeEmpty())
+					Expect(doc.ErrorCode).To(Equal(errCode))
+					return true
+				}
+				return false
+			}
+
+			handler := &msgHandler{msgCallback}
+			err = consumer.Consume(context.Background(), handler)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = consumer.Close()
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		mockCmd := func(action string, timestamp int64) *cmodel.Command {
+			cid, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+			uuid, err := uuuid.NewV4()
+			Expect(err).ToNot(HaveOccurred())
+
+			return &cmodel.Command{
+				Action:        action,
+				CorrelationID: cid,
+				Data:          []byte("{}"),
+				ResponseTopic: respTopic,
+				Source:        "test-source",
+				SourceTopic:   reqTopic,
+				Timestamp:     timestamp,
+				TTLSec:        15,
+				UUID:          uuid,
+			}
+		}
+
+		It("should respond with ExpiredError to expired Command", func(done Done) {
+			expiredAt := time.Now().UTC().Add(-time.Minute).Unix()
+			testRejected(mockCmd("AddItem", expiredAt), model.ExpiredError)
+			close(done)
+		}, 15)
+
+		It("should respond with MissingActionError to Command without Action", func(done Done) {
+			testRejected(mockCmd("", time.Now().UTC().Unix()), model.MissingActionError)
+			close(done)
+		}, 15)
+
+		It("should respond with UnknownActionError to unregistered Command", func(done Done) {
+			testRejected(
+				mockCmd("TestUnknownAction", time.Now().UTC().Unix()),
+				model.UnknownActionError,
+			)
+			close(done)
+		}, 15)
+	})
 })
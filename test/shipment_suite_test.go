@@ -32,6 +32,15 @@ func TestItem(t *testing.T) {
 	missingVar, err := commonutil.ValidateEnv(
 		"KAFKA_BROKERS",
 		"KAFKA_CONSUMER_TOPIC_REQUEST",
+
+		"MONGO_HOSTS",
+		"MONGO_DATABASE",
+		"MONGO_AGG_COLLECTION",
+		"MONGO_META_COLLECTION",
+		"MONGO_SHIPMENT_COLLECTION",
+		"MONGO_PROCESSED_CMD_COLLECTION",
+		"MONGO_OUTBOX_COLLECTION",
+		"MONGO_AUDIT_COLLECTION",
 	)
 
 	if err != nil {
@@ -0,0 +1,256 @@
+// Package validation validates the fields of entities against declared
+// constraints, and reports all invalid fields at once.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/TerrexTech/uuuid"
+)
+
+// Rules reported in FieldErrors.
+const (
+	RuleRequired  = "required"
+	RuleReadOnly  = "readOnly"
+	RuleImmutable = "immutable"
+	RuleType      = "type"
+	RuleMaxLength = "maxLength"
+	RuleMin       = "min"
+	RuleMax       = "max"
+	RuleFormat    = "format"
+	RuleUnknown   = "unknown"
+)
+
+// Kind is the JSON-type of a field.
+type Kind int
+
+// Kinds of fields.
+const (
+	String Kind = iota
+	Number
+)
+
+func (k Kind) String() string {
+	if k == Number {
+		return "number"
+	}
+	return "string"
+}
+
+// Format is a format which string-fields must match.
+type Format struct {
+	// Name describes the format in errors.
+	Name  string
+	Valid func(value string) bool
+}
+
+// UUIDFormat matches UUIDs.
+var UUIDFormat = &Format{
+	Name: "UUID",
+	Valid: func(value string) bool {
+		_, err := uuuid.FromString(value)
+		return err == nil
+	},
+}
+
+// Field declares the constraints on a field, which is identified by its
+// JSON-name. Constraints which are not set are not checked.
+type Field struct {
+	Name string
+	Kind Kind
+
+	// Required fields must be set when creating, and cannot be
+	// cleared when updating.
+	Required bool
+	// ReadOnly fields are only set by the service, and so cannot
+	// be set when creating or updating.
+	ReadOnly bool
+	// Immutable fields cannot be changed once set.
+	Immutable bool
+
+	// MaxLength is the maximum number of characters in string-fields.
+	MaxLength int
+	// Min and Max are the inclusive range of number-fields.
+	Min *float64
+	Max *float64
+	// Format is the format string-fields must match.
+	Format *Format
+}
+
+// Float returns a pointer to the value, for use as Min and Max.
+func Float(value float64) *float64 {
+	return &value
+}
+
+// FieldError is the error for a field which failed a constraint.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors are the errors for all invalid fields.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fieldErr := range e {
+		msgs[i] = fmt.Sprintf("%s %s", fieldErr.Field, fieldErr.Message)
+	}
+	return "invalid fields: " + strings.Join(msgs, "; ")
+}
+
+// Schema is the list of all fields of an entity.
+type Schema []Field
+
+// ValidateCreate validates the fields of a new entity. Fields which are
+// absent or nil are not set.
+func (s Schema) ValidateCreate(fields map[string]interface{}) Errors {
+	errs := Errors{}
+	for _, field := range s {
+		value := fields[field.Name]
+		if isZero(value) {
+			if field.Required {
+				errs = append(errs, field.newError(RuleRequired, "is required"))
+			}
+			continue
+		}
+		if field.ReadOnly {
+			errs = append(errs, field.newError(RuleReadOnly, "cannot be set"))
+			continue
+		}
+		errs = append(errs, field.validateValue(value)...)
+	}
+	errs = append(errs, s.unknownFields(fields)...)
+	return errs
+}
+
+// ValidateUpdate validates the fields being updated on an existing entity,
+// whose current fields are provided. Fields not in update are unchanged,
+// and so are not validated.
+func (s Schema) ValidateUpdate(current map[string]interface{}, update map[string]interface{}) Errors {
+	errs := Errors{}
+	for _, field := range s {
+		value, exists := update[field.Name]
+		if !exists {
+			continue
+		}
+		if field.ReadOnly {
+			errs = append(errs, field.newError(RuleReadOnly, "cannot be set"))
+			continue
+		}
+		curValue := current[field.Name]
+		if field.Immutable && !isZero(curValue) && !reflect.DeepEqual(value, curValue) {
+			errs = append(errs, field.newError(RuleImmutable, "cannot be changed"))
+			continue
+		}
+		if isZero(value) {
+			if field.Required {
+				errs = append(errs, field.newError(RuleRequired, "cannot be cleared"))
+			}
+			continue
+		}
+		errs = append(errs, field.validateValue(value)...)
+	}
+	errs = append(errs, s.unknownFields(update)...)
+	return errs
+}
+
+// unknownFields returns errors for the fields not in Schema,
+// sorted by field-name.
+func (s Schema) unknownFields(fields map[string]interface{}) Errors {
+	known := make(map[string]bool, len(s))
+	for _, field := range s {
+		known[field.Name] = true
+	}
+
+	unknown := []string{}
+	for name := range fields {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+
+	errs := Errors{}
+	for _, name := range unknown {
+		errs = append(errs, FieldError{
+			Field:   name,
+			Rule:    RuleUnknown,
+			Message: "is not a known field",
+		})
+	}
+	return errs
+}
+
+// validateValue validates the type, length, range and format of non-zero value.
+func (f *Field) validateValue(value interface{}) Errors {
+	errs := Errors{}
+	switch f.Kind {
+	case String:
+		str, isString := value.(string)
+		if !isString {
+			return append(errs, f.newError(RuleType, "must be a string"))
+		}
+		if f.MaxLength > 0 && utf8.RuneCountInString(str) > f.MaxLength {
+			msg := fmt.Sprintf("must be at most %d characters", f.MaxLength)
+			errs = append(errs, f.newError(RuleMaxLength, msg))
+		}
+		if f.Format != nil && !f.Format.Valid(str) {
+			msg := fmt.Sprintf("must be a valid %s", f.Format.Name)
+			errs = append(errs, f.newError(RuleFormat, msg))
+		}
+
+	case Number:
+		num, isNumber := toFloat(value)
+		if !isNumber {
+			return append(errs, f.newError(RuleType, "must be a number"))
+		}
+		if f.Min != nil && num < *f.Min {
+			msg := fmt.Sprintf("must be at least %v", *f.Min)
+			errs = append(errs, f.newError(RuleMin, msg))
+		}
+		if f.Max != nil && num > *f.Max {
+			msg := fmt.Sprintf("must be at most %v", *f.Max)
+			errs = append(errs, f.newError(RuleMax, msg))
+		}
+	}
+	return errs
+}
+
+func (f *Field) newError(rule string, msg string) FieldError {
+	return FieldError{
+		Field:   f.Name,
+		Rule:    rule,
+		Message: msg,
+	}
+}
+
+// isZero checks if the value is nil or the zero-value of its type.
+func isZero(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	return reflect.DeepEqual(value, reflect.Zero(reflect.TypeOf(value)).Interface())
+}
+
+// toFloat converts the numeric value, such as decoded from JSON, to float64.
+func toFloat(value interface{}) (float64, bool) {
+	switch num := value.(type) {
+	case float64:
+		return num, true
+	case float32:
+		return float64(num), true
+	case int:
+		return float64(num), true
+	case int64:
+		return float64(num), true
+	case int32:
+		return float64(num), true
+	}
+	return 0, false
+}
@@ -0,0 +1,140 @@
+package validation
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// TestValidation tests validating fields against Schema.
+func TestValidation(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Validation Suite")
+}
+
+var _ = Describe("Schema", func() {
+	schema := Schema{
+		{
+			Name:      "id",
+			Kind:      String,
+			Required:  true,
+			Immutable: true,
+			Format:    UUIDFormat,
+		},
+		{
+			Name:      "name",
+			Kind:      String,
+			Required:  true,
+			MaxLength: 5,
+		},
+		{
+			Name: "price",
+			Kind: Number,
+			Min:  Float(0),
+			Max:  Float(100),
+		},
+		{
+			Name:     "version",
+			Kind:     Number,
+			ReadOnly: true,
+		},
+	}
+	const testID = "0fa2d6e8-3b0b-4f4d-9a0e-cd4a4b3c8f7e"
+
+	Describe("ValidateCreate", func() {
+		It("should return no errors for valid fields", func() {
+			errs := schema.ValidateCreate(map[string]interface{}{
+				"id":    testID,
+				"name":  "apple",
+				"price": 2.5,
+			})
+			Expect(errs).To(BeEmpty())
+		})
+
+		It("should return errors for all invalid fields", func() {
+			errs := schema.ValidateCreate(map[string]interface{}{
+				"id":      "invalid-id",
+				"price":   -1.0,
+				"version": 2.0,
+				"color":   "red",
+			})
+			Expect(errs).To(Equal(Errors{
+				{Field: "id", Rule: RuleFormat, Message: "must be a valid UUID"},
+				{Field: "name", Rule: RuleRequired, Message: "is required"},
+				{Field: "price", Rule: RuleMin, Message: "must be at least 0"},
+				{Field: "version", Rule: RuleReadOnly, Message: "cannot be set"},
+				{Field: "color", Rule: RuleUnknown, Message: "is not a known field"},
+			}))
+		})
+
+		It("should return errors for length, range and type", func() {
+			errs := schema.ValidateCreate(map[string]interface{}{
+				"id":    testID,
+				"name":  "banana",
+				"price": "free",
+			})
+			Expect(errs).To(Equal(Errors{
+				{Field: "name", Rule: RuleMaxLength, Message: "must be at most 5 characters"},
+				{Field: "price", Rule: RuleType, Message: "must be a number"},
+			}))
+
+			errs = schema.ValidateCreate(map[string]interface{}{
+				"id":    testID,
+				"name":  "pear",
+				"price": 101.0,
+			})
+			Expect(errs).To(Equal(Errors{
+				{Field: "price", Rule: RuleMax, Message: "must be at most 100"},
+			}))
+		})
+	})
+
+	Describe("ValidateUpdate", func() {
+		current := map[string]interface{}{
+			"id":      testID,
+			"name":    "apple",
+			"price":   2.5,
+			"version": 3.0,
+		}
+
+		It("should only validate the updated fields", func() {
+			errs := schema.ValidateUpdate(current, map[string]interface{}{
+				"price": 3.0,
+			})
+			Expect(errs).To(BeEmpty())
+		})
+
+		It("should allow setting immutable fields to their current value", func() {
+			errs := schema.ValidateUpdate(current, map[string]interface{}{
+				"id": testID,
+			})
+			Expect(errs).To(BeEmpty())
+		})
+
+		It("should return errors for all invalid fields", func() {
+			errs := schema.ValidateUpdate(current, map[string]interface{}{
+				"id":      "0fa2d6e8-3b0b-4f4d-9a0e-cd4a4b3c8f7f",
+				"name":    "",
+				"price":   -2.0,
+				"version": 4.0,
+			})
+			Expect(errs).To(Equal(Errors{
+				{Field: "id", Rule: RuleImmutable, Message: "cannot be changed"},
+				{Field: "name", Rule: RuleRequired, Message: "cannot be cleared"},
+				{Field: "price", Rule: RuleMin, Message: "must be at least 0"},
+				{Field: "version", Rule: RuleReadOnly, Message: "cannot be set"},
+			}))
+		})
+	})
+
+	It("should describe all invalid fields in error-message", func() {
+		errs := Errors{
+			{Field: "name", Rule: RuleRequired, Message: "is required"},
+			{Field: "price", Rule: RuleMin, Message: "must be at least 0"},
+		}
+		Expect(errs.Error()).To(Equal(
+			"invalid fields: name is required; price must be at least 0",
+		))
+	})
+})